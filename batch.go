@@ -0,0 +1,773 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversion of the files given on the command line. A single file is
+// converted to stdout, several files are each converted to a Markdown file
+// next to them, i.e. chapters/intro.xmd to chapters/intro.md, which is also
+// where links to included files point to (see includes.go).
+
+// Settings of a run of the command which are not conversion options
+type run struct {
+	options         Options
+	resolveIncludes bool
+	cacheDir        string
+	stdinFilename   string
+	progress        bool
+
+	// Files larger than this are not converted, unless it is 0
+	maxFileSize int64
+
+	// Convert in chunks of this size instead of all at once, unless it is 0
+	chunkSize int
+
+	// Map files into memory instead of reading them, see MapFile
+	mmap bool
+
+	// Convert files with this many jobs at once if it is more than 1, see
+	// ConvertParallel
+	jobs int
+
+	// Write the output as it is converted where that does not change it,
+	// see streamable
+	stream bool
+
+	// The files converted with resolveIncludes, see includes.go
+	project *project
+
+	// Formats (presets) to convert to unless the front matter gives them,
+	// see convertToFormats. Files are written to outDir instead of next to
+	// them if it is given, with {format} replaced by the format.
+	formats []string
+	outDir  string
+
+	// Paths of the files found with -r relative to the directory they were
+	// found in, which they keep in outDir, see walkFiles
+	relative map[string]string
+
+	// The format being converted to
+	format string
+
+	// Replace the files with their conversion instead, keeping the original
+	// with this suffix if it is given
+	inPlace bool
+	backup  string
+}
+
+// What converting a file amounted to
+type result struct {
+	bytes    int
+	warnings int
+}
+
+// Converts the file at |path| (or stdin for "-") to |w|, printing warnings
+// to stderr
+func (r *run) convertFile(path string, w io.Writer) (result, error) {
+	if r.chunkSize > 0 || r.streamable(path) {
+		return r.convertChunked(path, w)
+	}
+
+	// The name of the input in diagnostics, includes are relative to it
+	var content []byte
+	var err error
+	if path == "-" {
+		path = r.stdinFilename
+		content, err = r.read(os.Stdin)
+	} else if r.mmap {
+		var unmap func() error
+		if content, unmap, err = MapFile(path); err == nil {
+			defer unmap()
+			if r.maxFileSize > 0 && int64(len(content)) > r.maxFileSize {
+				err = errTooLarge
+			}
+		}
+	} else if file, openErr := os.Open(path); openErr == nil {
+		content, err = r.read(file)
+		file.Close()
+	} else {
+		err = openErr
+	}
+	if err == errTooLarge {
+		return result{}, fmt.Errorf("Not converting %s, it is larger than %d bytes", path, r.maxFileSize)
+	} else if err != nil {
+		return result{}, fmt.Errorf("Could not read input file %s", path)
+	}
+	return r.convertContent(path, content, w)
+}
+
+// Converts |content| of the file at |path| to |w|, see convertFile
+func (r *run) convertContent(path string, content []byte, w io.Writer) (result, error) {
+	options, err := r.documentOptions(content)
+	if err != nil {
+		return result{}, fmt.Errorf("%s: %s", path, err)
+	}
+	options.sourceDir = filepath.Dir(path)
+	if r.resolveIncludes {
+		if r.project == nil {
+			r.project = newProject(r.options)
+		}
+		r.project.add(path, content)
+		options = r.project.optionsFor(path, options)
+	}
+
+	// Collected images may have changed since the output was cached
+	cache := r.cacheDir != "" && options.CollectAssets == ""
+	key := cacheKey(content, options)
+	if cache {
+		if out, ok := readCache(r.cacheDir, key); ok {
+			if _, err := w.Write(out); err != nil {
+				return result{}, fmt.Errorf("Could not write output: %s", err)
+			}
+			return result{bytes: len(content)}, nil
+		}
+	}
+
+	var out []byte
+	var report Report
+	if r.jobs > 1 {
+		out, report, err = ConvertParallel(content, options, r.jobs)
+	} else {
+		out, report, err = Convert(content, options)
+	}
+	if err != nil {
+		return result{}, r.conversionError(path, err)
+	}
+	if _, err := w.Write(out); err != nil {
+		return result{}, fmt.Errorf("Could not write output: %s", err)
+	}
+	printWarnings(path, report.Warnings)
+
+	// Conversions with warnings are not cached, so they are reported again
+	if cache && len(report.Warnings) == 0 {
+		if err := writeCache(r.cacheDir, key, out); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write cache: %s\n", err)
+		}
+	}
+	return result{len(content), len(report.Warnings)}, nil
+}
+
+// Returns the options for converting a document starting with |head|, with
+// the preset of its format and the options in its front matter
+func (r *run) documentOptions(head []byte) (Options, error) {
+	options := r.options
+	format := r.format
+	if format == "" {
+		formats, err := r.documentFormats(head)
+		if err != nil {
+			return options, err
+		} else if len(formats) > 1 {
+			return options, errors.New("Converting to several formats needs -out-dir")
+		} else if len(formats) == 1 {
+			format = formats[0]
+		}
+	}
+	if format != "" {
+		if err := applyPreset(format, &options); err != nil {
+			return options, err
+		}
+	}
+	return documentOptions(head, options)
+}
+
+// Returns the formats to convert a document starting with |head| to
+func (r *run) documentFormats(head []byte) ([]string, error) {
+	formats, err := documentFormats(head)
+	if formats == nil && err == nil {
+		formats = r.formats
+	}
+	return formats, err
+}
+
+// Whether the output of converting |path| can be written in chunks as it is
+// converted, see ConvertChunked. It is the same as converting all at once
+// unless the options need the whole document, packages are detected after
+// the first chunk or the conversion fails, which is why it is not done with
+// -strict, -timeout or a maximum size of stdin: nothing is written then.
+func (r *run) streamable(path string) bool {
+	options := r.options
+	return r.stream && r.cacheDir == "" && !r.resolveIncludes && r.jobs <= 1 &&
+		options.chunkable() == nil && !options.DetectPackages && !options.Strict && options.Timeout == 0 &&
+		!(path == "-" && r.maxFileSize > 0)
+}
+
+// Converts the file at |path| (or stdin for "-") in chunks, see
+// ConvertChunked. The cache is not used.
+func (r *run) convertChunked(path string, w io.Writer) (result, error) {
+	var input io.Reader = os.Stdin
+	if path == "-" {
+		path = r.stdinFilename
+	} else if r.mmap {
+		content, unmap, err := MapFile(path)
+		if err != nil {
+			return result{}, fmt.Errorf("Could not read input file %s", path)
+		}
+		defer unmap()
+		if r.maxFileSize > 0 && int64(len(content)) > r.maxFileSize {
+			return result{}, fmt.Errorf("Not converting %s, it is larger than %d bytes", path, r.maxFileSize)
+		}
+		input = bytes.NewReader(content)
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return result{}, fmt.Errorf("Could not read input file %s", path)
+		}
+		defer file.Close()
+		if info, err := file.Stat(); err == nil && r.maxFileSize > 0 && info.Size() > r.maxFileSize {
+			return result{}, fmt.Errorf("Not converting %s, it is larger than %d bytes", path, r.maxFileSize)
+		}
+		input = file
+	}
+
+	// Options in the front matter may need the whole document, it is
+	// converted all at once then unless chunks were asked for
+	buffered := bufio.NewReaderSize(input, maxFrontMatterSize)
+	head, _ := buffered.Peek(maxFrontMatterSize)
+	options, err := r.documentOptions(head)
+	if err != nil {
+		return result{}, fmt.Errorf("%s: %s", path, err)
+	}
+	options.sourceDir = filepath.Dir(path)
+	if err := options.chunkable(); err != nil && r.chunkSize > 0 {
+		return result{}, fmt.Errorf("Not converting %s in chunks: %s", path, err)
+	} else if err != nil || options.DetectPackages && r.chunkSize == 0 {
+		content, err := r.read(buffered)
+		if err != nil {
+			return result{}, fmt.Errorf("Could not read input file %s", path)
+		}
+		return r.convertContent(path, content, w)
+	}
+
+	output := &outputWriter{w: w}
+	report, err := ConvertChunked(buffered, output, options, r.chunkSize)
+	if output.err != nil {
+		return result{}, fmt.Errorf("Could not write output: %s", output.err)
+	} else if err != nil {
+		return result{}, r.conversionError(path, err)
+	}
+	printWarnings(path, report.Warnings)
+	return result{report.Stats.InputBytes, len(report.Warnings)}, nil
+}
+
+// Remembers why writing to w failed, to tell write errors from others
+type outputWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	if err != nil && o.err == nil {
+		o.err = err
+	}
+	return n, err
+}
+
+// Describes why converting the file at |path| failed
+func (r *run) conversionError(path string, err error) error {
+	var positionError *PositionError
+	if err == ErrTimeout {
+		return fmt.Errorf("Gave up converting %s after %s", path, r.options.Timeout)
+	} else if errors.As(err, &positionError) {
+		return fmt.Errorf("%s:%s", path, err)
+	}
+	return err
+}
+
+func printWarnings(path string, warnings []Warning) {
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning.in(path))
+	}
+}
+
+var errTooLarge = errors.New("File too large")
+
+// Reads all of |reader| unless it is larger than run.maxFileSize
+func (r *run) read(reader io.Reader) ([]byte, error) {
+	if r.maxFileSize == 0 {
+		return ioutil.ReadAll(reader)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(reader, r.maxFileSize+1))
+	if err == nil && int64(len(content)) > r.maxFileSize {
+		return nil, errTooLarge
+	}
+	return content, err
+}
+
+// Parses sizes like "50M", with the suffixes K, M and G for multiples of 1024
+func parseSize(size string) (int64, error) {
+	multiple := int64(1)
+	number := strings.TrimSuffix(strings.ToUpper(size), "B")
+	for i, suffix := range []string{"K", "M", "G"} {
+		if strings.HasSuffix(number, suffix) {
+			number = strings.TrimSuffix(number, suffix)
+			multiple = int64(1) << (10 * uint(i+1))
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("Invalid size %s, expected a number like 50M", size)
+	}
+	return n * multiple, nil
+}
+
+// Returns the files listed in the file at |path| (or stdin for "-"), one per
+// line or separated by NUL characters
+func readFileList(path string, nulSeparated bool) ([]string, error) {
+	var list []byte
+	var err error
+	if path == "-" {
+		list, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		list, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read file list %s", path)
+	}
+	return splitFileList(string(list), nulSeparated), nil
+}
+
+func splitFileList(list string, nulSeparated bool) []string {
+	separator := "\n"
+	if nulSeparated {
+		separator = "\x00"
+	}
+
+	var files []string
+	for _, file := range strings.Split(list, separator) {
+		if !nulSeparated {
+			file = strings.TrimSuffix(file, "\r")
+		}
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Converts each of |paths| to the Markdown file next to it. Returns the
+// number of files which could not be converted, which are listed at the end.
+func (r *run) convertFiles(paths []string) int {
+	progress := newProgress(len(paths), r.progress)
+	var failures []string
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		failures = append(failures, err.Error())
+	}
+
+	r.startProject(paths)
+
+	outputs := map[string]string{}
+	for _, path := range paths {
+		// Files of the same name would be written to the same file
+		name := r.outputName(path)
+		if other, ok := outputs[name]; ok && r.outDir != "" {
+			fail(fmt.Errorf("Not converting %s, %s is converted to the same file in %s", path, other, r.outDir))
+			progress.update(result{})
+			continue
+		}
+		outputs[name] = path
+
+		res, err := r.convertToFormats(path)
+		if err != nil {
+			fail(err)
+		}
+		progress.update(res)
+	}
+
+	progress.finish()
+	if len(failures) > 0 {
+		fmt.Fprint(os.Stderr, failureSummary(failures, len(paths)))
+	}
+	return len(failures)
+}
+
+// Lists the |failures| of converting |total| files
+func failureSummary(failures []string, total int) string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "Could not convert %d of %d files:\n", len(failures), total)
+	for _, failure := range failures {
+		fmt.Fprintf(&summary, "  %s\n", strings.Replace(failure, "\n", "\n  ", -1))
+	}
+	return summary.String()
+}
+
+// Converts the file at |path| to a Markdown file for each of its formats, in
+// the output directory of the format. The file is converted once for each.
+func (r *run) convertToFormats(path string) (result, error) {
+	if r.inPlace {
+		return r.convertInPlace(path)
+	} else if r.outDir == "" {
+		return r.convertToFile(path, outputPath(path))
+	}
+	if path == "-" {
+		return result{}, errors.New("Not converting stdin, -out-dir needs the name of the file")
+	}
+
+	head, err := readHead(path, maxFrontMatterSize)
+	if err != nil {
+		return result{}, fmt.Errorf("Could not read input file %s", path)
+	}
+	formats, err := r.documentFormats(head)
+	if err != nil {
+		return result{}, fmt.Errorf("%s: %s", path, err)
+	}
+	if len(formats) > 1 && !strings.Contains(r.outDir, "{format}") {
+		return result{}, fmt.Errorf("Not converting %s to several formats, -out-dir needs {format}", path)
+	} else if len(formats) == 0 {
+		formats = []string{""}
+	}
+
+	var total result
+	for _, format := range formats {
+		output := filepath.Join(strings.Replace(r.outDir, "{format}", format, -1), r.outputName(path))
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			return total, fmt.Errorf("Could not create output directory %s", filepath.Dir(output))
+		}
+
+		converter := *r
+		converter.format = format
+		res, err := converter.convertToFile(path, output)
+		total.bytes, total.warnings = total.bytes+res.bytes, total.warnings+res.warnings
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Returns the path of the converted file at |path| in outDir, its name or
+// with -r its path relative to the directory it was found in
+func (r *run) outputName(path string) string {
+	if relative, ok := r.relative[path]; ok {
+		return outputPath(relative)
+	}
+	return filepath.Base(outputPath(path))
+}
+
+// Returns the files in the directories of |paths| and their subdirectories
+// whose name matches |pattern|, in lexical order, and their paths relative
+// to the directory. Hidden directories and |outDir| (up to a {format} in it)
+// are skipped, files in |paths| are returned as they are.
+//
+// Symbolic links are skipped unless |follow| is given, links to directories
+// are followed unless they link to a directory they are in. Only regular
+// files are converted, sockets, devices and pipes are skipped.
+func walkFiles(paths []string, pattern, outDir string, follow bool) ([]string, map[string]string, error) {
+	w := walk{pattern: pattern, outDir: strings.Split(outDir, "{format}")[0], follow: follow, relative: map[string]string{}}
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil || !info.IsDir() {
+			w.files = append(w.files, root)
+			continue
+		}
+		w.root = root
+		if err := w.walkDir(root, []os.FileInfo{info}); err != nil {
+			return nil, nil, fmt.Errorf("Could not read directory %s: %s", root, err)
+		}
+	}
+	return w.files, w.relative, nil
+}
+
+// The state of walkFiles
+type walk struct {
+	pattern, outDir, root string
+	follow                bool
+	files                 []string
+	relative              map[string]string
+}
+
+// Adds the files in |dir| and its subdirectories, which is in the
+// directories |parents| (and the last one of them)
+func (w *walk) walkDir(dir string, parents []os.FileInfo) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range entries {
+		path := filepath.Join(dir, info.Name())
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.follow {
+				continue
+			}
+			// Broken links are skipped
+			if info, err = os.Stat(path); err != nil {
+				continue
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			if strings.HasPrefix(info.Name(), ".") || w.outDir != "" && filepath.Clean(path) == filepath.Clean(w.outDir) || inDirectories(info, parents) {
+				continue
+			}
+			if err := w.walkDir(path, append(parents, info)); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if matched, _ := filepath.Match(w.pattern, info.Name()); !matched {
+				continue
+			}
+			w.files = append(w.files, path)
+			if w.relative[path], err = filepath.Rel(w.root, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Whether the directory |info| is one of |directories|, to which a link
+// loops back
+func inDirectories(info os.FileInfo, directories []os.FileInfo) bool {
+	for _, directory := range directories {
+		if os.SameFile(info, directory) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns up to the first |n| bytes of the file at |path|
+func readHead(path string, n int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head, err := ioutil.ReadAll(io.LimitReader(file, int64(n)))
+	return head, err
+}
+
+// With resolveIncludes, labels link to all of |paths| and numbers continue
+// in the files included
+func (r *run) startProject(paths []string) {
+	if !r.resolveIncludes {
+		return
+	}
+
+	r.project = newProject(r.options)
+	var readable []string
+	var contents [][]byte
+	for _, path := range paths {
+		if content, err := ioutil.ReadFile(path); err == nil {
+			readable = append(readable, path)
+			contents = append(contents, content)
+		}
+	}
+	r.project.addAll(readable, contents)
+}
+
+// Converts each of |paths| into a single document written to |w|, in order
+// and separated by |separator|, with the headings of each file one level
+// lower if |demote|. Returns the number of files which could not be
+// converted, which are left out.
+func (r *run) concatFiles(paths []string, separator string, demote bool, w io.Writer) int {
+	progress := newProgress(len(paths), r.progress)
+	failed := 0
+	r.startProject(paths)
+
+	written := 0
+	for _, path := range paths {
+		var out bytes.Buffer
+		res, err := r.convertFile(path, &out)
+		progress.update(res)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed += 1
+			continue
+		}
+
+		converted := out.Bytes()
+		if demote {
+			converted = shiftHeadings(converted, 1)
+		}
+		if written > 0 {
+			converted = append([]byte(separator), converted...)
+		}
+		if _, err := w.Write(converted); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write output: %s\n", err)
+			return len(paths) - written
+		}
+		written += 1
+	}
+
+	progress.finish()
+	return failed
+}
+
+// Replaces \n, \t and \\ in a separator given on the command line
+func unescapeSeparator(separator string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t").Replace(separator)
+}
+
+func (r *run) convertToFile(path, output string) (result, error) {
+	if filepath.Clean(path) == filepath.Clean(output) {
+		return result{}, fmt.Errorf("Not converting %s, it would be overwritten", path)
+	}
+
+	// Nothing is written if the conversion fails
+	if r.chunkSize > 0 {
+		return r.convertToTempFile(path, output)
+	}
+	var out bytes.Buffer
+	res, err := r.convertFile(path, &out)
+	if err != nil {
+		return res, err
+	}
+	if err := ioutil.WriteFile(output, out.Bytes(), 0644); err != nil {
+		return res, fmt.Errorf("Could not write output file %s", output)
+	}
+	return res, nil
+}
+
+// Same as convertToFile without holding the output in memory, it is renamed
+// to |output| once complete
+func (r *run) convertToTempFile(path, output string) (result, error) {
+	temp, res, err := r.convertToTemp(path, output, 0644)
+	if err != nil {
+		return res, err
+	}
+	defer os.Remove(temp)
+	if err := os.Rename(temp, output); err != nil {
+		return res, fmt.Errorf("Could not write output file %s", output)
+	}
+	return res, nil
+}
+
+// Converts the file at |path| to a temporary file with |mode| next to
+// |output|, to be renamed to it. Returns its path, it is removed if the
+// conversion fails.
+func (r *run) convertToTemp(path, output string, mode os.FileMode) (string, result, error) {
+	file, err := ioutil.TempFile(filepath.Dir(output), ".merkderwn-")
+	if err != nil {
+		return "", result{}, fmt.Errorf("Could not write output file %s", output)
+	}
+
+	res, err := r.convertFile(path, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Could not write output file %s", output)
+	}
+	if err == nil && os.Chmod(file.Name(), mode) != nil {
+		err = fmt.Errorf("Could not write output file %s", output)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", res, err
+	}
+	return file.Name(), res, nil
+}
+
+// Replaces the file at |path| with its conversion, keeping the original as
+// path+backup if backup is given. The file is only replaced once it is
+// converted.
+func (r *run) convertInPlace(path string) (result, error) {
+	if path == "-" {
+		return result{}, errors.New("Not converting stdin in place")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return result{}, fmt.Errorf("Could not read input file %s", path)
+	}
+
+	temp, res, err := r.convertToTemp(path, path, info.Mode().Perm())
+	if err != nil {
+		return res, err
+	}
+	defer os.Remove(temp)
+
+	if r.backup != "" {
+		original, err := ioutil.ReadFile(path)
+		if err != nil {
+			return res, fmt.Errorf("Could not read input file %s", path)
+		}
+		if err := ioutil.WriteFile(path+r.backup, original, info.Mode().Perm()); err != nil {
+			return res, fmt.Errorf("Could not write backup %s", path+r.backup)
+		}
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return res, fmt.Errorf("Could not write output file %s", path)
+	}
+	return res, nil
+}
+
+// Returns the path |path| is converted to, e.g. notes.md for notes.xmd
+func outputPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".md"
+}
+
+// Reports the progress of converting several files on stderr. On a terminal
+// the report is updated after every file, otherwise it is printed every few
+// seconds so CI logs are not flooded.
+type progress struct {
+	enabled  bool
+	terminal bool
+
+	total, done     int
+	bytes, warnings int
+
+	start, reported time.Time
+}
+
+// How often progress is reported when stderr is not a terminal
+const progressInterval = 10 * time.Second
+
+func newProgress(total int, enabled bool) *progress {
+	now := time.Now()
+	return &progress{enabled: enabled, terminal: isTerminal(os.Stderr), total: total, start: now, reported: now}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progress) update(res result) {
+	p.done += 1
+	p.bytes += res.bytes
+	p.warnings += res.warnings
+	if !p.enabled {
+		return
+	}
+
+	if p.terminal {
+		fmt.Fprintf(os.Stderr, "\r%s", p.summary(time.Since(p.start)))
+	} else if time.Since(p.reported) >= progressInterval {
+		fmt.Fprintln(os.Stderr, p.summary(time.Since(p.start)))
+		p.reported = time.Now()
+	}
+}
+
+func (p *progress) finish() {
+	if !p.enabled {
+		return
+	}
+	if p.terminal {
+		fmt.Fprint(os.Stderr, "\r")
+	}
+	fmt.Fprintln(os.Stderr, p.summary(time.Since(p.start)))
+}
+
+// Formats the progress like "12/40 files, 3 warnings, 1.5 MB/s"
+func (p *progress) summary(elapsed time.Duration) string {
+	throughput := 0.0
+	if elapsed > 0 {
+		throughput = float64(p.bytes) / elapsed.Seconds() / 1e6
+	}
+	return fmt.Sprintf("%d/%d files, %d warnings, %.1f MB/s", p.done, p.total, p.warnings, throughput)
+}
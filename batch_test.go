@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputPath(t *testing.T) {
+	assert.Equal(t, "chapters/intro.md", outputPath("chapters/intro.xmd"))
+	assert.Equal(t, "notes.md", outputPath("notes.tex"))
+	assert.Equal(t, "README.md", outputPath("README"))
+}
+
+func TestConvertFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.xmd"), filepath.Join(dir, "b.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$x$"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("$y$"), 0644))
+	existing := filepath.Join(dir, "c.md")
+	assert.NoError(t, ioutil.WriteFile(existing, []byte("keep"), 0644))
+
+	r := run{}
+	assert.Equal(t, 2, r.convertFiles([]string{a, filepath.Join(dir, "missing.xmd"), b, existing}))
+
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "a.md"))
+	assert.Equal(t, "<!--$x$-->", string(out))
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "b.md"))
+	assert.Equal(t, "<!--$y$-->", string(out))
+	out, _ = ioutil.ReadFile(existing)
+	assert.Equal(t, "keep", string(out))
+	_, err = os.Stat(filepath.Join(dir, "missing.md"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConvertFilesWithIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.xmd"), filepath.Join(dir, "b.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("\\eqref{eq:two}"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("\\begin{equation} x \\label{eq:two} \\end{equation}"), 0644))
+
+	r := run{options: Options{NumberEquations: true}, resolveIncludes: true}
+	assert.Equal(t, 0, r.convertFiles([]string{a, b}))
+
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "a.md"))
+	assert.Equal(t, "[(1)](b.md#eq:two)", string(out))
+}
+
+func TestConvertFilesInChunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.xmd"), filepath.Join(dir, "b.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$x$\n\n$y$"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("a\n\n$y"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.md"), []byte("keep"), 0644))
+
+	r := run{chunkSize: 2, options: Options{Strict: true}}
+	assert.Equal(t, 1, r.convertFiles([]string{a, b}))
+
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "a.md"))
+	assert.Equal(t, "<!--$x$-->\n\n<!--$y$-->", string(out))
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "b.md"))
+	assert.Equal(t, "keep", string(out))
+
+	// No temporary files are left behind
+	files, _ := filepath.Glob(filepath.Join(dir, ".merkderwn-*"))
+	assert.Empty(t, files)
+}
+
+func TestFailureSummary(t *testing.T) {
+	assert.Equal(t, "Could not convert 2 of 40 files:\n  Could not read input file a.xmd\n  b.xmd:3:1: Unterminated math\n    at $x\n",
+		failureSummary([]string{"Could not read input file a.xmd", "b.xmd:3:1: Unterminated math\n  at $x"}, 40))
+}
+
+func TestProgressSummary(t *testing.T) {
+	p := newProgress(40, false)
+	p.update(result{bytes: 2000000, warnings: 1})
+	p.update(result{bytes: 1000000, warnings: 2})
+	assert.Equal(t, "2/40 files, 3 warnings, 1.5 MB/s", p.summary(2*time.Second))
+}
+
+func TestParseSize(t *testing.T) {
+	for size, expected := range map[string]int64{"100": 100, "2K": 2048, "50M": 50 << 20, "1g": 1 << 30, "3MB": 3 << 20} {
+		n, err := parseSize(size)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, n, size)
+	}
+
+	_, err := parseSize("lots")
+	assert.Error(t, err)
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.xmd")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("12345"), 0644))
+
+	r := run{maxFileSize: 4}
+	_, err = r.convertFile(path, ioutil.Discard)
+	assert.Error(t, err)
+
+	r.maxFileSize = 5
+	_, err = r.convertFile(path, ioutil.Discard)
+	assert.NoError(t, err)
+}
+
+func TestSplitFileList(t *testing.T) {
+	assert.Equal(t, []string{"a.xmd", "with space.xmd"}, splitFileList("a.xmd\r\nwith space.xmd\n\n", false))
+	assert.Equal(t, []string{"a.xmd", "new\nline.xmd"}, splitFileList("a.xmd\x00new\nline.xmd\x00", true))
+	assert.Empty(t, splitFileList("", false))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestConvertInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$x$"), 0600))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("$x"), 0644))
+
+	r := run{inPlace: true, backup: ".bak", options: Options{Strict: true}}
+	assert.Equal(t, 1, r.convertFiles([]string{a, b}))
+
+	out, _ := ioutil.ReadFile(a)
+	assert.Equal(t, "<!--$x$-->", string(out))
+	info, err := os.Stat(a)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	out, _ = ioutil.ReadFile(a + ".bak")
+	assert.Equal(t, "$x$", string(out))
+
+	// Left alone when its conversion fails
+	out, _ = ioutil.ReadFile(b)
+	assert.Equal(t, "$x", string(out))
+	_, err = os.Stat(b + ".bak")
+	assert.True(t, os.IsNotExist(err))
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 3, len(files))
+}
+
+func TestWriteErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.xmd")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("$x$\n\n$y$"), 0644))
+
+	// Written from the cache as well
+	cached := run{cacheDir: filepath.Join(dir, "cache")}
+	_, err = cached.convertFile(path, ioutil.Discard)
+	assert.NoError(t, err)
+
+	for _, r := range []run{{}, {chunkSize: 2}, {stream: true}, cached} {
+		_, err := r.convertFile(path, failingWriter{})
+		assert.Error(t, err)
+		assert.Equal(t, "Could not write output: disk full", err.Error())
+	}
+}
+
+// Counts the writes
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes += 1
+	return w.Buffer.Write(p)
+}
+
+func TestStreamedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.xmd")
+	content := []byte(strings.Repeat("Text with $x$.\n\n", 200000))
+	assert.NoError(t, ioutil.WriteFile(path, content, 0644))
+	expected, _, err := Convert(content, Options{})
+	assert.NoError(t, err)
+
+	var out countingWriter
+	r := run{stream: true}
+	_, err = r.convertFile(path, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), out.String())
+	assert.True(t, out.writes > 2)
+
+	// Nothing is written if the conversion fails
+	out = countingWriter{}
+	r.options.Strict = true
+	_, err = r.convertFile(path, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, out.writes)
+}
+
+func TestFrontMatterOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.xmd")
+	frontMatter := "---\nmerkderwn:\n  headings: true\n\n  links: true\n---\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(frontMatter+"\\section{A}\n\n\\url{x}"), 0644))
+
+	// Converted all at once for the headings
+	for _, r := range []run{{}, {stream: true}} {
+		var out bytes.Buffer
+		_, err = r.convertFile(path, &out)
+		assert.NoError(t, err)
+		assert.Equal(t, frontMatter+"# A\n\n<x>", out.String())
+	}
+
+	r := run{chunkSize: 2}
+	_, err = r.convertFile(path, ioutil.Discard)
+	if assert.Error(t, err) {
+		assert.Equal(t, "Not converting "+path+" in chunks: Converting headings needs the whole document", err.Error())
+	}
+
+	// Chunks do not end inside the front matter
+	frontMatter = "---\nmerkderwn:\n  links: true\n\nsummary: $x$\n---\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(frontMatter+"\\url{x}\n\n$y$"), 0644))
+	var out bytes.Buffer
+	_, err = r.convertFile(path, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, frontMatter+"<x>\n\n<!--$y$-->", out.String())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("---\nmerkderwn:\n  preset: web\n---\n"), 0644))
+	r = run{}
+	_, err = r.convertFile(path, ioutil.Discard)
+	assert.Error(t, err)
+}
+
+func TestConvertToFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.xmd"), filepath.Join(dir, "b.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("\\section{A}\n\n$x$"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("---\nmerkderwn:\n  format: anki\n---\n$x < y$"), 0644))
+
+	outDir := filepath.Join(dir, "build", "{format}")
+	r := run{formats: []string{"mathjax", "pandoc"}, outDir: outDir}
+	assert.Equal(t, 0, r.convertFiles([]string{a, b}))
+
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "build", "mathjax", "a.md"))
+	assert.Equal(t, "<!--\\section{A}-->\n\n$x$", string(out))
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "build", "pandoc", "a.md"))
+	assert.Equal(t, "# A\n\n$x$", string(out))
+
+	// Only in the formats of its front matter
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "build", "anki", "b.md"))
+	assert.Equal(t, "---\nmerkderwn:\n  format: anki\n---\n\\(x &lt; y\\)", string(out))
+	_, err = os.Stat(filepath.Join(dir, "build", "mathjax", "b.md"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Several formats need a directory for each
+	r = run{outDir: filepath.Join(dir, "out")}
+	assert.NoError(t, ioutil.WriteFile(b, []byte("---\nmerkderwn:\n  format: [anki, mathjax]\n---\n"), 0644))
+	assert.Equal(t, 1, r.convertFiles([]string{a, b}))
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "out", "a.md"))
+	assert.Equal(t, "<!--\\section{A}-->\n\n<!--$x$-->", string(out))
+
+	_, err = r.convertFile(b, ioutil.Discard)
+	if assert.Error(t, err) {
+		assert.Equal(t, b+": Converting to several formats needs -out-dir", err.Error())
+	}
+
+	// Files of the same name
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	c := filepath.Join(dir, "sub", "a.xmd")
+	assert.NoError(t, ioutil.WriteFile(c, []byte("$y$"), 0644))
+	assert.Equal(t, 1, r.convertFiles([]string{a, c}))
+}
+
+func TestConcatFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.xmd"), filepath.Join(dir, "b.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("# A\n$x$"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("\\section{B}\n```\n# code\n```"), 0644))
+
+	r := run{options: Options{Headings: true}}
+	var out bytes.Buffer
+	assert.Equal(t, 1, r.concatFiles([]string{a, filepath.Join(dir, "missing.xmd"), b}, "\n\n---\n\n", true, &out))
+	assert.Equal(t, "## A\n<!--$x$-->\n\n---\n\n## B\n```\n# code\n```", out.String())
+
+	out.Reset()
+	assert.Equal(t, 0, r.concatFiles([]string{b, a}, "\n\n", false, &out))
+	assert.Equal(t, "# B\n```\n# code\n```\n\n# A\n<!--$x$-->", out.String())
+
+	assert.Equal(t, "\n\n---\t\\n", unescapeSeparator(`\n\n---\t\\n`))
+}
+
+func TestIsTerminal(t *testing.T) {
+	// Piped input is read from stdin when no file is given
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	defer r.Close()
+	defer w.Close()
+	assert.False(t, isTerminal(r))
+
+	file, err := ioutil.TempFile("", "merkderwn-test")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+	assert.False(t, isTerminal(file))
+}
+
+func TestConvertFilesRecursively(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	content := filepath.Join(dir, "content")
+	for path, text := range map[string]string{
+		"index.md":         "$x$",
+		"guide/intro.md":   "$y$",
+		"guide/notes.txt":  "$z$",
+		".git/HEAD.md":     "$z$",
+		"build/old/out.md": "$z$",
+	} {
+		path = filepath.Join(content, filepath.FromSlash(path))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(text), 0644))
+	}
+	other := filepath.Join(dir, "other.xmd")
+	assert.NoError(t, ioutil.WriteFile(other, []byte("$w$"), 0644))
+
+	build := filepath.Join(content, "build", "{format}")
+	files, relative, err := walkFiles([]string{content, other}, "*.md", build, false)
+	assert.NoError(t, err)
+	intro, index := filepath.Join(content, "guide", "intro.md"), filepath.Join(content, "index.md")
+	assert.Equal(t, []string{intro, index, other}, files)
+	assert.Equal(t, map[string]string{intro: filepath.Join("guide", "intro.md"), index: "index.md"}, relative)
+
+	r := run{outDir: build, relative: relative, formats: []string{"mathjax"}}
+	assert.Equal(t, 0, r.convertFiles(files))
+	for path, expected := range map[string]string{"guide/intro.md": "$y$", "index.md": "$x$", "other.md": "$w$"} {
+		out, err := ioutil.ReadFile(filepath.Join(content, "build", "mathjax", filepath.FromSlash(path)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(out))
+	}
+
+	// Reported when it is converted
+	missing := filepath.Join(dir, "missing")
+	files, _, err = walkFiles([]string{missing}, "*.md", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{missing}, files)
+}
+
+func TestWalkSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	docs, shared := filepath.Join(dir, "docs"), filepath.Join(dir, "shared")
+	assert.NoError(t, os.MkdirAll(docs, 0755))
+	assert.NoError(t, os.MkdirAll(shared, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(docs, "a.md"), nil, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(shared, "chapter.md"), nil, 0644))
+	if err := os.Symlink(shared, filepath.Join(docs, "shared")); err != nil {
+		t.Skip("Symbolic links are not supported:", err)
+	}
+	assert.NoError(t, os.Symlink(docs, filepath.Join(shared, "loop")))
+	assert.NoError(t, os.Symlink(filepath.Join(shared, "chapter.md"), filepath.Join(docs, "b.md")))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "missing.md"), filepath.Join(docs, "broken.md")))
+	if listener, err := net.Listen("unix", filepath.Join(docs, "socket.md")); err == nil {
+		defer listener.Close()
+	}
+
+	files, _, err := walkFiles([]string{docs}, "*.md", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(docs, "a.md")}, files)
+
+	files, relative, err := walkFiles([]string{docs}, "*.md", "", true)
+	assert.NoError(t, err)
+	chapter := filepath.Join(docs, "shared", "chapter.md")
+	assert.Equal(t, []string{filepath.Join(docs, "a.md"), filepath.Join(docs, "b.md"), chapter}, files)
+	assert.Equal(t, filepath.Join("shared", "chapter.md"), relative[chapter])
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// Cache of converted files, so converting a whole book again only converts
+// the files that changed. Outputs are stored under the hash of the input and
+// the options, a changed file or option simply misses the cache.
+
+// Part of the keys, so outputs of other versions are not reused. Changes
+// with every release changing the output, builds from a checkout add the
+// revision, see buildRevision.
+const cacheVersion = "2"
+
+// Returns the key |content| converted with |options| is cached under
+func cacheKey(content []byte, options Options) string {
+	hash := sha256.New()
+	hash.Write(content)
+	fmt.Fprintf(hash, "\x00%s\x00%s", cacheVersion, buildRevision())
+
+	// Only what affects the output, the renderer by its type as pointers
+	// differ between processes
+	fmt.Fprintf(hash, "\x00%T", options.Renderer)
+	options.Renderer, options.Logger, options.OnConvert, options.Timeout = nil, nil, nil, 0
+	options.includeFile = nil
+	fmt.Fprintf(hash, "\x00%#v", options)
+
+	// \today is replaced with the current date
+	if options.Today && options.Date.IsZero() {
+		fmt.Fprintf(hash, "\x00%s", time.Now().Format("2006-01-02"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Returns the VCS revision merkderwn was built from, if it is known
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	var revision string
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision":
+			revision += setting.Value
+		case setting.Key == "vcs.modified" && setting.Value == "true":
+			revision += "+modified"
+		}
+	}
+	return info.Main.Version + " " + revision
+}
+
+// Returns the output cached under |key| in |dir|
+func readCache(dir, key string) ([]byte, bool) {
+	out, err := ioutil.ReadFile(filepath.Join(dir, key))
+	return out, err == nil
+}
+
+func writeCache(dir, key string, out []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Written in one go, so a cancelled conversion cannot leave half a file
+	temp := filepath.Join(dir, key+".tmp")
+	if err := ioutil.WriteFile(temp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, filepath.Join(dir, key))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	key := cacheKey([]byte("$x$"), Options{})
+	assert.Equal(t, key, cacheKey([]byte("$x$"), Options{}))
+	assert.NotEqual(t, key, cacheKey([]byte("$y$"), Options{}))
+	assert.NotEqual(t, key, cacheKey([]byte("$x$"), Options{MathPassthrough: true}))
+
+	// Settings which do not change the output do not matter
+	options := Options{Logger: slog.Default(), OnConvert: func(Stats, error) {}, Timeout: time.Second}
+	assert.Equal(t, key, cacheKey([]byte("$x$"), options))
+	assert.Equal(t, cacheKey([]byte("$x$"), Options{Renderer: htmlRenderer{}}), cacheKey([]byte("$x$"), Options{Renderer: htmlRenderer{}}))
+	assert.NotEqual(t, key, cacheKey([]byte("$x$"), Options{Renderer: htmlRenderer{}}))
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, ok := readCache(dir, "key")
+	assert.False(t, ok)
+
+	assert.NoError(t, writeCache(dir+"/cache", "key", []byte("out")))
+	out, ok := readCache(dir+"/cache", "key")
+	assert.True(t, ok)
+	assert.Equal(t, "out", string(out))
+}
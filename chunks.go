@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Conversion of input too large to hold in memory, in chunks of about
+// chunkSize bytes. Chunks end at the last blank line read which is not part
+// of math, a comment or LaTeX, the input after it is carried over to the next
+// chunk. Constructs are thus never split, a construct longer than chunkSize
+// makes its chunk longer.
+//
+// Chunks share the state of the document, e.g. the numbers of footnotes and
+// the definitions of the chunks before. Conversions which need the whole
+// document before they can complete the output are not supported, see
+// chunkable.
+
+// Default size of the chunks read by ConvertChunked
+const defaultChunkSize = 1 << 20
+
+// Converts |r| to |w| in chunks of about |chunkSize| bytes, see Convert. The
+// output of the chunks before an error is written. Options which need the
+// whole document are rejected, ConvertReader takes them as well.
+func ConvertChunked(r io.Reader, w io.Writer, options Options, chunkSize int) (Report, error) {
+	if err := options.validate(); err != nil {
+		return Report{}, err
+	}
+	if err := options.chunkable(); err != nil {
+		return Report{}, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	start := time.Now()
+	doc := &document{headings: headingState{top: -1}, chunked: true}
+	stats, err := convertChunks(r, w, options, chunkSize, doc)
+	stats.Warnings = len(doc.warnings)
+	stats.Duration = time.Since(start)
+	if options.OnConvert != nil {
+		options.OnConvert(stats, err)
+	}
+	return Report{Warnings: doc.warnings, Stats: stats, Headings: doc.headings.converted}, err
+}
+
+// Converts |r| to |w|, see Convert. The input is converted in chunks of the
+// default size if |options| allow it (see chunkable) and read as a whole
+// otherwise, so the output is always the same as Convert's.
+func ConvertReader(r io.Reader, w io.Writer, options Options) (Report, error) {
+	if options.chunkable() == nil {
+		return ConvertChunked(r, w, options, defaultChunkSize)
+	}
+
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Report{}, err
+	}
+	out, report, err := Convert(in, options)
+	if err != nil {
+		return report, err
+	}
+	_, err = w.Write(out)
+	return report, err
+}
+
+func convertChunks(r io.Reader, w io.Writer, options Options, chunkSize int, doc *document) (Stats, error) {
+	var in, out int
+	var pending []byte
+	buffer := make([]byte, chunkSize)
+
+	// The start of the input, for telling whether it is binary
+	var head []byte
+
+	for done := false; !done; {
+		n, err := io.ReadFull(r, buffer)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			done = true
+		} else if err != nil {
+			return doc.stats, err
+		}
+		pending = append(pending, buffer[:n]...)
+		if len(head) < binarySniffSize {
+			head = append(head, buffer[:n]...)
+			if err := binaryInput(head); err != nil {
+				return doc.stats, err
+			}
+		}
+
+		end := len(pending)
+		if !done {
+			// The front matter is only copied as it is in one piece
+			if end = chunkEnd(pending, options); end == 0 || doc.offset == 0 && inFrontMatter(pending, end) {
+				continue
+			}
+		}
+
+		converted, err := convertChunk(pending[:end], &options, doc)
+		if err != nil {
+			return doc.stats, err
+		}
+		if _, err := w.Write(converted); err != nil {
+			return doc.stats, err
+		}
+		in, out = in+end, out+len(converted)
+
+		doc.offset += end
+		doc.line += bytes.Count(pending[:end], []byte("\n"))
+		pending = pending[:copy(pending, pending[end:])]
+	}
+
+	// Footnotes and the index go at the end of the document
+	c := NewConverter(nil, options)
+	c.doc = doc
+	c.finish()
+	if _, err := w.Write(c.out.Bytes()); err != nil {
+		return doc.stats, err
+	}
+
+	stats := doc.stats
+	stats.InputBytes, stats.OutputBytes = in, out+c.out.Len()
+	return stats, nil
+}
+
+// Converts a chunk of the document, see Convert. Options enabled for the
+// packages loaded in it stay enabled for the following chunks.
+func convertChunk(chunk []byte, options *Options, doc *document) ([]byte, error) {
+	c := NewConverter(chunk, *options)
+	*options = c.options
+
+	// Chunks start at the beginning of a line
+	invalid := c.doc.invalid
+	if invalid != nil {
+		position := invalid.Position
+		position.Offset += doc.offset
+		position.Line += doc.line
+		invalid = &PositionError{invalid.Err, position}
+	}
+
+	c.doc = doc
+	c.doc.invalid = invalid
+	problems := len(doc.problems)
+	out := c.Convert()
+
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if options.Strict && len(doc.problems) > problems {
+		return nil, doc.problems[problems]
+	}
+	return out, nil
+}
+
+// Returns where the chunk in |in| ends, after its last blank line outside of
+// any construct, or 0 if there is none
+func chunkEnd(in []byte, options Options) int {
+	// Only what is consumed matters, not what is emitted
+	options.Logger, options.Renderer, options.RenderMath = nil, nil, ""
+
+	end := 0
+	for _, span := range spans(in, options) {
+		if span.Kind != TextSpan {
+			continue
+		}
+		if i := bytes.LastIndex(in[span.Start:span.End], []byte("\n\n")); i >= 0 {
+			end = span.Start + i + 2
+		}
+	}
+	return end
+}
+
+// Checks that the options do not need the whole document
+func (options Options) chunkable() error {
+	switch {
+	case options.NumberEquations:
+		return errors.New("Numbering equations needs the whole document")
+	case options.ListOfFloats:
+		return errors.New("Lists of figures and tables need the whole document")
+	case options.ValidateLatex:
+		return errors.New("Validating LaTeX needs the whole document")
+	case options.CheckLinks:
+		return errors.New("Checking links needs the whole document")
+	case options.Headings:
+		// The highest division is looked for in the whole input
+		return errors.New("Converting headings needs the whole document")
+	case options.Slides:
+		return errors.New("Separating slides needs the whole document")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const chunkedDocument = `\usepackage{siunitx}
+\section{One}
+
+Text with $x$ and \SI{3}{\meter}.
+
+$$a
+
+b$$
+
+\begin{tikzpicture}
+
+\end{tikzpicture}
+
+<!-- a
+
+comment -->
+
+\appendix
+\section{Two}
+
+Größe\marginpar{Note}
+
+\foo{a
+
+b}
+`
+
+func TestConvertChunked(t *testing.T) {
+	options := Options{MarginNotes: "footnote", DetectPackages: true}
+	expected, _, err := Convert([]byte(chunkedDocument), options)
+	assert.NoError(t, err)
+
+	for _, size := range []int{1, 3, 16, 100, 10000} {
+		var out bytes.Buffer
+		report, err := ConvertChunked(strings.NewReader(chunkedDocument), &out, options, size)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), out.String(), size)
+		assert.Equal(t, len(chunkedDocument), report.Stats.InputBytes)
+		assert.Equal(t, out.Len(), report.Stats.OutputBytes)
+		assert.Equal(t, 2, report.Stats.Math)
+	}
+}
+
+func TestConvertReader(t *testing.T) {
+	for _, options := range []Options{{MarginNotes: "footnote"}, {Headings: true}} {
+		expected, _, err := Convert([]byte(chunkedDocument), options)
+		assert.NoError(t, err)
+
+		var out bytes.Buffer
+		report, err := ConvertReader(strings.NewReader(chunkedDocument), &out, options)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), out.String())
+		assert.Equal(t, len(chunkedDocument), report.Stats.InputBytes)
+	}
+
+	var out bytes.Buffer
+	_, err := ConvertReader(strings.NewReader("a $x"), &out, Options{Strict: true, Headings: true})
+	assert.True(t, errors.Is(err, ErrUnterminatedMath))
+	assert.Equal(t, 0, out.Len())
+}
+
+func TestChunkEnd(t *testing.T) {
+	assert.Equal(t, 0, chunkEnd([]byte("a\nb"), Options{}))
+	assert.Equal(t, 3, chunkEnd([]byte("a\n\nb"), Options{}))
+	assert.Equal(t, 3, chunkEnd([]byte("a\n\n$b\n\nc"), Options{}))
+	assert.Equal(t, 0, chunkEnd([]byte("<!--\n\n"), Options{}))
+
+	// Content which is converted as a whole
+	conditional := []byte("\\iffalse\n\na\\fi")
+	assert.Equal(t, 10, chunkEnd(conditional, Options{}))
+	assert.Equal(t, 0, chunkEnd(conditional, Options{Conditionals: "drop"}))
+}
+
+func TestConvertChunkedPositions(t *testing.T) {
+	var out bytes.Buffer
+	report, err := ConvertChunked(strings.NewReader("a\n\nb\n\n\\foo{\xff\n\nc"), &out, Options{}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []Warning{
+		{5, 6, "Invalid UTF-8"},
+		{5, 1, "Unbalanced braces"},
+	}, report.Warnings)
+
+	_, err = ConvertChunked(strings.NewReader("a\n\nb $x"), &out, Options{Strict: true}, 2)
+	assert.Equal(t, "3:3: Unterminated math", err.Error())
+}
+
+func TestConvertChunkedNeedsChunkableOptions(t *testing.T) {
+	for _, options := range []Options{{NumberEquations: true}, {Headings: true}, {Slides: true}} {
+		_, err := ConvertChunked(strings.NewReader(""), &bytes.Buffer{}, options, 0)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+)
+
+// Handling of the TeX conditionals authors use to disable parts of a document:
+//
+//      \iffalse ... \fi
+//      \iftrue ... \else ... \fi
+//      \ifdefined\foo ... \else ... \fi
+//
+// \ifdefined is true if the macro is defined with \newcommand or \def in the
+// document before it. With Options.Conditionals "drop" only the branch that
+// is true is emitted, with "keep" both are. Other conditionals are wrapped as
+// usual, as is \ifdefined on a macro the document does not define.
+
+func init() {
+	commandConverters["iffalse"] = (*Converter).convertConditional
+	commandConverters["iftrue"] = (*Converter).convertConditional
+	commandConverters["ifdefined"] = (*Converter).convertConditional
+}
+
+func (c *Converter) convertConditional() bool {
+	mode := c.options.Conditionals
+	if mode != "drop" && mode != "keep" {
+		return false
+	}
+
+	start := c.cursor
+	condition := c.commandName()
+	c.skipCommandName()
+
+	value := condition == "iftrue"
+	if condition == "ifdefined" {
+		// Macros of LaTeX itself or of packages are not known, conditionals
+		// on them are wrapped
+		macro := c.commandName()
+		value = c.doc.defined["\\"+macro]
+		if macro == "" || (mode == "drop" && !value) {
+			c.cursor = start
+			return false
+		}
+		c.skipCommandName()
+	}
+
+	then, otherwise, ok := c.readConditionalBranches()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	if mode == "keep" {
+		c.emit(c.convertFragment(then + otherwise))
+	} else if value {
+		c.emit(c.convertFragment(then))
+	} else {
+		c.emit(c.convertFragment(otherwise))
+	}
+	return true
+}
+
+// Reads up to the matching \fi, returning the text before and after \else
+func (c *Converter) readConditionalBranches() (string, string, bool) {
+	start := c.cursor
+	elseStart, elseEnd := -1, -1
+	nesting := 1
+
+	for !c.atEof() {
+		name := c.commandName()
+		switch {
+		case name == "fi":
+			nesting -= 1
+		case name == "else" && nesting == 1:
+			elseStart = c.cursor
+			elseEnd = c.cursor + len("\\else")
+		case isConditional(name):
+			nesting += 1
+		}
+
+		if nesting == 0 {
+			end := c.cursor
+			c.skipCommandName()
+			if elseStart < 0 {
+				return string(c.in[start:end]), "", true
+			}
+			return string(c.in[start:elseStart]), string(c.in[elseEnd:end]), true
+		}
+
+		if name != "" {
+			c.skipCommandName()
+		} else {
+			c.cursor += 1
+		}
+	}
+
+	c.cursor = start
+	return "", "", false
+}
+
+// Whether |name| is a conditional that needs a matching \fi. \iff is a math
+// symbol and \ifthenelse takes arguments instead.
+func isConditional(name string) bool {
+	return strings.HasPrefix(name, "if") && name != "iff" && name != "ifthenelse"
+}
+
+// Remembers the macros defined with \newcommand, \renewcommand,
+// \providecommand or \def in the LaTeX from |start| to the cursor, for
+// \ifdefined
+func (c *Converter) recordDefinitions(start int) {
+	if c.options.Conditionals != "drop" {
+		return
+	}
+
+	end := c.cursor
+	for i := start; i < end; i++ {
+		if c.in[i] == '\\' {
+			c.cursor = i
+			c.recordDefinition()
+		}
+	}
+	c.cursor = end
+}
+
+func (c *Converter) recordDefinition() {
+	start := c.cursor
+	switch c.commandName() {
+	case "newcommand", "renewcommand", "providecommand", "def":
+		c.skipCommandName()
+		if !c.atEof() && c.current() == "*" {
+			c.cursor += 1
+		}
+
+		defined, ok := c.readArgument()
+		if !ok {
+			defined = "\\" + c.commandName()
+		}
+		if c.doc.defined == nil {
+			c.doc.defined = map[string]bool{}
+		}
+		c.doc.defined[strings.TrimSpace(defined)] = true
+	}
+	c.cursor = start
+}
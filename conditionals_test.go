@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConditionals(t *testing.T) {
+	drop := Options{Conditionals: "drop"}
+	keep := Options{Conditionals: "keep"}
+
+	input := "A\\iffalse B $x$\\fi C"
+	assert.Equal(t, "A<!--\\iffalse--> B <!--$x$--><!--\\fi--> C", convertWithOptions(input, Options{}))
+	assert.Equal(t, "A C", convertWithOptions(input, drop))
+	assert.Equal(t, "A B <!--$x$--> C", convertWithOptions(input, keep))
+
+	input = "\\iftrue yes\\else no\\fi"
+	assert.Equal(t, " yes", convertWithOptions(input, drop))
+	assert.Equal(t, " yes no", convertWithOptions(input, keep))
+
+	// Nested conditionals and \iff in math
+	input = "\\iffalse \\ifx\\a\\b x\\fi $a \\iff b$ \\else kept\\fi"
+	assert.Equal(t, " kept", convertWithOptions(input, drop))
+}
+
+func TestIfdefined(t *testing.T) {
+	drop := Options{Conditionals: "drop"}
+
+	input := "\\newcommand{\\foo}{bar}\\ifdefined\\foo defined\\else undefined\\fi"
+	assert.Equal(t, "<!--\\newcommand{\\foo}{bar}--> defined", convertWithOptions(input, drop))
+
+	// Other macros may be defined by LaTeX or a package
+	input = "\\def\\foobar{x}\\ifdefined\\foo defined\\else undefined\\fi"
+	assert.Equal(t, "<!--\\def\\foobar{x}--><!--\\ifdefined\\foo--> defined<!--\\else--> undefined<!--\\fi-->", convertWithOptions(input, drop))
+	assert.Equal(t, "<!--\\ifdefined\\section--> x<!--\\fi-->", convertWithOptions("\\ifdefined\\section x\\fi", drop))
+
+	// Only definitions before count
+	input = "\\ifdefined\\foo a\\fi\\def\\foo{x}\\ifdefined\\foo b\\fi"
+	assert.Equal(t, "<!--\\ifdefined\\foo--> a<!--\\fi\\def\\foo{x}--> b", convertWithOptions(input, drop))
+
+	// Either way both branches are kept
+	input = "\\ifdefined\\foo a\\else b\\fi"
+	assert.Equal(t, " a b", convertWithOptions(input, Options{Conditionals: "keep"}))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The configuration of a project, defaults for the conversion options of
+// all files converted in it, in .merkderwn.yml in the working directory or
+// one of its parents:
+//
+//	extends: pandoc
+//	unicode-math: true
+//	disable: [floats]
+//
+// Keys are the same as in the front matter (see frontmatter.go), extends
+// gives presets or other configurations, relative to this one, which are
+// applied first, e.g. a configuration shared by several projects:
+//
+//	extends: [../shared/merkderwn.yml, slides]
+//
+// Options given on the command line add to the configuration, the front
+// matter of a file overrides both.
+
+// The name of the configuration of a project
+const configName = ".merkderwn.yml"
+
+// Returns the path of the configuration for the directory |dir|, the first
+// one found in it or its parents, or "" if there is none
+func findConfig(dir string) string {
+	for {
+		path := filepath.Join(dir, configName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Returns the configuration given with -config in |args|, or the one found
+// for the working directory. -config= disables it.
+func configPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		} else if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		} else if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return findConfig(dir)
+}
+
+// Returns |options| with the configuration at |path| applied, and the
+// paths of the configurations read, the extended ones first
+func loadConfig(path string, options Options) (Options, []string, error) {
+	var read []string
+	options, err := loadConfigs(filepath.Clean(path), options, nil, &read)
+	return options, read, err
+}
+
+// Same as loadConfig for the configuration at |path| extended by the ones
+// at |extending|, appending the paths read to |read|
+func loadConfigs(path string, options Options, extending []string, read *[]string) (Options, error) {
+	for _, other := range extending {
+		if other == path {
+			return options, fmt.Errorf("%s extends itself", path)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return options, fmt.Errorf("Could not read configuration %s", path)
+	}
+	settings, err := parseSettings(strings.Split(string(content), "\n"), path)
+	if err != nil {
+		return options, err
+	}
+
+	for _, setting := range settings {
+		if setting.key != "extends" {
+			continue
+		}
+		for _, base := range setting.values {
+			if _, ok := presets[base]; ok {
+				applyPreset(base, &options)
+				continue
+			}
+			if !filepath.IsAbs(base) {
+				base = filepath.Join(filepath.Dir(path), base)
+			}
+			if options, err = loadConfigs(base, options, append(extending, path), read); err != nil {
+				return options, err
+			}
+		}
+	}
+
+	*read = append(*read, path)
+	return applySettings(settings, options, path, "extends")
+}
+
+// Runs the config command with |args|, returns the exit code
+func configCommand(args []string) int {
+	var options Options
+	path := configPath(args)
+	var read []string
+	if path != "" {
+		var err error
+		if options, read, err = loadConfig(path, options); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	flags.String("config", path, "read the configuration from this file instead of "+configName+" (empty for none)")
+	conversionFlags(flags, &options)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config show [options]\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "show" {
+		flags.Usage()
+		return 1
+	}
+	flags.Parse(args[1:])
+	if err := options.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Print(showConfig(options, read))
+	return 0
+}
+
+// Formats |options| as a configuration, read from the configurations at
+// |read|
+func showConfig(options Options, read []string) string {
+	var config strings.Builder
+	if len(read) > 0 {
+		fmt.Fprintf(&config, "# Read from %s\n", strings.Join(read, ", "))
+	}
+
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	conversionFlags(flags, &options)
+	var names []string
+	flags.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	sort.Strings(names)
+	for _, name := range names {
+		value := flags.Lookup(name).Value.String()
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(&config, "%s: %s\n", name, value)
+	}
+	return config.String()
+}
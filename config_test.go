@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	project := filepath.Join(dir, "project")
+	assert.Nil(t, os.MkdirAll(filepath.Join(project, "chapters"), 0755))
+
+	shared := filepath.Join(dir, "shared.yml")
+	assert.Nil(t, ioutil.WriteFile(shared, []byte("extends: pandoc\nwrap: drop\nunicode-math: true\n"), 0644))
+	config := filepath.Join(project, configName)
+	assert.Nil(t, ioutil.WriteFile(config, []byte("# The book\nextends: [../shared.yml, anki]\nunicode-math: false\ndisable:\n  - floats\n"), 0644))
+
+	assert.Equal(t, config, findConfig(filepath.Join(project, "chapters")))
+	assert.Equal(t, "", findConfig(dir))
+
+	options, read, err := loadConfig(config, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{shared, config}, read)
+	assert.True(t, options.Headings)
+	assert.Equal(t, "drop", options.Wrap)
+	assert.Equal(t, "latex", options.MathDelimiters)
+	assert.False(t, options.UnicodeMath)
+	assert.False(t, options.Floats)
+
+	// The configuration of a project is shown as one
+	shown := showConfig(options, read)
+	assert.True(t, strings.HasPrefix(shown, "# Read from "+shared+", "+config+"\n"), shown)
+	assert.Contains(t, shown, "\nheadings: true\n")
+	assert.Contains(t, shown, "\nfloats: false\n")
+	assert.Contains(t, shown, "\nslugs: \"\"\n")
+	assert.Nil(t, ioutil.WriteFile(config, []byte(shown), 0644))
+	reread, _, err := loadConfig(config, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, options, reread)
+
+	assert.Nil(t, ioutil.WriteFile(shared, []byte("extends: project/"+configName+"\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(config, []byte("extends: ../shared.yml\n"), 0644))
+	_, _, err = loadConfig(config, Options{})
+	if assert.Error(t, err) {
+		assert.Equal(t, config+" extends itself", err.Error())
+	}
+
+	assert.Nil(t, ioutil.WriteFile(config, []byte("math-passthrough: maybe\n"), 0644))
+	_, _, err = loadConfig(config, Options{})
+	if assert.Error(t, err) {
+		assert.Equal(t, "Invalid value maybe for math-passthrough in "+config, err.Error())
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	assert.Equal(t, "a.yml", configPath([]string{"-links", "-config", "a.yml", "notes.xmd"}))
+	assert.Equal(t, "a.yml", configPath([]string{"--config=a.yml"}))
+	assert.Equal(t, "", configPath([]string{"-config="}))
+}
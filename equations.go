@@ -0,0 +1,224 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Equation numbering for math passed through to MathJax. MathJax numbers
+// equations itself but knows nothing about subequations, so their rows are
+// tagged explicitly (1a, 1b, ...). From then on MathJax's counter is off and
+// all following equations are tagged explicitly as well.
+//
+// Rows with \tag, \nonumber or \notag are left alone. The numbers of labeled
+// rows are remembered, using the custom \tag where there is one.
+//
+// With Options.NumberEquations the numbers are emitted next to the equations
+// instead, see emitMathEnvironment, and a \label of subequations as a whole
+// refers to their common number.
+
+// Environments numbering each row instead of the environment as a whole
+var multiRowEnvironments = map[string]bool{
+	"align": true, "alignat": true, "flalign": true, "gather": true, "eqnarray": true,
+}
+
+func init() {
+	environmentConverters["subequations"] = (*Converter).convertSubequations
+}
+
+// Calls |tag| for every numbered row of the math environment |name| and
+// appends \tag{...} to the row unless it returns "" or the numbers are
+// emitted with Options.NumberEquations. Returns the body and the labels of
+// the rows.
+func (c *Converter) numberRows(name, body string, tag func(labeled bool) string) (string, []string) {
+	name = strings.TrimSpace(name)
+	if strings.HasSuffix(name, "*") || name == "displaymath" {
+		return body, nil
+	}
+
+	rows := []string{body}
+	if multiRowEnvironments[name] {
+		rows = splitRows(body)
+	}
+
+	var labels []string
+	for i, row := range rows {
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
+
+		label, labeled := commandArgument(row, "label")
+		if customTag, ok := commandArgument(row, "tag"); ok {
+			if labeled {
+				c.setLabel(label, customTag, "equation")
+				labels = append(labels, strings.TrimSpace(label))
+			}
+			continue
+		}
+		if !isNumberedRow(row) {
+			continue
+		}
+
+		t := tag(labeled)
+		if t != "" && !c.options.NumberEquations {
+			trimmed := strings.TrimRight(row, " \t\n")
+			rows[i] = trimmed + " \\tag{" + t + "}" + row[len(trimmed):]
+		} else if t == "" {
+			t = strconv.Itoa(c.doc.equations)
+		}
+		if labeled {
+			c.setLabel(label, t, "equation")
+			labels = append(labels, strings.TrimSpace(label))
+		}
+	}
+	return strings.Join(rows, "\\\\"), labels
+}
+
+// Counts the equation and returns an explicit tag if needed. With
+// Options.NumberEquations only labeled equations are counted.
+func (c *Converter) nextEquationTag(labeled bool) string {
+	if c.options.NumberEquations && !labeled {
+		return ""
+	}
+
+	c.doc.equations += 1
+	if c.doc.explicitTags && !c.options.NumberEquations {
+		return strconv.Itoa(c.doc.equations)
+	}
+	return ""
+}
+
+func isNumberedRow(row string) bool {
+	for _, command := range []string{"nonumber", "notag", "tag"} {
+		if _, ok := commandPosition(row, command); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the position of the first \name in |tex|
+func commandPosition(tex, name string) (int, bool) {
+	c := ByteArrayToConverter([]byte(tex))
+	for ; c.skipTo("\\"); c.cursor++ {
+		if c.commandName() == name {
+			return c.cursor, true
+		}
+	}
+	return 0, false
+}
+
+// Splits the body of a math environment at "\\" unless it is inside a group or
+// a nested environment
+func splitRows(body string) []string {
+	var rows []string
+	c := ByteArrayToConverter([]byte(body))
+	rowStart := 0
+
+	for !c.atEof() {
+		if c.environmentName() != "" {
+			if _, ok := c.readEnvironment(); ok {
+				continue
+			}
+		}
+		if _, ok := c.readArgument(); ok {
+			continue
+		}
+
+		if c.current() == "\\" && c.lookahead(1) == "\\" {
+			rows = append(rows, string(c.in[rowStart:c.cursor]))
+			c.cursor += 2
+			rowStart = c.cursor
+		} else if c.current() == "\\" {
+			c.cursor += 2
+		} else {
+			c.cursor += 1
+		}
+	}
+	if rowStart > c.inputLength {
+		rowStart = c.inputLength
+	}
+	return append(rows, string(c.in[rowStart:]))
+}
+
+// \begin{subequations} is dropped, the equations inside are tagged 1a, 1b, ...
+func (c *Converter) convertSubequations() bool {
+	if !c.options.MathPassthrough && !c.options.NumberEquations {
+		return false
+	}
+
+	start := c.cursor
+	body, ok := c.readEnvironment()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	// Only labeled equations are counted with Options.NumberEquations
+	number := c.doc.equations + 1
+	letter := 0
+	tag := func(labeled bool) string {
+		if c.options.NumberEquations && !labeled {
+			return ""
+		}
+		letter += 1
+		return strconv.Itoa(number) + subequationLetter(letter)
+	}
+
+	labeled := false
+	emitText := func(text string) {
+		if label, ok := commandArgument(text, "label"); ok && c.options.NumberEquations {
+			c.setLabel(label, strconv.Itoa(number), "equation")
+			c.emit("<a id=\"" + c.doc.labels[strings.TrimSpace(label)].anchor + "\"></a>")
+			text = removeCommand(text, "label")
+			labeled = true
+		}
+		c.emit(c.convertFragment(text))
+	}
+
+	s := ByteArrayToConverter([]byte(body))
+	textStart := 0
+	for !s.atEof() {
+		name := strings.TrimSuffix(s.environmentName(), "*")
+		if !isDisplayMathEnvironment(name) {
+			s.cursor += 1
+			continue
+		}
+
+		emitText(string(s.in[textStart:s.cursor]))
+		name = s.environmentName()
+		equation, ok := s.readEnvironment()
+		if !ok {
+			s.cursor += 1
+			continue
+		}
+		c.emitMathEnvironment(name, equation, tag)
+		textStart = s.cursor
+	}
+	emitText(string(s.in[textStart:]))
+
+	if c.options.NumberEquations && letter == 0 && !labeled {
+		return true
+	}
+	c.doc.equations = number
+	c.doc.explicitTags = true
+	return true
+}
+
+// Returns the letter of the |n|th subequation: a to z, then aa, ab, ...
+func subequationLetter(n int) string {
+	letters := ""
+	for ; n > 0; n = (n - 1) / 26 {
+		letters = string(rune('a'+(n-1)%26)) + letters
+	}
+	return letters
+}
+
+func isDisplayMathEnvironment(name string) bool {
+	for _, environment := range displayMathEnvironments {
+		if name == environment {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSplitRows(t *testing.T) {
+	rows := splitRows("a \\\\ b = \\begin{cases} 1 \\\\ 2 \\end{cases} \\\\ {c \\\\ d}")
+	assert.Equal(t, []string{"a ", " b = \\begin{cases} 1 \\\\ 2 \\end{cases} ", " {c \\\\ d}"}, rows)
+}
+
+func TestSubequations(t *testing.T) {
+	passthrough := Options{MathPassthrough: true}
+
+	input := `\begin{equation} x \end{equation}
+\begin{subequations}
+Text $y$
+\begin{align}
+a &= 1 \\
+b &= 2 \nonumber \\
+c &= 3
+\end{align}
+\end{subequations}
+\begin{equation} z \end{equation}
+\begin{equation*} w \end{equation*}`
+	expected := `\begin{equation} x \end{equation}
+
+Text $y$
+\begin{align}
+a &= 1 \tag{2a} \\
+b &= 2 \nonumber \\
+c &= 3 \tag{2b}
+\end{align}
+
+\begin{equation} z \tag{3} \end{equation}
+\begin{equation*} w \end{equation*}`
+	assert.Equal(t, expected, convertWithOptions(input, passthrough))
+
+	// Wrapped as a whole without passthrough
+	input = "\\begin{subequations}\\begin{equation}x\\end{equation}\\end{subequations}"
+	assert.Equal(t, "<!--"+input+"-->", convertWithOptions(input, Options{}))
+}
+
+func TestCustomTags(t *testing.T) {
+	input := `\begin{align}
+a &= 1 \label{eq:a} \\
+b &= 2 \tag{$\ast$} \label{eq:b} \\
+c &= 3 \notag
+\end{align}
+\begin{subequations}\begin{equation} d \label{eq:d} \end{equation}\end{subequations}
+\begin{equation} e \tag{E} \end{equation}
+\begin{equation} f \label{eq:f} \end{equation}`
+
+	c := NewConverter([]byte(input), Options{MathPassthrough: true})
+	output := string(c.Convert())
+
+	assert.Contains(t, output, "b &= 2 \\tag{$\\ast$} \\label{eq:b} \\\\")
+	assert.Contains(t, output, "c &= 3 \\notag\n")
+	assert.Contains(t, output, "\\begin{equation} e \\tag{E} \\end{equation}")
+	assert.Contains(t, output, "\\begin{equation} f \\label{eq:f} \\tag{3} \\end{equation}")
+	numbers := map[string]string{}
+	for name, l := range c.doc.labels {
+		numbers[name] = l.number
+	}
+	assert.Equal(t, map[string]string{"eq:a": "1", "eq:b": "$\\ast$", "eq:d": "2a", "eq:f": "3"}, numbers)
+}
+
+func TestEquationNumbering(t *testing.T) {
+	numbering := Options{NumberEquations: true, MathPassthrough: true}
+
+	input := `See \eqref{eq:b} and \ref{eq:missing}.
+\begin{equation} x \end{equation}
+\begin{equation} a \label{eq:a} \end{equation}
+\begin{align} b \label{eq:b} \\ c \end{align}
+By \autoref{eq:a}.`
+	expected := `See [(2)](#eq:b) and <!--\ref{eq:missing}-->.
+\begin{equation} x \end{equation}
+<a id="eq:a"></a><span class="equation-number" style="float: right">(1)</span>
+\begin{equation*} a \label{eq:a} \end{equation*}
+<a id="eq:b"></a><span class="equation-number" style="float: right">(2)</span>
+\begin{align*} b \label{eq:b} \\ c \end{align*}
+By [Equation 1](#eq:a).`
+	assert.Equal(t, expected, convertWithOptions(input, numbering))
+
+	// References are wrapped as before without numbering
+	assert.Equal(t, "<!--\\ref{eq:a}-->", convertWithOptions("\\ref{eq:a}", Options{MathPassthrough: true}))
+}
+
+func TestSubequationNumbering(t *testing.T) {
+	input := `See \ref{eq:g} and \eqref{eq:b}.
+\begin{subequations}\label{eq:g}
+\begin{align}
+a &= 1 \\
+b &= 2 \label{eq:b}
+\end{align}
+\end{subequations}`
+	expected := `See [2](#eq:g) and [(2a)](#eq:b).
+<a id="eq:g"></a>
+<a id="eq:b"></a><span class="equation-number" style="float: right">(2a)</span>
+`
+	math := `\begin{align*}
+a &= 1 \\
+b &= 2 \label{eq:b}
+\end{align*}`
+
+	// The first equation is 1
+	input = "\\begin{equation} x \\label{eq:x} \\end{equation}" + input
+	prefix := `<a id="eq:x"></a><span class="equation-number" style="float: right">(1)</span>
+`
+	assert.Equal(t, prefix+"\\begin{equation*} x \\label{eq:x} \\end{equation*}"+expected+math+"\n", convertWithOptions(input, Options{NumberEquations: true, MathPassthrough: true}))
+	assert.Equal(t, prefix+"<!--\\begin{equation*} x \\label{eq:x} \\end{equation*}-->"+expected+"<!--"+math+"-->\n", convertWithOptions(input, Options{NumberEquations: true}))
+}
+
+func TestSubequationLetters(t *testing.T) {
+	assert.Equal(t, "a", subequationLetter(1))
+	assert.Equal(t, "z", subequationLetter(26))
+	assert.Equal(t, "aa", subequationLetter(27))
+	assert.Equal(t, "ab", subequationLetter(28))
+	assert.Equal(t, "ba", subequationLetter(53))
+}
+
+func TestFigureReferences(t *testing.T) {
+	input := "\\autoref{fig:a}\n\\begin{figure}\\includegraphics{a.png}\\label{fig:a}\\end{figure}"
+	expected := "[Figure 1](#fig:a)\n<a id=\"fig:a\"></a>\n![](a.png)"
+	assert.Equal(t, expected, convertWithOptions(input, Options{NumberEquations: true, Floats: true}))
+}
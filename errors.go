@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Problems with the input. The conversion carries on regardless, they are
+// reported as warnings and, with Options.Strict, returned by Convert as a
+// *PositionError, e.g.
+//
+//	if errors.Is(err, ErrUnterminatedMath) { ... }
+var (
+	ErrUnterminatedMath = errors.New("Unterminated math")
+	ErrUnbalancedBraces = errors.New("Unbalanced braces")
+	ErrInvalidUTF8      = errors.New("Invalid UTF-8")
+	ErrRenderMath       = errors.New("Could not render math")
+)
+
+// Input which is binary, e.g. a PDF matched by a glob, is not converted at
+// all. Convert returns ErrBinaryInput as a *PositionError at its first NUL
+// byte, which text never has, looked for at the start like git does.
+var ErrBinaryInput = errors.New("Binary input, not converting it")
+
+// Binary input is recognized by a NUL byte in this many bytes at its start
+const binarySniffSize = 8000
+
+// A position in the input. Offset is in bytes, lines and columns start at 1
+// and columns count characters.
+type Position struct {
+	Offset, Line, Column int
+}
+
+// One of the errors above at the position of the input it occurred at
+type PositionError struct {
+	Err      error
+	Position Position
+}
+
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Position.Line, e.Position.Column, e.Err)
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
+
+// Records |err| at |position| (a byte offset into the input). Positions
+// are only known for the top level document, not for fragments.
+func (c *Converter) problem(position int, err error) {
+	if c.fragment {
+		return
+	}
+
+	p := c.position(position)
+	c.doc.problems = append(c.doc.problems, &PositionError{err, p})
+	c.warnAt(p.Line, p.Column, "%s", err)
+}
+
+// Returns the Position of the character at |position| (a byte offset)
+func (c *Converter) position(position int) Position {
+	// Positions are mostly asked for in order, e.g. when logging, so
+	// counting starts at the last one
+	p := Position{0, 1, 1}
+	if c.lastPosition.Line > 0 && c.lastPosition.Offset <= position {
+		p = c.lastPosition
+	}
+
+	for _, b := range c.in[p.Offset:position] {
+		if b == '\n' {
+			p.Line, p.Column = p.Line+1, 1
+		} else if utf8.RuneStart(b) {
+			p.Column += 1
+		}
+	}
+	p.Offset = position
+	c.lastPosition = p
+
+	return Position{c.doc.offset + position, c.doc.line + p.Line, p.Column}
+}
+
+// Returns the position of the first invalid byte of |in|, if there is one
+func invalidUTF8(in []byte) (Position, bool) {
+	if utf8.Valid(in) {
+		return Position{}, false
+	}
+
+	p := Position{0, 1, 1}
+	for p.Offset < len(in) {
+		r, size := utf8.DecodeRune(in[p.Offset:])
+		if r == utf8.RuneError && size <= 1 {
+			return p, true
+		}
+
+		p.Offset += size
+		if r == '\n' {
+			p.Line, p.Column = p.Line+1, 1
+		} else {
+			p.Column += 1
+		}
+	}
+	return p, false
+}
+
+// Returns ErrBinaryInput at the first NUL byte at the start of |in|, or nil
+// if it has none
+func binaryInput(in []byte) error {
+	head := in
+	if len(head) > binarySniffSize {
+		head = head[:binarySniffSize]
+	}
+	i := bytes.IndexByte(head, 0)
+	if i < 0 {
+		return nil
+	}
+
+	p := Position{i, 1 + bytes.Count(in[:i], []byte("\n")), 1}
+	p.Column += utf8.RuneCount(in[bytes.LastIndexByte(in[:i], '\n')+1 : i])
+	return &PositionError{ErrBinaryInput, p}
+}
+
+// Returns |in| with each invalid byte from |offset| on (the first one)
+// replaced by U+FFFD, in a single pass over it
+func replaceInvalidUTF8(in []byte, offset int) []byte {
+	out := make([]byte, offset, len(in)+utf8.UTFMax)
+	copy(out, in[:offset])
+
+	for i := offset; i < len(in); {
+		r, size := utf8.DecodeRune(in[i:])
+		if r == utf8.RuneError && size <= 1 {
+			out = append(out, "\uFFFD"...)
+		} else {
+			out = append(out, in[i:i+size]...)
+		}
+		i += size
+	}
+	return out
+}
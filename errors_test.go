@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUnterminatedMathError(t *testing.T) {
+	_, report, err := Convert([]byte("ä\n  $x"), Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Warning{{2, 3, "Unterminated math"}}, report.Warnings)
+
+	_, _, err = Convert([]byte("ä\n  $x"), Options{Strict: true})
+	assert.True(t, errors.Is(err, ErrUnterminatedMath))
+	var positionError *PositionError
+	assert.True(t, errors.As(err, &positionError))
+	assert.Equal(t, Position{Offset: 5, Line: 2, Column: 3}, positionError.Position)
+	assert.Equal(t, "2:3: Unterminated math", err.Error())
+
+	_, _, err = Convert([]byte("$$x$"), Options{Strict: true})
+	assert.True(t, errors.Is(err, ErrUnterminatedMath))
+}
+
+func TestUnbalancedBraces(t *testing.T) {
+	_, _, err := Convert([]byte("a \\foo{bar"), Options{Strict: true})
+	assert.True(t, errors.Is(err, ErrUnbalancedBraces))
+	assert.Equal(t, "1:3: Unbalanced braces", err.Error())
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	out, _, err := Convert([]byte("ok\nb\xffd"), Options{Strict: true})
+	assert.Nil(t, out)
+	assert.True(t, errors.Is(err, ErrInvalidUTF8))
+	assert.Equal(t, "2:2: Invalid UTF-8", err.Error())
+
+	_, _, err = Convert([]byte("$x$ and \\foo{ü}"), Options{Strict: true})
+	assert.NoError(t, err)
+}
+
+func TestBinaryInput(t *testing.T) {
+	out, _, err := Convert([]byte("%PDF-1.4\nä\x00\x01"), Options{})
+	assert.Nil(t, out)
+	assert.True(t, errors.Is(err, ErrBinaryInput))
+	assert.Equal(t, "2:2: Binary input, not converting it", err.Error())
+
+	_, _, err = ConvertParallel([]byte("\x00"), Options{}, 2)
+	assert.True(t, errors.Is(err, ErrBinaryInput))
+	var out2 bytes.Buffer
+	_, err = ConvertChunked(strings.NewReader("a\n\nb\x00"), &out2, Options{}, 0)
+	assert.True(t, errors.Is(err, ErrBinaryInput))
+	assert.Empty(t, out2.String())
+	_, err = ConvertChunked(strings.NewReader("a\n\nb\x00"), &out2, Options{}, 2)
+	assert.True(t, errors.Is(err, ErrBinaryInput))
+
+	// Only looked for at the start
+	_, _, err = Convert([]byte(strings.Repeat("a", binarySniffSize)+"\x00"), Options{})
+	assert.NoError(t, err)
+}
+
+func TestReplaceInvalidUTF8(t *testing.T) {
+	for _, in := range []string{"a\xffb", "\xff", "ü\xe2\x82\xffx\xc3", "ok \xff\xfe ä"} {
+		assert.Equal(t, string([]rune(in)), string(replaceInvalidUTF8([]byte(in), strings.IndexRune(in, utf8.RuneError))))
+	}
+}
+
+func TestPositions(t *testing.T) {
+	in := "ab\nüc\n\nd"
+	c := ByteArrayToConverter([]byte(in))
+	for _, offset := range []int{0, 4, 9, 3, 10, 10, 1} {
+		fresh := ByteArrayToConverter([]byte(in))
+		assert.Equal(t, fresh.position(offset), c.position(offset))
+	}
+	assert.Equal(t, Position{5, 2, 2}, c.position(5))
+}
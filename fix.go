@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The fix command, which corrects the most common mistakes in the input
+// instead of converting it:
+//
+//	lone dollar signs          It costs 5$ or more    It costs 5\$ or more
+//	unterminated inline math   where $x + y           where $x + y$
+//	unclosed arguments         \textbf{bold           \textbf{bold}
+//
+// Only mistakes on a single line are fixed: a lone dollar sign (see
+// lintDollar) is escaped, unterminated inline math is closed at the end of
+// its line (or escaped if it is a dollar sign, as in "$5" or "5$") and the
+// arguments of a command opened but not closed on its line are closed at its
+// end. The fixes are printed as a diff unless they are written to the files.
+
+// Fixes are made one after another, the input is converted again after each
+const maxFixes = 1000
+
+// A correction of the input
+type fix struct {
+	// Where |insert| is inserted, a byte offset into the input
+	offset int
+	insert string
+
+	position Position
+	message  string
+}
+
+// Returns |in| with the mistakes fixed, and the fixes in the order they were
+// made
+func fixInput(in []byte) ([]byte, []fix) {
+	var fixes []fix
+	for len(fixes) < maxFixes {
+		f, ok := nextFix(in)
+		if !ok {
+			break
+		}
+		fixes = append(fixes, f)
+
+		fixed := make([]byte, 0, len(in)+len(f.insert))
+		fixed = append(fixed, in[:f.offset]...)
+		fixed = append(fixed, f.insert...)
+		in = append(fixed, in[f.offset:]...)
+	}
+	return in, fixes
+}
+
+// Returns the fix for the first mistake in |in| which can be fixed
+func nextFix(in []byte) (fix, bool) {
+	c := NewConverter(in, Options{})
+	c.Convert()
+
+	mistakes := append([]Position(nil), c.doc.loneDollars...)
+	kinds := map[int]error{}
+	for _, problem := range c.doc.problems {
+		mistakes = append(mistakes, problem.Position)
+		kinds[problem.Position.Offset] = problem.Err
+	}
+	sort.SliceStable(mistakes, func(i, j int) bool { return mistakes[i].Offset < mistakes[j].Offset })
+
+	for _, p := range mistakes {
+		var f fix
+		switch kinds[p.Offset] {
+		case nil:
+			f = fix{offset: p.Offset, insert: "\\", message: "Escaped lone $"}
+		case ErrUnterminatedMath:
+			f = fixUnterminatedMath(in, p.Offset)
+		case ErrUnbalancedBraces:
+			f = fixUnbalancedBraces(in, p.Offset)
+		}
+		if f.message != "" {
+			f.position = p
+			return f, true
+		}
+	}
+	return fix{}, false
+}
+
+// Returns the end of the line at |offset| without trailing spaces
+func lineContentEnd(in []byte, offset int) int {
+	end := len(in)
+	if i := bytes.IndexByte(in[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	return offset + len(bytes.TrimRight(in[offset:end], " \t\r"))
+}
+
+// Closes the inline math starting with the $ at |offset| at the end of its
+// line, or escapes the $ if it is a dollar sign: nothing follows it, or a
+// number is right before or after it, as in "5$" and "$5". Display math is
+// not fixed.
+func fixUnterminatedMath(in []byte, offset int) fix {
+	if offset+1 < len(in) && in[offset+1] == '$' {
+		return fix{}
+	}
+
+	end := lineContentEnd(in, offset)
+	rest := bytes.TrimSpace(in[offset+1 : end])
+	amount := offset > 0 && in[offset-1] >= '0' && in[offset-1] <= '9'
+	if len(rest) == 0 || rest[0] >= '0' && rest[0] <= '9' || amount {
+		return fix{offset: offset, insert: "\\", message: "Escaped lone $"}
+	}
+	return fix{offset: end, insert: "$", message: "Closed inline math at the end of the line"}
+}
+
+// Closes the arguments of the command at |offset| which are opened on its
+// line and not closed after it at its end
+func fixUnbalancedBraces(in []byte, offset int) fix {
+	end := lineContentEnd(in, offset)
+
+	var open []byte
+	for _, b := range in[offset:end] {
+		switch b {
+		case '{', '[':
+			open = append(open, b)
+		case '}', ']':
+			if len(open) == 0 {
+				return fix{}
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) == 0 {
+		return fix{}
+	}
+
+	// Closed on a later line after all
+	depth := len(open)
+	for _, b := range in[end:] {
+		if b == '{' || b == '[' {
+			depth += 1
+		} else if b == '}' || b == ']' {
+			depth -= 1
+		}
+		if depth < len(open) {
+			return fix{}
+		}
+	}
+
+	var closing strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i] == '{' {
+			closing.WriteByte('}')
+		} else {
+			closing.WriteByte(']')
+		}
+	}
+	return fix{offset: end, insert: closing.String(), message: "Closed the arguments at the end of the line"}
+}
+
+// Returns the changed lines of |fixed| as a unified diff to |in|. Fixes do
+// not add lines, so the lines of both correspond.
+func fixDiff(path string, in, fixed []byte) string {
+	before := strings.Split(string(in), "\n")
+	after := strings.Split(string(fixed), "\n")
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", path, path)
+	for i := range before {
+		if before[i] != after[i] {
+			fmt.Fprintf(&diff, "@@ -%d +%d @@\n-%s\n+%s\n", i+1, i+1, before[i], after[i])
+		}
+	}
+	return diff.String()
+}
+
+// Runs the fix command with |args|, returns the exit code
+func fixCommand(args []string) int {
+	flags := flag.NewFlagSet("fix", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the fixes to the files instead of printing them as a diff")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s fix [options] <file to fix> [more files]\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		in, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read input file %s\n", path)
+			failed += 1
+			continue
+		} else if err := binaryInput(in); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", path, err)
+			failed += 1
+			continue
+		}
+
+		fixed, fixes := fixInput(in)
+		for _, f := range fixes {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", path, f.position.Line, f.position.Column, f.message)
+		}
+		if len(fixes) == 0 {
+			continue
+		}
+
+		if !*write {
+			fmt.Print(fixDiff(path, in, fixed))
+		} else if err := ioutil.WriteFile(path, fixed, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write %s\n", path)
+			failed += 1
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFixInput(t *testing.T) {
+	for in, expected := range map[string]string{
+		"It costs 5$ or\nmore, see $x$.":  "It costs 5\\$ or\nmore, see $x$.",
+		"It costs 5$ or more":             "It costs 5\\$ or more",
+		"$z$ and\n\nwhere $x + y":         "$z$ and\n\nwhere $x + y$",
+		"see $x\ny":                       "see $x$\ny",
+		"From $5 on":                      "From \\$5 on",
+		"A \\textbf{bold [x\n\n\\emph{a}": "A \\textbf{bold [x]}\n\n\\emph{a}",
+		"$x$ and \\foo{a}":                "$x$ and \\foo{a}",
+	} {
+		fixed, _ := fixInput([]byte(in))
+		assert.Equal(t, expected, string(fixed), in)
+	}
+
+	// One after another
+	fixed, fixes := fixInput([]byte("a\nIt is 5$\nand $x + y"))
+	assert.Equal(t, "a\nIt is 5\\$\nand $x + y$", string(fixed))
+	if assert.Len(t, fixes, 2) {
+		assert.Equal(t, "Escaped lone $", fixes[0].message)
+		assert.Equal(t, Position{9, 2, 8}, fixes[0].position)
+		assert.Equal(t, "Closed inline math at the end of the line", fixes[1].message)
+	}
+
+	// Not obvious
+	for _, in := range []string{"$$x\n\ny", "\\foo{a\n}{b"} {
+		fixed, _ := fixInput([]byte(in))
+		assert.Equal(t, in, string(fixed), in)
+	}
+}
+
+func TestFixDiff(t *testing.T) {
+	in := "a\nIt costs 5$\nb"
+	fixed, _ := fixInput([]byte(in))
+	assert.Equal(t, "--- a.xmd\n+++ a.xmd\n@@ -2 +2 @@\n-It costs 5$\n+It costs 5\\$\n", fixDiff("a.xmd", []byte(in), fixed))
+}
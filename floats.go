@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Conversion of figure and table environments to Markdown, e.g.
+//
+//      \begin{figure}
+//        \includegraphics{plot.png}
+//        \caption{A plot}\label{fig:plot}
+//      \end{figure}
+//
+// becomes
+//
+//      <a id="fig:plot"></a>
+//      ![A plot](plot.png)
+//
+// Tables become pipe tables followed by a MultiMarkdown caption.
+
+// A converted figure or table
+type float struct {
+	anchor  string
+	caption string
+}
+
+const (
+	listOfFiguresMarker = "\x00listoffigures\x00"
+	listOfTablesMarker  = "\x00listoftables\x00"
+)
+
+func init() {
+	environmentConverters["figure"] = (*Converter).convertFigure
+	environmentConverters["figure*"] = (*Converter).convertFigure
+	environmentConverters["table"] = (*Converter).convertTable
+	environmentConverters["table*"] = (*Converter).convertTable
+	commandConverters["listoffigures"] = (*Converter).convertListOfFloats
+	commandConverters["listoftables"] = (*Converter).convertListOfFloats
+}
+
+func (c *Converter) convertFigure() bool {
+	if !c.options.Floats {
+		return false
+	}
+
+	start := c.cursor
+	body, ok := c.readEnvironment()
+	images := commandArguments(body, "includegraphics")
+	if !ok || len(images) == 0 {
+		c.cursor = start
+		return false
+	}
+
+	anchor, caption := c.floatCaption(body, "figure", c.doc.figuresBefore+len(c.doc.figures)+1)
+	c.doc.figures = append(c.doc.figures, float{anchor, caption})
+	if label, ok := commandArgument(body, "label"); ok {
+		c.setLabel(label, strconv.Itoa(c.doc.figuresBefore+len(c.doc.figures)), "figure")
+	}
+
+	c.emit(fmt.Sprintf("<a id=\"%s\"></a>\n", anchor))
+	for i, image := range images {
+		if i > 0 {
+			c.emit("\n")
+		}
+		c.emit(fmt.Sprintf("![%s](%s)", caption, c.imagePath(strings.TrimSpace(image))))
+	}
+	return true
+}
+
+func (c *Converter) convertTable() bool {
+	if !c.options.Floats {
+		return false
+	}
+
+	start := c.cursor
+	body, ok := c.readEnvironment()
+	table, found := c.convertTabular(body)
+	if !ok || !found {
+		c.cursor = start
+		return false
+	}
+
+	anchor, caption := c.floatCaption(body, "table", c.doc.tablesBefore+len(c.doc.tables)+1)
+	c.doc.tables = append(c.doc.tables, float{anchor, caption})
+	if label, ok := commandArgument(body, "label"); ok {
+		c.setLabel(label, strconv.Itoa(c.doc.tablesBefore+len(c.doc.tables)), "table")
+	}
+
+	c.emit(fmt.Sprintf("<a id=\"%s\"></a>\n\n", anchor))
+	c.emit(table)
+	if caption != "" {
+		c.emit("[" + caption + "]\n")
+	}
+	return true
+}
+
+// Returns the anchor (the \label or one generated for the |n|th float of
+// |kind|) and the converted caption
+func (c *Converter) floatCaption(body, kind string, n int) (string, string) {
+	var anchor string
+	if label, ok := commandArgument(body, "label"); ok {
+		anchor = strings.TrimSpace(label)
+	} else {
+		anchor = c.generatedAnchor(kind, n, body)
+	}
+
+	caption, _ := commandArgument(body, "caption")
+	caption = removeCommand(caption, "label")
+	return anchor, strings.TrimSpace(c.convertFragment(caption))
+}
+
+// Converts the first tabular inside |body| to a pipe table
+func (c *Converter) convertTabular(body string) (string, bool) {
+	tabular, ok := environmentBody(body, "tabular")
+	if !ok {
+		return "", false
+	}
+
+	t := ByteArrayToConverter([]byte(tabular))
+	t.readOptionalArgument()
+	spec, _ := t.readArgument()
+	tabular = string(t.in[t.cursor:])
+
+	var rows [][]string
+	for _, row := range splitOutsideGroups(tabular, "\\\\") {
+		for _, rule := range []string{"hline", "toprule", "midrule", "bottomrule", "cline"} {
+			row = removeCommand(row, rule)
+		}
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
+
+		var cells []string
+		for _, cell := range splitOutsideGroups(row, "&") {
+			cell = strings.TrimSpace(c.convertFragment(strings.TrimSpace(cell)))
+			cells = append(cells, strings.Replace(cell, "|", "\\|", -1))
+		}
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return "", false
+	}
+
+	var table bytes.Buffer
+	for i, row := range rows {
+		table.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			table.WriteString(tableAlignmentRow(spec, len(row)))
+		}
+	}
+	return table.String(), true
+}
+
+// Translates a column spec like "l|cr" to a pipe table separator row
+func tableAlignmentRow(spec string, columns int) string {
+	var alignments []string
+	for _, column := range removeGroups(spec) {
+		switch column {
+		case 'l':
+			alignments = append(alignments, ":--")
+		case 'c':
+			alignments = append(alignments, ":-:")
+		case 'r':
+			alignments = append(alignments, "--:")
+		case 'p', 'm', 'b', 'X':
+			alignments = append(alignments, "---")
+		}
+	}
+	for len(alignments) < columns {
+		alignments = append(alignments, "---")
+	}
+	return "|" + strings.Join(alignments[:columns], "|") + "|\n"
+}
+
+// Replaces \listoffigures and \listoftables with a marker which is replaced by
+// the actual list once all figures and tables are known.
+func (c *Converter) convertListOfFloats() bool {
+	if !c.options.Floats || !c.options.ListOfFloats {
+		return false
+	}
+
+	if c.commandName() == "listoffigures" {
+		c.emit(listOfFiguresMarker)
+	} else {
+		c.emit(listOfTablesMarker)
+	}
+	c.skipCommandName()
+	return true
+}
+
+func (c *Converter) insertListsOfFloats() {
+	if !c.options.ListOfFloats {
+		return
+	}
+
+	out := c.out.Bytes()
+	out = bytes.Replace(out, []byte(listOfFiguresMarker), []byte(listOfFloats("Figure", c.doc.figures)), -1)
+	out = bytes.Replace(out, []byte(listOfTablesMarker), []byte(listOfFloats("Table", c.doc.tables)), -1)
+	c.out = bytes.NewBuffer(out)
+}
+
+func listOfFloats(kind string, floats []float) string {
+	var list bytes.Buffer
+	for i, f := range floats {
+		title := fmt.Sprintf("%s %d", kind, i+1)
+		if f.caption != "" {
+			title += ": " + f.caption
+		}
+		list.WriteString(fmt.Sprintf("- [%s](#%s)\n", title, f.anchor))
+	}
+	return strings.TrimSuffix(list.String(), "\n")
+}
+
+/* Helpers for picking apart LaTeX fragments */
+
+// Returns the mandatory arguments of all \name[...]{argument} in |tex|
+func commandArguments(tex, name string) []string {
+	var arguments []string
+	c := ByteArrayToConverter([]byte(tex))
+	for c.skipTo("\\") {
+		if c.commandName() != name {
+			c.cursor += 1
+			continue
+		}
+
+		c.skipCommandName()
+		for {
+			if _, ok := c.readOptionalArgument(); !ok {
+				break
+			}
+		}
+		if argument, ok := c.readArgument(); ok {
+			arguments = append(arguments, argument)
+		}
+	}
+	return arguments
+}
+
+// Returns the argument of the first \name[...]{argument} in |tex|
+func commandArgument(tex, name string) (string, bool) {
+	arguments := commandArguments(tex, name)
+	if len(arguments) == 0 {
+		return "", false
+	}
+	return arguments[0], true
+}
+
+// Removes all \name[...]{...} from |tex|
+func removeCommand(tex, name string) string {
+	var result bytes.Buffer
+	c := ByteArrayToConverter([]byte(tex))
+	for !c.atEof() {
+		if c.commandName() != name {
+			result.WriteString(c.current())
+			c.cursor += 1
+			continue
+		}
+
+		c.skipCommandName()
+		for {
+			_, optional := c.readOptionalArgument()
+			_, mandatory := c.readArgument()
+			if !optional && !mandatory {
+				break
+			}
+		}
+	}
+	return result.String()
+}
+
+// Returns the body of the first \begin{name} ... \end{name} in |tex|
+func environmentBody(tex, name string) (string, bool) {
+	c := ByteArrayToConverter([]byte(tex))
+	for !c.atEof() {
+		if c.environmentName() == name {
+			return c.readEnvironment()
+		}
+		c.cursor += 1
+	}
+	return "", false
+}
+
+// Splits |tex| at |separator| unless it is inside a {group} or escaped
+func splitOutsideGroups(tex, separator string) []string {
+	var parts []string
+	runes := []rune(tex)
+	sep := []rune(separator)
+	nesting, start := 0, 0
+
+	for i := 0; i < len(runes); i++ {
+		if nesting == 0 && i+len(sep) <= len(runes) && string(runes[i:i+len(sep)]) == separator {
+			parts = append(parts, string(runes[start:i]))
+			i += len(sep) - 1
+			start = i + 1
+			continue
+		}
+
+		switch runes[i] {
+		case '\\':
+			i += 1
+		case '{':
+			nesting += 1
+		case '}':
+			nesting -= 1
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
+
+// Removes all {groups} from |tex|, e.g. "p{3cm}l" becomes "pl"
+func removeGroups(tex string) string {
+	var result bytes.Buffer
+	c := ByteArrayToConverter([]byte(tex))
+	for !c.atEof() {
+		if _, ok := c.readArgument(); ok {
+			continue
+		}
+		result.WriteString(c.current())
+		c.cursor += 1
+	}
+	return result.String()
+}
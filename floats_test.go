@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFiguresAreWrappedByDefault(t *testing.T) {
+	input := "\\begin{figure}\\includegraphics{a.png}\\end{figure}"
+	assert.Equal(t, "<!--"+input+"-->", convertWithOptions(input, Options{}))
+}
+
+func TestFigureConversion(t *testing.T) {
+	input := `\begin{figure}[ht]
+  \centering
+  \includegraphics[width=\linewidth]{plots/speed.png}
+  \caption{Speed over $t$\label{fig:speed}}
+\end{figure}`
+	expected := "<a id=\"fig:speed\"></a>\n![Speed over <!--$t$-->](plots/speed.png)"
+	assert.Equal(t, expected, convertWithOptions(input, Options{Floats: true}))
+
+	// No image, nothing to convert
+	input = "\\begin{figure}\\begin{tikzpicture}\\end{tikzpicture}\\end{figure}"
+	assert.Equal(t, "<!--"+input+"-->", convertWithOptions(input, Options{Floats: true}))
+}
+
+func TestTableConversion(t *testing.T) {
+	input := `\begin{table}
+  \begin{tabular}{l|r}
+    \hline
+    Name & Value \\ \hline
+    a \& b & 1 \\
+    $x|y$ & 2 \\
+    \hline
+  \end{tabular}
+  \caption{Values}
+  \label{tab:values}
+\end{table}`
+	expected := "<a id=\"tab:values\"></a>\n\n" +
+		"| Name | Value |\n" +
+		"|:--|--:|\n" +
+		"| a <!--\\&--> b | 1 |\n" +
+		"| <!--$x\\|y$--> | 2 |\n" +
+		"[Values]\n"
+	assert.Equal(t, expected, convertWithOptions(input, Options{Floats: true}))
+}
+
+func TestListOfFloats(t *testing.T) {
+	input := `\listoffigures
+
+\begin{figure}\includegraphics{a.png}\caption{First}\label{fig:a}\end{figure}
+\begin{figure}\includegraphics{b.png}\end{figure}`
+
+	lists := Options{Floats: true, ListOfFloats: true}
+	expected := "- [Figure 1: First](#fig:a)\n- [Figure 2](#figure-2)\n\n" +
+		"<a id=\"fig:a\"></a>\n![First](a.png)\n" +
+		"<a id=\"figure-2\"></a>\n![](b.png)"
+	assert.Equal(t, expected, convertWithOptions(input, lists))
+
+	// Without lists the commands are wrapped as before
+	assert.Equal(t, "<!--\\listoftables-->", convertWithOptions("\\listoftables", Options{Floats: true}))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+)
+
+// Conversion of text formatting commands to Markdown, or HTML where Markdown
+// has no equivalent. Only enabled with Options.Formatting.
+
+func init() {
+	commandConverters["fbox"] = (*Converter).convertFormatting
+	commandConverters["framebox"] = (*Converter).convertFormatting
+	commandConverters["texttt"] = (*Converter).convertTexttt
+
+	commandConverters["underline"] = (*Converter).convertFormatting
+	commandConverters["uline"] = (*Converter).convertFormatting
+
+	commandConverters["sout"] = (*Converter).convertFormatting
+	commandConverters["st"] = (*Converter).convertFormatting
+
+	commandConverters["hl"] = (*Converter).convertFormatting
+
+	for _, name := range plainTextCommands {
+		commandConverters[name] = (*Converter).convertPlainText
+	}
+}
+
+// Commands around text which is kept when wrapped LaTeX is dropped, see
+// convertPlainText
+var plainTextCommands = []string{
+	"emph", "textbf", "textit", "textsl", "textsc", "textsf", "textrm", "textup",
+	"textmd", "textnormal", "text", "mbox",
+}
+
+// LaTeX escapes of characters that are literal in code spans
+var codeUnescaper = strings.NewReplacer(
+	"\\textbackslash{}", "\\", "\\textbackslash", "\\",
+	"\\textasciitilde{}", "~", "\\textasciitilde", "~", "\\~{}", "~",
+	"\\textasciicircum{}", "^", "\\textasciicircum", "^", "\\^{}", "^",
+	"\\_", "_", "\\#", "#", "\\$", "$", "\\%", "%", "\\&", "&", "\\{", "{", "\\}", "}",
+)
+
+// HTML/Markdown to put around the converted argument of each command
+var formattingWrappers = map[string][2]string{
+	"fbox":     {`<span style="border: 1px solid; padding: 0 0.2em">`, "</span>"},
+	"framebox": {`<span style="border: 1px solid; padding: 0 0.2em">`, "</span>"},
+
+	// Markdown has no underlining
+	"underline": {"<u>", "</u>"},
+	"uline":     {"<u>", "</u>"},
+
+	// ulem and soul strikethrough
+	"sout": {"~~", "~~"},
+	"st":   {"~~", "~~"},
+
+	// soul highlighting, see also Options.EqualsHighlights
+	"hl": {"<mark>", "</mark>"},
+}
+
+// \fbox{text} and friends, optional arguments are ignored
+func (c *Converter) convertFormatting() bool {
+	if !c.options.Formatting {
+		return c.convertPlainText()
+	}
+
+	start := c.cursor
+	name := c.commandName()
+	c.skipCommandName()
+	for {
+		if _, ok := c.readOptionalArgument(); !ok {
+			break
+		}
+	}
+
+	text, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	wrapper := formattingWrappers[name]
+	if name == "hl" && c.options.EqualsHighlights {
+		wrapper = [2]string{"==", "=="}
+	}
+	c.emit(wrapper[0] + strings.TrimSpace(c.convertFragment(text)) + wrapper[1])
+	return true
+}
+
+// \texttt{code}, the argument becomes a code span
+func (c *Converter) convertTexttt() bool {
+	if !c.options.Formatting {
+		return c.convertPlainText()
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	code, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(codeSpan(codeUnescaper.Replace(code)))
+	return true
+}
+
+// \emph{text} and friends are replaced by their text when wrapped LaTeX is
+// dropped, which would lose the text otherwise
+func (c *Converter) convertPlainText() bool {
+	if c.options.Wrap != "drop" {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	for {
+		if _, ok := c.readOptionalArgument(); !ok {
+			break
+		}
+	}
+
+	text, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(c.convertFragment(text))
+	return true
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBoxes(t *testing.T) {
+	formatting := Options{Formatting: true}
+	assert.Equal(t, "<!--\\fbox{Note}-->", convertWithOptions("\\fbox{Note}", Options{}))
+	assert.Equal(t, `<span style="border: 1px solid; padding: 0 0.2em">Note <!--$x$--></span>`,
+		convertWithOptions("\\fbox{Note $x$}", formatting))
+}
+
+func TestTexttt(t *testing.T) {
+	formatting := Options{Formatting: true}
+	assert.Equal(t, "<!--\\texttt{fmt.Println}-->", convertWithOptions("\\texttt{fmt.Println}", Options{}))
+	assert.Equal(t, "Use `fmt.Println`.", convertWithOptions("Use \\texttt{fmt.Println}.", formatting))
+	assert.Equal(t, "`snake_case \\n 50%`", convertWithOptions("\\texttt{snake\\_case \\textbackslash{}n 50\\%}", formatting))
+	assert.Equal(t, "``a`b``", convertWithOptions("\\texttt{a`b}", formatting))
+}
+
+func TestUnderline(t *testing.T) {
+	formatting := Options{Formatting: true}
+	assert.Equal(t, "<u>important</u> and <u>this</u>", convertWithOptions("\\underline{important} and \\uline{this}", formatting))
+}
+
+func TestStrikethrough(t *testing.T) {
+	formatting := Options{Formatting: true}
+	assert.Equal(t, "~~old~~ new ~~gone~~", convertWithOptions("\\sout{old} new \\st{gone}", formatting))
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<mark>key</mark> point", convertWithOptions("\\hl{key} point", Options{Formatting: true}))
+	assert.Equal(t, "==key== point", convertWithOptions("\\hl{key} point", Options{Formatting: true, EqualsHighlights: true}))
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Options of a single document in its YAML front matter, which override the
+// ones given on the command line:
+//
+//	---
+//	title: Slides
+//	merkderwn:
+//	  preset: slides
+//	  unicode-math: true
+//	  disable: [floats, lists]
+//	---
+//
+// Keys are the names of the flags for conversion options (see
+// conversionFlags), a preset, the flags to disable and the formats to
+// convert to (see run.formats). The preset is applied first, so the other
+// keys override it. The options may also be given as a flow mapping, like
+// merkderwn: {preset: slides, disable: [floats]}. Only this subset of YAML is
+// read, the rest of the front matter is copied as it is.
+//
+// Slides and documents starting with a --- rule are not front matter, which
+// only has lines of YAML between the --- lines, see yamlLineRegexp.
+
+// Front matter is only looked for in this many bytes when converting in
+// chunks
+const maxFrontMatterSize = 1 << 16
+
+// A line of front matter: a key, a list item, a comment, a line continuing
+// the one before or a blank one
+var yamlLineRegexp = regexp.MustCompile(`^(?:[^\s#:-][^:]*:(?:[ \t].*)?|-(?:[ \t].*)?|#.*|[ \t].*|)$`)
+
+// Returns where the YAML front matter at the start of |in| ends, after its
+// closing --- or ... line, or 0 if there is none
+func frontMatterEnd(in []byte) int {
+	end := 0
+	for i := 0; end < len(in); i++ {
+		lineEnd := len(in)
+		if j := bytes.IndexByte(in[end:], '\n'); j >= 0 {
+			lineEnd = end + j + 1
+		}
+		line := string(bytes.TrimRight(in[end:lineEnd], " \t\r\n"))
+		end = lineEnd
+
+		if i == 0 && line != "---" {
+			return 0
+		} else if i > 0 && (line == "---" || line == "...") {
+			return end
+		} else if i > 0 && !yamlLineRegexp.MatchString(line) {
+			return 0
+		}
+	}
+	return 0
+}
+
+// A key of the merkderwn options and its value, or values for a list
+type frontMatterSetting struct {
+	key    string
+	values []string
+	list   bool
+}
+
+// Returns the settings under the merkderwn key of the front matter of |in|
+func frontMatterSettings(in []byte) ([]frontMatterSetting, error) {
+	end := frontMatterEnd(in)
+	if end == 0 {
+		return nil, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(in[:end]), "\n"), "\n")
+	lines = lines[1 : len(lines)-1]
+
+	var block []string
+	found := false
+	for _, line := range lines {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		if !found && strings.HasPrefix(line, "merkderwn:") {
+			value := strings.TrimSpace(line[len("merkderwn:"):])
+			if value == "" {
+				found = true
+				continue
+			} else if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+				return parseSettings(flowMapping(value[1:len(value)-1]), "the merkderwn front matter")
+			}
+			return nil, fmt.Errorf("Invalid line in the front matter: %s", line)
+		} else if !found {
+			continue
+		}
+		if line != "" && strings.TrimLeft(line, " \t") == line {
+			// The next top-level key
+			break
+		}
+		block = append(block, line)
+	}
+	return parseSettings(block, "the merkderwn front matter")
+}
+
+// Returns the settings of |lines|, keys with the same indentation and their
+// values, in the YAML read from |where|
+func parseSettings(lines []string, where string) ([]frontMatterSetting, error) {
+	var settings []frontMatterSetting
+	indentation := ""
+	indented := false
+	for _, line := range lines {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+
+		if !indented {
+			indentation = line[:len(line)-len(trimmed)]
+			indented = true
+		}
+		depth := len(line) - len(trimmed)
+		if strings.HasPrefix(trimmed, "- ") && len(settings) > 0 && depth >= len(indentation) {
+			setting := &settings[len(settings)-1]
+			if setting.list || len(setting.values) == 0 {
+				setting.list = true
+				setting.values = append(setting.values, unquoteYAML(strings.TrimSpace(trimmed[2:])))
+				continue
+			}
+		}
+		if line[:depth] != indentation {
+			return nil, fmt.Errorf("Invalid line in %s: %s", where, trimmed)
+		}
+
+		i := strings.Index(trimmed, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid line in %s: %s", where, trimmed)
+		}
+		setting := frontMatterSetting{key: strings.TrimSpace(trimmed[:i])}
+		value := strings.TrimSpace(trimmed[i+1:])
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			setting.list = true
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					setting.values = append(setting.values, unquoteYAML(item))
+				}
+			}
+		} else if value != "" {
+			setting.values = []string{unquoteYAML(value)}
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+// Returns the "key: value" lines of the flow mapping |mapping| without its
+// braces, split at the commas outside of lists and quotes
+func flowMapping(mapping string) []string {
+	var lines []string
+	var quote rune
+	depth, start := 0, 0
+	for i, r := range mapping {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[' || r == '{':
+			depth += 1
+		case r == ']' || r == '}':
+			depth -= 1
+		case r == ',' && depth == 0:
+			lines = append(lines, strings.TrimSpace(mapping[start:i]))
+			start = i + 1
+		}
+	}
+	return append(lines, strings.TrimSpace(mapping[start:]))
+}
+
+// Removes a comment, which starts with # after a space, outside of quotes
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteYAML(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Returns |options| with the ones in the front matter of |in| applied
+func documentOptions(in []byte, options Options) (Options, error) {
+	settings, err := frontMatterSettings(in)
+	if err != nil || len(settings) == 0 {
+		return options, err
+	}
+
+	for _, setting := range settings {
+		if setting.key != "preset" {
+			continue
+		}
+		if setting.list || len(setting.values) != 1 {
+			return options, fmt.Errorf("Invalid preset in the front matter, expected one of: %s", presetNames())
+		}
+		if err := applyPreset(setting.values[0], &options); err != nil {
+			return options, err
+		}
+	}
+
+	return applySettings(settings, options, "the front matter", "preset", "format")
+}
+
+// Returns |options| with |settings| read from |where| applied, except for
+// the |skipped| keys
+func applySettings(settings []frontMatterSetting, options Options, where string, skipped ...string) (Options, error) {
+	skip := map[string]bool{}
+	for _, key := range skipped {
+		skip[key] = true
+	}
+
+	flags := flag.NewFlagSet(where, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	conversionFlags(flags, &options)
+	for _, setting := range settings {
+		switch {
+		case skip[setting.key]:
+			continue
+		case setting.key == "disable":
+			for _, name := range setting.values {
+				f := flags.Lookup(name)
+				if f == nil || !isBoolFlag(f) {
+					return options, fmt.Errorf("Cannot disable %s in %s, it is not an option which can be enabled", name, where)
+				}
+				flags.Set(name, "false")
+			}
+		case flags.Lookup(setting.key) == nil:
+			return options, fmt.Errorf("Unknown option %s in %s", setting.key, where)
+		case setting.list || len(setting.values) != 1:
+			return options, fmt.Errorf("Invalid value for %s in %s, expected a single value", setting.key, where)
+		default:
+			if err := flags.Set(setting.key, setting.values[0]); err != nil {
+				return options, fmt.Errorf("Invalid value %s for %s in %s", setting.values[0], setting.key, where)
+			}
+		}
+	}
+
+	return options, options.validate()
+}
+
+// Returns the formats given in the front matter of |in|, if any
+func documentFormats(in []byte) ([]string, error) {
+	settings, err := frontMatterSettings(in)
+	for _, setting := range settings {
+		if setting.key == "format" {
+			return setting.values, checkFormats(setting.values)
+		}
+	}
+	return nil, err
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// Whether |in| starts with front matter which does not end before |end|
+func inFrontMatter(in []byte, end int) bool {
+	line := in
+	if i := bytes.IndexByte(in, '\n'); i >= 0 {
+		line = in[:i]
+	}
+	if string(bytes.TrimRight(line, " \t\r")) != "---" {
+		return false
+	}
+	frontMatter := frontMatterEnd(in)
+	return frontMatter == 0 || end < frontMatter
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFrontMatter(t *testing.T) {
+	frontMatter := "---\ntitle: Notes on $x$\nsummary: |\n  \\foo\n\n  more\n---\n"
+	assert.Equal(t, frontMatter+"Text <!--$x$-->", convertWithOptions(frontMatter+"Text $x$", Options{}))
+	assert.Equal(t, "---\r\na: $x$\r\n...", convertWithOptions("---\r\na: $x$\r\n...", Options{}))
+
+	// Not front matter
+	assert.Equal(t, "---\na: <!--$x$-->", convertWithOptions("---\na: $x$", Options{}))
+	assert.Equal(t, "a\n---\nb: <!--$x$-->\n---", convertWithOptions("a\n---\nb: $x$\n---", Options{}))
+
+	// Slides separated by --- rules
+	slides := "---\n# Slide 1\n%s and %s\n\n---\n# Slide 2\n%s"
+	assert.Equal(t, fmt.Sprintf(slides, "<!--$x$-->", "<!--\\cite{a}-->", "<!--$y$-->"), convertWithOptions(fmt.Sprintf(slides, "$x$", "\\cite{a}", "$y$"), Options{}))
+	assert.Equal(t, 0, frontMatterEnd([]byte("---\nSome text\n---\n")))
+}
+
+func TestDocumentOptions(t *testing.T) {
+	in := []byte(`---
+title: Slides
+merkderwn:
+  preset: slides # for the talk
+  unicode-math: "true"
+  disable: [floats, lists]
+  index: drop
+tags:
+  - talk
+---
+`)
+	options, err := documentOptions(in, Options{Links: true})
+	assert.NoError(t, err)
+	assert.True(t, options.Slides)
+	assert.True(t, options.Headings)
+	assert.True(t, options.UnicodeMath)
+	assert.True(t, options.Links)
+	assert.False(t, options.Floats)
+	assert.False(t, options.Lists)
+	assert.Equal(t, "drop", options.Index)
+
+	options, err = documentOptions([]byte("---\nmerkderwn:\n  disable:\n    - links\n    - logos\n---"), Options{Links: true, Logos: true})
+	assert.NoError(t, err)
+	assert.False(t, options.Links)
+	assert.False(t, options.Logos)
+
+	// As a flow mapping
+	options, err = documentOptions([]byte("---\nmerkderwn: {preset: mathjax, disable: [links, logos], wrap: \"drop\"}\n---"), Options{Links: true, Logos: true})
+	assert.NoError(t, err)
+	assert.True(t, options.MathPassthrough)
+	assert.False(t, options.Links)
+	assert.False(t, options.Logos)
+	assert.Equal(t, "drop", options.Wrap)
+
+	// Without merkderwn options
+	options, err = documentOptions([]byte("---\ntitle: x\n---\n"), Options{Links: true})
+	assert.NoError(t, err)
+	assert.Equal(t, Options{Links: true}, options)
+	options, err = documentOptions([]byte("merkderwn:\n  headings: true\n"), Options{})
+	assert.NoError(t, err)
+	assert.False(t, options.Headings)
+
+	for in, message := range map[string]string{
+		"---\nmerkderwn:\n  preset: web\n---":          "Unknown preset web",
+		"---\nmerkderwn:\n  render-math: svg\n---":     "Unknown option render-math in the front matter",
+		"---\nmerkderwn:\n  disable: [index]\n---":     "Cannot disable index in the front matter",
+		"---\nmerkderwn:\n  headings: maybe\n---":      "Invalid value maybe for headings in the front matter",
+		"---\nmerkderwn:\n  wrap: [drop]\n---":         "Invalid value for wrap in the front matter",
+		"---\nmerkderwn:\n  lists\n---":                "Invalid line in the merkderwn front matter: lists",
+		"---\nmerkderwn: mathjax\n---":                 "Invalid line in the front matter: merkderwn: mathjax",
+		"---\nmerkderwn:\n  math-delimiters: tex\n---": "Unknown math delimiters tex",
+	} {
+		_, err := documentOptions([]byte(in), Options{})
+		if assert.Error(t, err, in) {
+			assert.Contains(t, err.Error(), message, in)
+		}
+	}
+}
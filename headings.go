@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Conversion of sectioning commands to ATX headings. The highest division
+// used in the document becomes a level 1 heading, i.e. \section is "#" in an
+// article and "##" in a book with chapters.
+//
+// After \appendix the top level divisions are lettered ("Appendix A: ...").
+// \frontmatter, \mainmatter and \backmatter only switch the part of the
+// document the following headings belong to and are not emitted. The part is
+// reported with the headings, see Report.Headings.
+//
+// Markdown headings end at the end of their line, so LaTeX spanning several
+// lines is put on one in headings, a newline being a space in LaTeX anyway.
+
+var divisions = []string{
+	"part", "chapter", "section", "subsection", "subsubsection", "paragraph", "subparagraph",
+}
+
+type headingState struct {
+	// Index into divisions of the highest division in the document, -1 if
+	// not determined yet
+	top int
+
+	// "frontmatter", "mainmatter" or "backmatter", "" if never switched
+	matter string
+
+	appendix   bool
+	appendices int
+
+	converted []Heading
+}
+
+// A converted heading along with the part of the document it belongs to,
+// see Report
+type Heading struct {
+	// 1 for "#" and so on
+	Level int
+	Title string
+
+	// "frontmatter", "mainmatter" or "backmatter", "" if never switched
+	Matter string
+}
+
+func init() {
+	for _, division := range divisions {
+		commandConverters[division] = (*Converter).convertHeading
+	}
+	commandConverters["appendix"] = (*Converter).convertAppendix
+	commandConverters["frontmatter"] = (*Converter).convertMatter
+	commandConverters["mainmatter"] = (*Converter).convertMatter
+	commandConverters["backmatter"] = (*Converter).convertMatter
+}
+
+// \section*[short title]{title}
+func (c *Converter) convertHeading() bool {
+	if !c.options.Headings {
+		return false
+	}
+
+	start := c.cursor
+	division := divisionIndex(c.commandName())
+	c.skipCommandName()
+	if !c.atEof() && c.current() == "*" {
+		c.cursor += 1
+	}
+	c.readOptionalArgument()
+
+	title, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	// \label{...} in the title or right after it
+	var label string
+	labeled := false
+	if c.options.NumberEquations {
+		if label, labeled = commandArgument(title, "label"); labeled {
+			title = removeCommand(title, "label")
+		} else {
+			label, labeled = c.readFollowingLabel()
+		}
+	}
+	title = strings.TrimSpace(c.convertFragment(title))
+
+	top := c.topDivision()
+	if c.doc.headings.appendix && division == top {
+		title = fmt.Sprintf("Appendix %c: %s", 'A'+c.doc.headings.appendices%26, title)
+		c.doc.headings.appendices += 1
+	}
+
+	level := clampLevel(division - top + 1 + c.options.ShiftHeadings)
+
+	title = strings.Replace(title, "\n", " ", -1)
+	anchor := c.headingAnchor(title)
+	if labeled {
+		// Headings are not numbered, \ref shows their title
+		c.setLabel(label, title, "section")
+		name := strings.TrimSpace(label)
+		l := c.doc.labels[name]
+		l.anchor = anchor
+		c.doc.labels[name] = l
+	}
+	c.doc.headings.converted = append(c.doc.headings.converted, Heading{level, title, c.doc.headings.matter})
+	c.emit(strings.Repeat("#", level) + " " + title)
+	return true
+}
+
+// Reads a \label{...} after the cursor on the same line
+func (c *Converter) readFollowingLabel() (string, bool) {
+	start := c.cursor
+	for !c.atEof() && (c.current() == " " || c.current() == "\t") {
+		c.cursor += 1
+	}
+	if c.commandName() == "label" {
+		c.skipCommandName()
+		if label, ok := c.readArgument(); ok {
+			return label, true
+		}
+	}
+	c.cursor = start
+	return "", false
+}
+
+func (c *Converter) convertAppendix() bool {
+	if !c.options.Headings {
+		return false
+	}
+
+	c.doc.headings.appendix = true
+	c.skipCommandName()
+	return true
+}
+
+func (c *Converter) convertMatter() bool {
+	if !c.options.Headings {
+		return false
+	}
+
+	c.doc.headings.matter = c.commandName()
+	c.doc.headings.appendix = false
+	c.skipCommandName()
+	return true
+}
+
+// Determines the highest division used anywhere in the input
+func (c *Converter) topDivision() int {
+	if c.doc.headings.top >= 0 {
+		return c.doc.headings.top
+	}
+
+	top := divisionIndex("section")
+	start := c.cursor
+	for c.cursor = 0; c.skipTo("\\"); c.cursor++ {
+		if division := divisionIndex(c.commandName()); division >= 0 && division < top {
+			top = division
+		}
+	}
+	c.cursor = start
+
+	c.doc.headings.top = top
+	return c.doc.headings.top
+}
+
+func divisionIndex(name string) int {
+	for i, division := range divisions {
+		if division == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// The start of an ATX heading up to some of its text
+var atxHeadingRegexp = regexp.MustCompile(`^ {0,3}#{1,6}[ \t]`)
+
+// Returns |latex| on one line if it is in an ATX heading of the input,
+// starting at byte |start|
+func (c *Converter) singleLineInHeading(start int, latex string) string {
+	if !strings.Contains(latex, "\n") {
+		return latex
+	}
+	lineStart := bytes.LastIndexByte(c.in[:start], '\n') + 1
+	if !atxHeadingRegexp.Match(c.in[lineStart:start]) {
+		return latex
+	}
+	return strings.Replace(latex, "\n", " ", -1)
+}
+
+// An ATX heading on a line of its own, and the start of a fenced code block
+var (
+	headingLineRegexp = regexp.MustCompile(`^( {0,3})(#{1,6})([ \t]|$)`)
+	codeFenceRegexp   = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+)
+
+// Returns |markdown| with its ATX headings |n| levels lower (higher if
+// negative), between 1 and 6. Headings in fenced code blocks are code.
+func shiftHeadings(markdown []byte, n int) []byte {
+	lines := bytes.SplitAfter(markdown, []byte("\n"))
+	var fence []byte
+	for i, line := range lines {
+		if fence != nil {
+			if bytes.HasPrefix(bytes.TrimLeft(line, " "), fence) {
+				fence = nil
+			}
+			continue
+		}
+		if match := codeFenceRegexp.FindSubmatch(line); match != nil {
+			fence = match[1]
+			continue
+		}
+
+		match := headingLineRegexp.FindSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		level := clampLevel(match[5] - match[4] + n)
+		shifted := append([]byte(nil), line[:match[4]]...)
+		shifted = append(shifted, strings.Repeat("#", level)...)
+		lines[i] = append(shifted, line[match[5]:]...)
+	}
+	return bytes.Join(lines, nil)
+}
+
+// Returns |level| between 1 and 6, the levels of Markdown headings
+func clampLevel(level int) int {
+	if level < 1 {
+		return 1
+	} else if level > 6 {
+		return 6
+	}
+	return level
+}
+
+// Shifts the ATX heading starting at the cursor by Options.ShiftHeadings
+// levels, unless it is in a fenced code block
+func (c *Converter) handleMarkdownHeading() bool {
+	if c.options.ShiftHeadings == 0 || c.fragment || c.current() != "#" {
+		return false
+	}
+
+	lineStart := bytes.LastIndexByte(c.in[:c.cursor], '\n') + 1
+	lineEnd := c.inputLength
+	if i := bytes.IndexByte(c.in[c.cursor:], '\n'); i >= 0 {
+		lineEnd = c.cursor + i
+	}
+	match := headingLineRegexp.FindSubmatchIndex(c.in[lineStart:lineEnd])
+	if match == nil || lineStart+match[4] != c.cursor || c.inCodeFence(lineStart) {
+		return false
+	}
+
+	level := clampLevel(match[5] - match[4] + c.options.ShiftHeadings)
+	c.emit(strings.Repeat("#", level))
+	c.cursor = lineStart + match[5]
+	return true
+}
+
+// Whether the line at |lineStart| is in a fenced code block. Lines are
+// checked once, in order.
+func (c *Converter) inCodeFence(lineStart int) bool {
+	for c.fencesChecked < lineStart {
+		end := c.inputLength
+		if i := bytes.IndexByte(c.in[c.fencesChecked:], '\n'); i >= 0 {
+			end = c.fencesChecked + i + 1
+		}
+		line := c.in[c.fencesChecked:end]
+		c.fencesChecked = end
+
+		if c.doc.fence != nil {
+			if bytes.HasPrefix(bytes.TrimLeft(line, " "), c.doc.fence) {
+				c.doc.fence = nil
+			}
+		} else if match := codeFenceRegexp.FindSubmatch(line); match != nil {
+			c.doc.fence = append([]byte(nil), match[1]...)
+		}
+	}
+	return c.doc.fence != nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHeadingsAreWrappedByDefault(t *testing.T) {
+	assert.Equal(t, "<!--\\section{Intro}-->", convertWithOptions("\\section{Intro}", Options{}))
+}
+
+func TestHeadingConversion(t *testing.T) {
+	headings := Options{Headings: true}
+	assert.Equal(t, "# Intro\n\n## Details", convertWithOptions("\\section{Intro}\n\n\\subsection*{Details}", headings))
+	assert.Equal(t, "# Intro\n## Details", convertWithOptions("\\chapter[Short]{Intro}\n\\section{Details}", headings))
+	assert.Equal(t, "# Cost of <!--$\\partial x$-->", convertWithOptions("\\section{Cost of $\\partial x$}", headings))
+}
+
+func TestAppendixHeadings(t *testing.T) {
+	input := `\frontmatter
+\chapter{Preface}
+\mainmatter
+\chapter{Intro}
+\appendix
+\chapter{Proofs}
+\section{Lemma}
+\chapter{Data}
+\backmatter
+\chapter{Index}`
+	expected := `
+# Preface
+
+# Intro
+
+# Appendix A: Proofs
+## Lemma
+# Appendix B: Data
+
+# Index`
+
+	out, report, err := Convert([]byte(input), Options{Headings: true})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(out))
+	assert.Equal(t, Heading{1, "Preface", "frontmatter"}, report.Headings[0])
+	assert.Equal(t, Heading{1, "Appendix A: Proofs", "mainmatter"}, report.Headings[2])
+	assert.Equal(t, Heading{2, "Lemma", "mainmatter"}, report.Headings[3])
+	assert.Equal(t, Heading{1, "Index", "backmatter"}, report.Headings[5])
+}
+
+func TestLatexInHeadings(t *testing.T) {
+	assert.Equal(t, "# The <!--$O(n)$--> bound", convertWithOptions("# The $O(n)$ bound", Options{}))
+	assert.Equal(t, "## The $O(n \\log n)$ bound\nnext", convertWithOptions("## The $O(n\n\\log n)$ bound\nnext", Options{MathPassthrough: true}))
+	assert.Equal(t, "# A <!--\\cite{b c}--> d\n<!--\\cite{b\nc}-->", convertWithOptions("# A \\cite{b\nc} d\n\\cite{b\nc}", Options{}))
+	assert.Equal(t, "# A <!--\\cite{b c}-->", convertWithOptions("\\section{A \\cite{b\nc}}", Options{Headings: true}))
+
+	// Not headings, or not ending
+	assert.Equal(t, "#a <!--\\cite{b\nc}-->", convertWithOptions("#a \\cite{b\nc}", Options{}))
+	assert.Equal(t, "# A <!--\\cite{b\nc-->", convertWithOptions("# A \\cite{b\nc", Options{}))
+}
+
+func TestShiftHeadings(t *testing.T) {
+	markdown := "# A\n\n## B #\n```\n# Code\n```\n#C\n  ###### D\n#"
+	assert.Equal(t, "## A\n\n### B #\n```\n# Code\n```\n#C\n  ###### D\n##", string(shiftHeadings([]byte(markdown), 1)))
+	assert.Equal(t, "# A\n\n# B #\n```\n# Code\n```\n#C\n  #### D\n#", string(shiftHeadings([]byte(markdown), -2)))
+}
+
+func TestShiftHeadingsOption(t *testing.T) {
+	options := Options{Headings: true, ShiftHeadings: 1}
+	assert.Equal(t, "## A\n\n### B\n", convertWithOptions("\\section{A}\n\n\\subsection{B}\n", options))
+	assert.Equal(t, "### A\n\n##### B #\n```\n# Code\n```\n#C\n", convertWithOptions("## A\n\n#### B #\n```\n# Code\n```\n#C\n", options))
+	assert.Equal(t, "###### A", convertWithOptions("###### A", options))
+
+	options.ShiftHeadings = -1
+	assert.Equal(t, "# A\n\n# B\n", convertWithOptions("\\section{A}\n\n## B\n", options))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rewriting of image paths, for sites whose assets are laid out differently
+// than the LaTeX project, e.g. with "figures/=/static/img/"
+//
+//	\includegraphics{figures/plot.png}   ![...](/static/img/plot.png)
+//	![A plot](figures/plot.png)          ![A plot](/static/img/plot.png)
+//
+// Rules are from=to pairs separated by commas, the first rule whose from is a
+// prefix of a path replaces it with its to.
+//
+// With Options.CollectAssets, the images are copied into a directory of
+// their own and the paths point to the copies, so the output and the
+// directory can be published together. Copies are named like the images,
+// images of the same name but different content get the hash of their
+// content added. Paths are rewritten after the images are collected.
+
+// Extensions tried for images given without one, which \includegraphics
+// allows
+var imageExtensions = []string{"", ".png", ".jpg", ".jpeg", ".pdf", ".svg"}
+
+// Returns the rules of |spec| as from, to pairs
+func imageRewrites(spec string) ([][2]string, error) {
+	var rewrites [][2]string
+	for _, rule := range strings.Split(spec, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		i := strings.Index(rule, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid image rewrite %s, expected from=to", rule)
+		}
+		rewrites = append(rewrites, [2]string{rule[:i], rule[i+1:]})
+	}
+	return rewrites, nil
+}
+
+// Returns |path| rewritten by the first rule of Options.RewriteImages
+// matching it
+func (c *Converter) rewriteImage(path string) string {
+	rewrites, _ := imageRewrites(c.options.RewriteImages)
+	for _, rewrite := range rewrites {
+		if strings.HasPrefix(path, rewrite[0]) {
+			return rewrite[1] + path[len(rewrite[0]):]
+		}
+	}
+	return path
+}
+
+// Rewrites the path of the Markdown image at the cursor, ![alt](path "title")
+// or ![alt](<path>), which ends on its line. Its alt text is converted.
+func (c *Converter) handleMarkdownImage() bool {
+	if !c.options.changesImages() || c.current() != "!" || c.lookahead(1) != "[" {
+		return false
+	}
+
+	lineEnd := c.inputLength
+	if i := bytes.IndexByte(c.in[c.cursor:], '\n'); i >= 0 {
+		lineEnd = c.cursor + i
+	}
+
+	// The ] closing the alt text
+	altEnd := -1
+	nesting := 0
+	for i := c.cursor + 2; i < lineEnd && altEnd < 0; i++ {
+		switch c.in[i] {
+		case '\\':
+			i += 1
+		case '[':
+			nesting += 1
+		case ']':
+			if nesting == 0 {
+				altEnd = i
+			}
+			nesting -= 1
+		}
+	}
+	if altEnd < 0 || altEnd+1 >= lineEnd || c.in[altEnd+1] != '(' {
+		return false
+	}
+
+	pathStart := altEnd + 2
+	for pathStart < lineEnd && c.in[pathStart] == ' ' {
+		pathStart += 1
+	}
+	var pathEnd int
+	if pathStart < lineEnd && c.in[pathStart] == '<' {
+		pathStart += 1
+		pathEnd = bytes.IndexByte(c.in[pathStart:lineEnd], '>')
+	} else {
+		pathEnd = bytes.IndexAny(c.in[pathStart:lineEnd], " \t)")
+	}
+	if pathEnd <= 0 {
+		return false
+	}
+	pathEnd += pathStart
+
+	alt := string(c.in[c.cursor+2 : altEnd])
+	c.emit("![" + c.convertFragment(alt))
+	c.emit(string(c.in[altEnd:pathStart]))
+	c.emit(c.imagePath(string(c.in[pathStart:pathEnd])))
+	c.cursor = pathEnd
+	return true
+}
+
+// Whether Markdown images are looked for, to collect or rewrite them
+func (options Options) changesImages() bool {
+	return options.RewriteImages != "" || options.CollectAssets != ""
+}
+
+// Returns the path to emit for the image at |path|, collected and rewritten
+func (c *Converter) imagePath(path string) string {
+	if c.options.CollectAssets != "" {
+		path = c.collectImage(path)
+	}
+	return c.rewriteImage(path)
+}
+
+// Copies the image at |path|, relative to the directory of the document,
+// into Options.CollectAssets and returns the path of the copy. Images which
+// are not files, e.g. URLs, are not collected.
+func (c *Converter) collectImage(path string) string {
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "data:") {
+		return path
+	}
+
+	var source string
+	var image []byte
+	for _, extension := range imageExtensions {
+		source = filepath.Join(c.options.sourceDir, filepath.FromSlash(path+extension))
+		var err error
+		if image, err = ioutil.ReadFile(source); err == nil {
+			break
+		}
+	}
+	if image == nil {
+		c.warn("Could not collect image %s, it was not found", path)
+		return path
+	}
+
+	name := filepath.Base(source)
+	target := filepath.Join(c.options.CollectAssets, name)
+	if existing, err := ioutil.ReadFile(target); err == nil && !bytes.Equal(existing, image) {
+		hash := sha256.Sum256(image)
+		extension := filepath.Ext(name)
+		name = strings.TrimSuffix(name, extension) + "-" + hex.EncodeToString(hash[:])[:8] + extension
+		target = filepath.Join(c.options.CollectAssets, name)
+	}
+
+	if existing, err := ioutil.ReadFile(target); err != nil || !bytes.Equal(existing, image) {
+		if err := os.MkdirAll(c.options.CollectAssets, 0755); err != nil {
+			c.warn("Could not collect image %s: %s", path, err)
+			return path
+		}
+		if err := writeAsset(target, image); err != nil {
+			c.warn("Could not collect image %s: %s", path, err)
+			return path
+		}
+	}
+	return filepath.ToSlash(target)
+}
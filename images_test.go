@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageRewrites(t *testing.T) {
+	rewrites, err := imageRewrites("figures/=/static/img/, plots/=")
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]string{{"figures/", "/static/img/"}, {" plots/", ""}}, rewrites)
+
+	_, err = imageRewrites("figures/")
+	assert.NotNil(t, err)
+	assert.NotNil(t, Options{RewriteImages: "=/static/img/"}.validate())
+}
+
+func TestRewriteMarkdownImages(t *testing.T) {
+	options := Options{RewriteImages: "figures/=/static/img/,plots/=img/"}
+	assert.Equal(t, "![A](/static/img/a.png) ![B](<img/b c.png> \"B\") ![C](other/c.png)",
+		convertWithOptions("![A](figures/a.png) ![B](<plots/b c.png> \"B\") ![C](other/c.png)", options))
+	assert.Equal(t, "![a [b] <!--\\x-->](img/a.png)", convertWithOptions("![a [b] \\x](plots/a.png)", options))
+
+	// Not images
+	assert.Equal(t, "Wow! ![a\n](figures/a.png) ![a] (figures/a.png)", convertWithOptions("Wow! ![a\n](figures/a.png) ![a] (figures/a.png)", options))
+	assert.Equal(t, "![](figures/a.png)", convertWithOptions("![](figures/a.png)", Options{}))
+}
+
+func TestRewriteFigureImages(t *testing.T) {
+	options := Options{Floats: true, RewriteImages: "figures/=/static/img/"}
+	assert.Equal(t, "<a id=\"fig:a\"></a>\n![A](/static/img/a.png)\n",
+		convertWithOptions("\\begin{figure}\\includegraphics{figures/a.png}\\caption{A}\\label{fig:a}\\end{figure}\n", options))
+}
+
+func TestCollectImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "figures"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "plots"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "figures", "a.png"), []byte("a"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "plots", "a.png"), []byte("other a"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "plots", "b.pdf"), []byte("b"), 0644))
+
+	bundle := filepath.Join(dir, "bundle")
+	c := NewConverter([]byte("![A](figures/a.png) ![A](plots/a.png) ![C](https://example.com/c.png) ![D](d.png)\n\n"+
+		"\\begin{figure}\\includegraphics{plots/b}\\caption{B}\\label{fig:b}\\end{figure}\n"),
+		Options{Floats: true, CollectAssets: bundle, sourceDir: dir})
+	out := string(c.Convert())
+
+	hash := sha256.Sum256([]byte("other a"))
+	other := "a-" + hex.EncodeToString(hash[:])[:8] + ".png"
+	prefix := filepath.ToSlash(bundle) + "/"
+	assert.Equal(t, "![A]("+prefix+"a.png) ![A]("+prefix+other+") ![C](https://example.com/c.png) ![D](d.png)\n\n"+
+		"<a id=\"fig:b\"></a>\n![B]("+prefix+"b.pdf)\n", out)
+	assert.Equal(t, 1, len(c.Warnings()))
+
+	for name, content := range map[string]string{"a.png": "a", other: "other a", "b.pdf": "b"} {
+		collected, err := ioutil.ReadFile(filepath.Join(bundle, name))
+		assert.Nil(t, err)
+		assert.Equal(t, content, string(collected))
+	}
+}
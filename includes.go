@@ -0,0 +1,215 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Labels of files included with \input and \include, so that \ref can link to
+// them. Included files are expected to be converted next to the including
+// one, i.e. chapters/intro.tex to chapters/intro.md.
+//
+// \input inlines the file, so its equations, figures and tables are numbered
+// after those before the \input, and those after the \input continue after
+// the ones of the file. A project converts the files in the order LaTeX reads
+// them to know where the numbers of each file start.
+
+// Extensions tried for included files given without one
+var includeExtensions = []string{"", ".tex", ".xmd", ".md"}
+
+// Numbers of equations, figures and tables
+type counters struct {
+	equations, figures, tables int
+}
+
+func (n counters) minus(other counters) counters {
+	return counters{n.equations - other.equations, n.figures - other.figures, n.tables - other.tables}
+}
+
+// Files converted together, e.g. a thesis and its chapters
+type project struct {
+	options Options
+
+	// All labels, with the path of the converted file defining them
+	labels map[string]label
+
+	// By path of a converted file: the numbers before it, the numbers it
+	// takes up including the files it includes, and the numbers taken up by
+	// the files it includes by what is included, e.g. "chapters/intro"
+	starts   map[string]counters
+	counts   map[string]counters
+	includes map[string]map[string]counters
+}
+
+func newProject(options Options) *project {
+	return &project{
+		options:  options,
+		labels:   map[string]label{},
+		starts:   map[string]counters{},
+		counts:   map[string]counters{},
+		includes: map[string]map[string]counters{},
+	}
+}
+
+// Returns the files included with \input{...} and \include{...} in |in|
+func includedFiles(in []byte) []string {
+	files := commandArguments(string(in), "input")
+	files = append(files, commandArguments(string(in), "include")...)
+	for i, file := range files {
+		files[i] = strings.TrimSpace(file)
+	}
+	return files
+}
+
+// Adds the file at |path| with |content| and all files it includes
+// (recursively) to the project, unless it was added already. Its numbers
+// start at 1, included paths are relative to its directory, like in LaTeX.
+func (p *project) add(path string, content []byte) {
+	path = filepath.Clean(path)
+	if _, ok := p.starts[path]; !ok {
+		p.convert(filepath.Dir(path), path, content, counters{})
+	}
+}
+
+// Adds the files at |paths| with |contents| to the project. Files included
+// by other ones are added where they are included, so their numbers follow
+// the ones before them.
+func (p *project) addAll(paths []string, contents [][]byte) {
+	included := map[string]bool{}
+	for i, path := range paths {
+		path = filepath.Clean(path)
+		seen := map[string]bool{path: true}
+		collectIncludedFiles(filepath.Dir(path), contents[i], seen)
+		for file := range seen {
+			if file != path {
+				included[file] = true
+			}
+		}
+	}
+
+	for i, path := range paths {
+		if !included[filepath.Clean(path)] {
+			p.add(path, contents[i])
+		}
+	}
+	// Files which include each other
+	for i, path := range paths {
+		p.add(path, contents[i])
+	}
+}
+
+// Adds the files included by |in| (recursively) to |seen|
+func collectIncludedFiles(dir string, in []byte, seen map[string]bool) {
+	for _, include := range includedFiles(in) {
+		path, content, ok := readIncludedFile(dir, include)
+		if ok && !seen[path] {
+			seen[path] = true
+			collectIncludedFiles(dir, content, seen)
+		}
+	}
+}
+
+// Converts the file at |path| with numbers starting after |before|,
+// including the files it includes. Returns the numbers it takes up.
+func (p *project) convert(dir, path string, content []byte, before counters) counters {
+	p.starts[path] = before
+	includes := map[string]counters{}
+	p.includes[path] = includes
+
+	options := p.options
+	options.numbersBefore = before
+	options.includeFile = func(include string, before counters) counters {
+		n, ok := includes[include]
+		if !ok {
+			n = p.include(dir, include, before)
+			includes[include] = n
+		}
+		return n
+	}
+
+	c := NewConverter(content, options)
+	c.Convert()
+
+	for name, l := range c.doc.labels {
+		l.file = outputPath(path)
+		p.labels[name] = l
+	}
+	p.counts[path] = c.numbers().minus(before)
+	return p.counts[path]
+}
+
+// Converts the file included with |include| unless it was already, and
+// returns the numbers it takes up
+func (p *project) include(dir, include string, before counters) counters {
+	path, content, ok := readIncludedFile(dir, include)
+	if !ok {
+		return counters{}
+	}
+	if _, ok := p.starts[path]; ok {
+		// Zero while it is converted, for files which include each other
+		return p.counts[path]
+	}
+	return p.convert(dir, path, content, before)
+}
+
+// Returns |options| for converting the file at |path| of the project, with
+// its numbers and the labels of the other files
+func (p *project) optionsFor(path string, options Options) Options {
+	path = filepath.Clean(path)
+	options.numbersBefore = p.starts[path]
+	options.includedNumbers = p.includes[path]
+	if options.includedNumbers == nil {
+		options.includedNumbers = map[string]counters{}
+	}
+
+	options.externalLabels = map[string]label{}
+	output := outputPath(path)
+	for name, l := range p.labels {
+		if l.file == output {
+			continue
+		}
+		if file, err := filepath.Rel(filepath.Dir(path), l.file); err == nil {
+			l.file = filepath.ToSlash(file)
+		}
+		options.externalLabels[name] = l
+	}
+	return options
+}
+
+func readIncludedFile(dir, include string) (string, []byte, bool) {
+	for _, extension := range includeExtensions {
+		path := filepath.Join(dir, include+extension)
+		if content, err := ioutil.ReadFile(path); err == nil {
+			return path, content, true
+		}
+	}
+	return "", nil, false
+}
+
+// Numbers of the equations, figures and tables converted so far
+func (c *Converter) numbers() counters {
+	return counters{
+		c.doc.equations,
+		c.doc.figuresBefore + len(c.doc.figures),
+		c.doc.tablesBefore + len(c.doc.tables),
+	}
+}
+
+// Counts the numbers taken up by the files included in the LaTeX from
+// |start| to the cursor, in a project
+func (c *Converter) recordIncludes(start int) {
+	if c.options.includedNumbers == nil && c.options.includeFile == nil {
+		return
+	}
+
+	for _, include := range includedFiles(c.in[start:c.cursor]) {
+		n, ok := c.options.includedNumbers[include]
+		if !ok && c.options.includeFile != nil {
+			n = c.options.includeFile(include, c.numbers())
+		}
+		c.doc.equations += n.equations
+		c.doc.figuresBefore += n.figures
+		c.doc.tablesBefore += n.tables
+	}
+}
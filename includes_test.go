@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIncludedFiles(t *testing.T) {
+	assert.Equal(t, []string{"chapters/intro", "appendix.tex"}, includedFiles([]byte("\\input{chapters/intro}\n\\include{ appendix.tex }")))
+}
+
+func TestCrossFileReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "chapters"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "chapters", "intro.tex"),
+		[]byte("\\begin{figure}\\includegraphics{a.png}\\label{fig:other-chapter}\\end{figure}\n\\input{chapters/loop}"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "chapters", "loop.xmd"),
+		[]byte("\\begin{equation} x \\label{eq:loop} \\end{equation}\n\\input{chapters/intro}"), 0644)
+
+	options := Options{NumberEquations: true, Floats: true}
+	path := filepath.Join(dir, "main.xmd")
+	main := []byte("See \\autoref{fig:other-chapter} and \\eqref{eq:loop}.\n\\input{chapters/intro}")
+	p := newProject(options)
+	p.add(path, main)
+	options = p.optionsFor(path, options)
+
+	assert.Equal(t, "See [Figure 1](chapters/intro.md#fig:other-chapter) and [(1)](chapters/loop.md#eq:loop).\n<!--\\input{chapters/intro}-->",
+		convertWithOptions(string(main), options))
+}
+
+func TestIncludedNumbering(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	chapter := filepath.Join(dir, "chapter.tex")
+	ioutil.WriteFile(chapter, []byte("\\begin{equation} b \\label{eq:b} \\end{equation}\n"+
+		"\\begin{figure}\\includegraphics{b.png}\\label{fig:b}\\end{figure}\n\\eqref{eq:c}"), 0644)
+	path := filepath.Join(dir, "main.xmd")
+	main := []byte("\\begin{equation} a \\label{eq:a} \\end{equation}\n\\input{chapter}\n" +
+		"\\begin{equation} c \\label{eq:c} \\end{equation}\n" +
+		"\\begin{figure}\\includegraphics{c.png}\\label{fig:c}\\end{figure}\n" +
+		"\\eqref{eq:a} \\eqref{eq:b} \\eqref{eq:c} \\ref{fig:b} \\ref{fig:c}")
+
+	options := Options{NumberEquations: true, Floats: true}
+	p := newProject(options)
+	p.addAll([]string{chapter, path}, [][]byte{nil, main})
+
+	out := convertWithOptions(string(main), p.optionsFor(path, options))
+	assert.Contains(t, out, "[(1)](#eq:a) [(2)](chapter.md#eq:b) [(3)](#eq:c) [1](chapter.md#fig:b) [2](#fig:c)")
+
+	// The included file continues after the equation before the \input
+	content, _ := ioutil.ReadFile(chapter)
+	out = convertWithOptions(string(content), p.optionsFor(chapter, options))
+	assert.Contains(t, out, "(2)</span>")
+	assert.Contains(t, out, "[(3)](main.md#eq:c)")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Handling of \index{term}, depending on Options.Index:
+//
+//      drop      the command is removed
+//      anchor    the command becomes <a id="index-1"></a>
+//      generate  anchors plus an index of all terms at the end of the document
+//
+// makeidx syntax is understood as far as the index needs it, i.e. for
+// \index{sort@Display!Subterm|see{Other}} the entry is "Display, Subterm".
+
+type indexEntry struct {
+	anchor  string
+	term    string
+	sortKey string
+}
+
+func init() {
+	commandConverters["index"] = (*Converter).convertIndex
+}
+
+func validIndexMode(mode string) bool {
+	return mode == "drop" || mode == "anchor" || mode == "generate"
+}
+
+func (c *Converter) convertIndex() bool {
+	if !validIndexMode(c.options.Index) {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	term, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	if c.options.Index == "drop" {
+		return true
+	}
+
+	entry := parseIndexTerm(term)
+	entry.anchor = c.generatedAnchor("index", len(c.doc.indexEntries)+1, term)
+	c.doc.indexEntries = append(c.doc.indexEntries, entry)
+
+	c.emit(fmt.Sprintf("<a id=\"%s\"></a>", entry.anchor))
+	return true
+}
+
+func parseIndexTerm(term string) indexEntry {
+	// Page formatting like |textbf or |see{...}
+	if i := strings.Index(term, "|"); i >= 0 {
+		term = term[:i]
+	}
+
+	var display, sortKeys []string
+	for _, level := range strings.Split(term, "!") {
+		sortKey := level
+		if i := strings.Index(level, "@"); i >= 0 {
+			sortKey, level = level[:i], level[i+1:]
+		}
+		display = append(display, strings.TrimSpace(level))
+		sortKeys = append(sortKeys, strings.ToLower(strings.TrimSpace(sortKey)))
+	}
+
+	return indexEntry{
+		term:    strings.Join(display, ", "),
+		sortKey: strings.Join(sortKeys, "!"),
+	}
+}
+
+// Appends the generated index, one item per term linking to all its uses
+func (c *Converter) appendIndex() {
+	if c.options.Index != "generate" || len(c.doc.indexEntries) == 0 {
+		return
+	}
+
+	var terms []indexEntry
+	anchors := map[string][]string{}
+	for _, entry := range c.doc.indexEntries {
+		if _, ok := anchors[entry.term]; !ok {
+			terms = append(terms, entry)
+		}
+		anchors[entry.term] = append(anchors[entry.term], entry.anchor)
+	}
+	sort.SliceStable(terms, func(i, j int) bool {
+		return terms[i].sortKey < terms[j].sortKey
+	})
+
+	c.emit("\n\n# Index\n\n")
+	for _, entry := range terms {
+		var links []string
+		for i, anchor := range anchors[entry.term] {
+			links = append(links, fmt.Sprintf("[%d](#%s)", i+1, anchor))
+		}
+		c.emit("- " + c.convertFragment(entry.term) + ": " + strings.Join(links, ", ") + "\n")
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIndexModes(t *testing.T) {
+	input := "Graphs\\index{graph} are nice."
+	assert.Equal(t, "Graphs<!--\\index{graph}--> are nice.", convertWithOptions(input, Options{}))
+	assert.Equal(t, "Graphs are nice.", convertWithOptions(input, Options{Index: "drop"}))
+	assert.Equal(t, "Graphs<a id=\"index-1\"></a> are nice.", convertWithOptions(input, Options{Index: "anchor"}))
+}
+
+func TestGeneratedIndex(t *testing.T) {
+	input := "Trees\\index{tree}, graphs\\index{graph|textbf} and trees\\index{tree}, " +
+		"sorted\\index{aardvark@Zebra!striped}."
+	expected := "Trees<a id=\"index-1\"></a>, graphs<a id=\"index-2\"></a> and trees<a id=\"index-3\"></a>, " +
+		"sorted<a id=\"index-4\"></a>." +
+		"\n\n# Index\n\n" +
+		"- Zebra, striped: [1](#index-4)\n" +
+		"- graph: [1](#index-2)\n" +
+		"- tree: [1](#index-1), [2](#index-3)\n"
+	assert.Equal(t, expected, convertWithOptions(input, Options{Index: "generate"}))
+}
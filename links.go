@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+)
+
+// Conversion of hyperref links to Markdown:
+//
+//      \href{https://example.com}{text}  =>  [text](https://example.com)
+//      \url{https://example.com}         =>  <https://example.com>
+
+func init() {
+	commandConverters["href"] = (*Converter).convertHref
+	commandConverters["url"] = (*Converter).convertURL
+}
+
+func (c *Converter) convertHref() bool {
+	if !c.options.Links {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+	url, ok1 := c.readVerbatimArgument()
+	text, ok2 := c.readArgument()
+	if !ok1 || !ok2 {
+		c.cursor = start
+		return false
+	}
+
+	c.emit("[" + strings.TrimSpace(c.convertFragment(text)) + "](" + unescapeURL(url) + ")")
+	return true
+}
+
+func (c *Converter) convertURL() bool {
+	if !c.options.Links {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	url, ok := c.readVerbatimArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit("<" + unescapeURL(url) + ">")
+	return true
+}
+
+// hyperref allows escaping "#", "%" and friends in URLs
+func unescapeURL(url string) string {
+	return strings.TrimSpace(codeUnescaper.Replace(url))
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	links := Options{Links: true}
+	assert.Equal(t, "<!--\\url{https://example.com}-->", convertWithOptions("\\url{https://example.com}", Options{}))
+	assert.Equal(t, "See <https://example.com/a#b>.", convertWithOptions("See \\url{https://example.com/a\\#b}.", links))
+	assert.Equal(t, "[the $x$ docs](https://example.com/%20)", convertWithOptions("\\href{https://example.com/\\%20}{the $x$ docs}", Options{Links: true, MathPassthrough: true}))
+}
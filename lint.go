@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Warnings about input which is converted but most likely not what was
+// meant. They are not problems, -strict does not fail on them.
+//
+// With Options.CheckLinks, the targets of references, images and included
+// files are checked as well: \ref (and \eqref, \autoref, \pageref, \cref)
+// needs a \label in the document or in the other files of a project,
+// \includegraphics an image and \input and \include a file, relative to the
+// directory of the document. LaTeX in comments is not checked.
+
+// A $ starting inline math which ends on another line, at the $ of a later
+// one. Most likely it is meant as a dollar sign, unless it is followed by a
+// number as in "$5", which is not warned about.
+func (c *Converter) lintDollar(start, end int) {
+	if c.fragment || bytes.IndexByte(c.in[start:end], '\n') < 0 {
+		return
+	}
+	if next := c.at(start + 1); next >= "0" && next <= "9" {
+		return
+	}
+
+	p := c.position(start)
+	c.doc.loneDollars = append(c.doc.loneDollars, p)
+	c.warnAt(p.Line, p.Column, "Lone $ without a closing $ on its line, write \\$ for a dollar sign")
+}
+
+// What the commands checked with Options.CheckLinks refer to
+var linkCommands = map[string]string{
+	"ref":             "label",
+	"eqref":           "label",
+	"autoref":         "label",
+	"pageref":         "label",
+	"cref":            "label",
+	"Cref":            "label",
+	"includegraphics": "image",
+	"input":           "file",
+	"include":         "file",
+}
+
+// A command checked with Options.CheckLinks and its argument
+type link struct {
+	command, target string
+	offset          int
+}
+
+// Warns about references, images and included files whose target does not
+// exist
+func (c *Converter) checkLinks() {
+	if !c.options.CheckLinks || c.fragment {
+		return
+	}
+
+	labels := map[string]bool{}
+	var links []link
+	for _, span := range spans(c.in, Options{}) {
+		if span.Kind == TextSpan || span.Kind == CommentSpan {
+			continue
+		}
+		s := NewConverter(c.in[:span.End], Options{})
+		s.cursor = span.Start
+		for s.skipTo("\\") {
+			offset := s.cursor
+			command := s.commandName()
+			if command != "label" && linkCommands[command] == "" {
+				s.cursor += 1
+				continue
+			}
+			s.skipCommandName()
+			for {
+				if _, ok := s.readOptionalArgument(); !ok {
+					break
+				}
+			}
+			if target, ok := s.readArgument(); !ok {
+				continue
+			} else if command == "label" {
+				labels[strings.TrimSpace(target)] = true
+			} else {
+				links = append(links, link{command, strings.TrimSpace(target), offset})
+			}
+		}
+	}
+
+	dir := c.options.sourceDir
+	for _, l := range links {
+		var found bool
+		switch linkCommands[l.command] {
+		case "label":
+			// \cref{a,b} refers to several labels
+			found = true
+			for _, name := range strings.Split(l.target, ",") {
+				name = strings.TrimSpace(name)
+				if _, external := c.options.externalLabels[name]; !labels[name] && !external {
+					found = false
+				}
+			}
+		case "image":
+			found = strings.Contains(l.target, "://") || fileExists(dir, l.target, imageExtensions)
+		case "file":
+			found = fileExists(dir, l.target, includeExtensions)
+		}
+		if !found {
+			p := c.position(l.offset)
+			c.warnAt(p.Line, p.Column, "\\%s{%s}: %s not found", l.command, l.target, linkCommands[l.command])
+		}
+	}
+}
+
+// Whether the file at |path| in |dir| exists, with one of |extensions|
+func fileExists(dir, path string, extensions []string) bool {
+	for _, extension := range extensions {
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path+extension))); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
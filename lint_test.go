@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoneDollars(t *testing.T) {
+	warnings := func(in string, options Options) []string {
+		c := NewConverter([]byte(in), options)
+		c.Convert()
+		return c.Warnings()
+	}
+
+	lone := "Lone $ without a closing $ on its line, write \\$ for a dollar sign"
+	assert.Equal(t, []string{"1:11: " + lone, "2:13: Unterminated math"}, warnings("It costs 5$ or\nmore, see $x$.", Options{}))
+	assert.Equal(t, []string{"1:3: " + lone}, warnings("a $b\nc$ d", Options{}))
+	assert.Equal(t, []string{"1:2: Unterminated math"}, warnings("A$ b", Options{}))
+
+	// Math on one line, escaped dollars and currency
+	assert.Empty(t, warnings("$x$ and $\\$ y$ and \\$ z", Options{}))
+	assert.Empty(t, warnings("From $5 to\n$10", Options{}))
+
+	// Not in fragments
+	assert.Empty(t, warnings("\\begin{figure}\\includegraphics{a.png}\\caption{5$ and\n$}\\end{figure}", Options{Floats: true}))
+}
+
+func TestCheckLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "chapters"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "chapters", "intro.tex"), nil, 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "plot.png"), nil, 0644))
+
+	in := "See \\ref{eq:a} and \\cref{eq:a, fig:b}.\n\n" +
+		"\\begin{equation}x\\label{eq:a}\\end{equation}\n\n" +
+		"\\includegraphics[width=5cm]{plot} \\includegraphics{missing.png} \\includegraphics{https://example.com/a.png}\n\n" +
+		"\\input{chapters/intro} \\include{chapters/outro}\n\n" +
+		"<!-- \\ref{commented} -->\n"
+	c := NewConverter([]byte(in), Options{CheckLinks: true, sourceDir: dir})
+	c.Convert()
+	assert.Equal(t, []string{
+		"1:20: \\cref{eq:a, fig:b}: label not found",
+		"5:35: \\includegraphics{missing.png}: image not found",
+		"7:24: \\include{chapters/outro}: file not found",
+	}, c.Warnings())
+
+	// Labels of the other files of a project
+	c = NewConverter([]byte("\\ref{fig:b}"), Options{CheckLinks: true, externalLabels: map[string]label{"fig:b": {}}})
+	c.Convert()
+	assert.Empty(t, c.Warnings())
+
+	c = NewConverter([]byte("\\ref{fig:b}"), Options{})
+	c.Convert()
+	assert.Empty(t, c.Warnings())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conversion of itemize, enumerate and description environments to Markdown
+// lists. Nested lists are indented below their item.
+//
+// With Options.Slides, items with a beamer overlay (\item<2->) or lists with
+// [<+->] are annotated to appear one by one as reveal.js fragments.
+
+const fragmentAnnotation = ` <!-- .element: class="fragment" -->`
+
+type listItem struct {
+	label   string
+	overlay string
+	text    string
+}
+
+func init() {
+	environmentConverters["itemize"] = (*Converter).convertList
+	environmentConverters["enumerate"] = (*Converter).convertList
+	environmentConverters["description"] = (*Converter).convertList
+}
+
+func (c *Converter) convertList() bool {
+	if !c.options.Lists {
+		return false
+	}
+
+	start := c.cursor
+	kind := c.environmentName()
+	body, ok := c.readEnvironment()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	list := ByteArrayToConverter([]byte(body))
+	listOptions, _ := list.readOptionalArgument()
+	allFragments := strings.Contains(listOptions, "<+->")
+
+	var lines []string
+	for i, item := range splitItems(string(list.in[list.cursor:])) {
+		marker := "- "
+		if kind == "enumerate" {
+			marker = fmt.Sprintf("%d. ", i+1)
+		}
+
+		text := strings.TrimSpace(c.convertFragment(dedent(item.text)))
+		if kind == "description" && item.label != "" {
+			text = "**" + strings.TrimSpace(c.convertFragment(item.label)) + "** " + text
+		}
+
+		itemLines := strings.Split(text, "\n")
+		if c.options.Slides && (item.overlay != "" || allFragments) {
+			itemLines[0] += fragmentAnnotation
+		}
+
+		lines = append(lines, marker+itemLines[0])
+		for _, line := range itemLines[1:] {
+			if strings.TrimSpace(line) != "" {
+				line = strings.Repeat(" ", len(marker)) + line
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	c.emit(strings.Join(lines, "\n") + c.listEnd())
+	return true
+}
+
+// Returns what ends the list before the input at the cursor: a blank line,
+// unless the input has one already, so the text after it is not taken for
+// a lazy continuation of the last item
+func (c *Converter) listEnd() string {
+	rest := strings.TrimLeft(string(c.in[c.cursor:]), " \t\r")
+	if rest == "" {
+		return ""
+	} else if !strings.HasPrefix(rest, "\n") {
+		return "\n\n"
+	} else if next := strings.TrimLeft(rest[1:], " \t\r"); next == "" || next[0] == '\n' {
+		return ""
+	}
+	return "\n"
+}
+
+// Splits a list body at its \item commands, ignoring the ones of nested lists
+func splitItems(body string) []listItem {
+	var items []listItem
+	var item *listItem
+	itemStart := 0
+
+	finish := func(end int, c *Converter) {
+		if item != nil {
+			item.text = string(c.in[itemStart:end])
+			items = append(items, *item)
+		}
+	}
+
+	c := ByteArrayToConverter([]byte(body))
+	for !c.atEof() {
+		if c.environmentName() != "" {
+			if _, ok := c.readEnvironment(); ok {
+				continue
+			}
+		}
+		if c.commandName() != "item" {
+			c.cursor += 1
+			continue
+		}
+
+		finish(c.cursor, &c)
+		c.skipCommandName()
+		overlay, _ := c.readGroup('<', '>')
+		label, _ := c.readOptionalArgument()
+		item = &listItem{label: label, overlay: overlay}
+		itemStart = c.cursor
+	}
+	finish(c.cursor, &c)
+
+	return items
+}
+
+// Removes the indentation of all lines, which in LaTeX is meaningless but in
+// Markdown would change the list structure
+func dedent(tex string) string {
+	lines := strings.Split(tex, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestListConversion(t *testing.T) {
+	lists := Options{Lists: true}
+
+	input := `\begin{itemize}
+  \item One
+  \item Two
+    \begin{enumerate}
+      \item Nested
+      \item<2-> Overlay
+    \end{enumerate}
+\end{itemize}`
+	expected := "- One\n- Two\n  1. Nested\n  2. Overlay"
+	assert.Equal(t, expected, convertWithOptions(input, lists))
+
+	input = "\\begin{description}\\item[Term] Definition\\end{description}"
+	assert.Equal(t, "- **Term** Definition", convertWithOptions(input, lists))
+
+	// Text right after the list is not part of its last item
+	assert.Equal(t, "- A\n- B\n\nOnly two", convertWithOptions("\\begin{itemize}\\item A\\item B\n\\end{itemize}\nOnly two", lists))
+	assert.Equal(t, "- A\n\n Only one", convertWithOptions("\\begin{itemize}\\item A\\end{itemize} Only one", lists))
+	assert.Equal(t, "- A\n\nOnly one", convertWithOptions("\\begin{itemize}\\item A\\end{itemize}\n\nOnly one", lists))
+}
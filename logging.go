@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logging of what the converter does to Options.Logger, for applications
+// embedding it. Warnings are logged at slog.LevelWarn, how the input is
+// classified and how the converter recovers from problems with it at
+// slog.LevelDebug and the handlers taking care of the input at LevelTrace,
+// e.g.
+//
+//      level=DEBUG msg="Classified span" kind=math line=3 column=12
+//
+// Positions are only known for the top level document, events of fragments
+// (e.g. captions) are logged with fragment=true instead.
+
+// The level of the most verbose events, below slog.LevelDebug
+const LevelTrace = slog.LevelDebug - 4
+
+// Logs |msg| about the input at |position| (a byte offset)
+func (c *Converter) log(level slog.Level, position int, msg string, args ...interface{}) {
+	logger := c.options.Logger
+	if logger == nil || !logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	if c.fragment {
+		args = append(args, "fragment", true)
+	} else {
+		if position > c.inputLength {
+			position = c.inputLength
+		}
+		p := c.position(position)
+		args = append(args, "line", p.Line, "column", p.Column)
+	}
+	logger.Log(context.Background(), level, msg, args...)
+}
+
+// Logs that the input at |start| is of |kind|
+func (c *Converter) logSpan(kind SpanKind, start int, args ...interface{}) {
+	c.log(slog.LevelDebug, start, "Classified span", append([]interface{}{"kind", string(kind)}, args...)...)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func logOptions(level slog.Level) (Options, *bytes.Buffer) {
+	var log bytes.Buffer
+	handler := slog.NewTextHandler(&log, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return Options{Logger: slog.New(handler)}, &log
+}
+
+func TestLogSpans(t *testing.T) {
+	options, log := logOptions(slog.LevelDebug)
+	convertWithOptions("a $x$\n\\foo{b} <!--c-->\n\\begin{tikzpicture}\\end{tikzpicture}", options)
+
+	assert.Equal(t, []string{
+		`level=DEBUG msg="Classified span" kind=math line=1 column=3`,
+		`level=DEBUG msg="Classified span" kind=latex-command line=2 column=1`,
+		`level=DEBUG msg="Classified span" kind=comment line=2 column=9`,
+		`level=DEBUG msg="Classified span" kind=latex-env environment=tikzpicture line=3 column=1`,
+	}, strings.Split(strings.TrimSpace(log.String()), "\n"))
+}
+
+func TestLogRecovery(t *testing.T) {
+	options, log := logOptions(slog.LevelDebug)
+	convertWithOptions("a $x", options)
+	assert.Contains(t, log.String(), `level=WARN msg="Unterminated math" line=1 column=3`)
+	assert.Contains(t, log.String(), `level=DEBUG msg="Treating the rest of the input as math" line=1 column=3`)
+}
+
+func TestLogHandlers(t *testing.T) {
+	options, log := logOptions(LevelTrace)
+	options.Links = true
+	convertWithOptions("\\url{x} \\todo{y}", options)
+	assert.Contains(t, log.String(), `msg="Converting command" command=url line=1 column=1`)
+
+	// Nothing but warnings by default
+	options, log = logOptions(slog.LevelInfo)
+	convertWithOptions("\\url{x} $x", options)
+	assert.Equal(t, `level=WARN msg="Unterminated math" line=1 column=9`, strings.TrimSpace(log.String()))
+}
+
+func TestLogFragments(t *testing.T) {
+	options, log := logOptions(slog.LevelDebug)
+	options.Floats = true
+	convertWithOptions("\\begin{figure}\\includegraphics{a.png}\\caption{$x$}\\end{figure}", options)
+	assert.Equal(t, `level=DEBUG msg="Classified span" kind=math fragment=true`, strings.TrimSpace(log.String()))
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Expansion of commands and environments defined in the document, i.e. with
+//
+//      \newcommand{\R}{\mathbb{R}}
+//      \def\pair#1#2{(#1, #2)}
+//      \newenvironment{remark}[1][Remark]{\textbf{#1:} }{ \qed}
+//
+// the use \begin{remark}[Note] Text \end{remark} becomes
+// "\textbf{Note:}  Text  \qed" which is then converted as usual. The
+// definitions themselves are left in place. \def with delimited parameters
+// (\def\foo#1.{...}) is not supported, nor are uses inside math expanded,
+// math is left to MathJax or LaTeX which know the definitions as well.
+
+// Bound for expansions within expansions, in case of recursive definitions
+const maxExpansions = 1000
+
+// Bound for all expansions of a document, definitions expanding to several
+// uses of themselves (\def\a{\a\a}) would take forever within the bound
+// above: this many and a few for each byte of the input, so a runaway
+// expansion fails fast. Uses are wrapped once it is reached.
+const (
+	minTotalExpansions = 1000
+	expansionsPerByte  = 10
+)
+
+type definition struct {
+	arguments int
+
+	// Default of the first argument which is optional if given
+	optional    string
+	hasOptional bool
+
+	// Environments have code before and after their body
+	before string
+	after  string
+}
+
+// Collects all definitions in the input
+func (c *Converter) collectDefinitions() {
+	// Chunks add to the definitions of the chunks before them
+	if c.doc.commands == nil {
+		c.doc.commands = map[string]definition{}
+		c.doc.environments = map[string]definition{}
+		c.doc.expansionBudget = minTotalExpansions
+	}
+	c.doc.expansionBudget += expansionsPerByte * c.inputLength
+
+	d := ByteArrayToConverter([]byte(string(c.in)))
+	for !d.atEof() {
+		switch d.commandName() {
+		case "newcommand", "renewcommand", "providecommand":
+			d.skipCommandName()
+			d.readDefinition(c.doc.commands, false)
+		case "def":
+			d.skipCommandName()
+			d.readDef(c.doc.commands)
+		case "newenvironment", "renewenvironment":
+			d.skipCommandName()
+			d.readDefinition(c.doc.environments, true)
+		default:
+			d.cursor += 1
+		}
+	}
+}
+
+// Reads {name}[arguments][optional]{before}{after} and adds it to |definitions|.
+// Commands only have {name} and one body, which goes to "before".
+func (c *Converter) readDefinition(definitions map[string]definition, environment bool) {
+	if !c.atEof() && c.current() == "*" {
+		c.cursor += 1
+	}
+
+	name, ok := c.readArgument()
+	if !ok && !environment && c.commandName() != "" {
+		// \newcommand\foo{...}
+		name, ok = "\\"+c.commandName(), true
+		c.skipCommandName()
+	}
+	if !ok {
+		return
+	}
+
+	var d definition
+	if arguments, ok := c.readOptionalArgument(); ok {
+		d.arguments, _ = strconv.Atoi(strings.TrimSpace(arguments))
+	}
+	d.optional, d.hasOptional = c.readOptionalArgument()
+
+	if d.before, ok = c.readArgument(); !ok {
+		return
+	}
+	if environment {
+		if d.after, ok = c.readArgument(); !ok {
+			return
+		}
+	}
+
+	definitions[strings.TrimPrefix(strings.TrimSpace(name), "\\")] = d
+}
+
+// Reads \foo#1#2{body} after a \def and adds it to |definitions|
+func (c *Converter) readDef(definitions map[string]definition) {
+	name := c.commandName()
+	if name == "" {
+		return
+	}
+	c.skipCommandName()
+
+	var d definition
+	for !c.atEof() && c.current() == "#" && c.lookahead(1) == strconv.Itoa(d.arguments+1) {
+		d.arguments += 1
+		c.cursor += 2
+	}
+
+	var ok bool
+	if d.before, ok = c.readArgument(); ok {
+		definitions[name] = d
+	}
+}
+
+// Reads the arguments of a use of |d| and returns them
+func (c *Converter) readDefinitionArguments(d definition) ([]string, bool) {
+	var arguments []string
+	for i := 0; i < d.arguments; i++ {
+		if i == 0 && d.hasOptional {
+			argument, ok := c.readOptionalArgument()
+			if !ok {
+				argument = d.optional
+			}
+			arguments = append(arguments, argument)
+			continue
+		}
+
+		argument, ok := c.readArgument()
+		if !ok {
+			return nil, false
+		}
+		arguments = append(arguments, argument)
+	}
+	return arguments, true
+}
+
+// Replaces #1, #2, ... with |arguments|
+func substituteArguments(code string, arguments []string) string {
+	for i := len(arguments); i > 0; i-- {
+		code = strings.Replace(code, "#"+strconv.Itoa(i), arguments[i-1], -1)
+	}
+	return code
+}
+
+func (c *Converter) expandCommand() bool {
+	if !c.options.Expand || c.doc.expansions >= maxExpansions || !c.expansionBudgetLeft() {
+		return false
+	}
+
+	d, ok := c.doc.commands[c.commandName()]
+	if !ok {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	arguments, ok := c.readDefinitionArguments(d)
+	if !ok {
+		c.cursor = start
+		return false
+	}
+	if d.arguments == 0 {
+		c.skipCommandTerminator()
+	}
+
+	c.doc.expansions += 1
+	c.doc.expanded += 1
+	c.emit(c.convertFragment(substituteArguments(d.before, arguments)))
+	c.doc.expansions -= 1
+	return true
+}
+
+func (c *Converter) expandEnvironment() bool {
+	if !c.options.Expand || c.doc.expansions >= maxExpansions || !c.expansionBudgetLeft() {
+		return false
+	}
+
+	d, ok := c.doc.environments[c.environmentName()]
+	if !ok {
+		return false
+	}
+
+	start := c.cursor
+	body, ok := c.readEnvironment()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	use := ByteArrayToConverter([]byte(body))
+	arguments, ok := use.readDefinitionArguments(d)
+	if !ok {
+		c.cursor = start
+		return false
+	}
+	body = string(use.in[use.cursor:])
+
+	c.doc.expansions += 1
+	c.doc.expanded += 1
+	c.emit(c.convertFragment(substituteArguments(d.before, arguments) + body + d.after))
+	c.doc.expansions -= 1
+	return true
+}
+
+// Checks that the document has not used up its expansions, warning once it
+// has
+func (c *Converter) expansionBudgetLeft() bool {
+	if c.doc.expanded < c.doc.expansionBudget {
+		return true
+	}
+	if c.doc.expanded == c.doc.expansionBudget {
+		c.doc.expanded += 1
+		c.warn("Stopped expanding definitions after %d expansions", c.doc.expansionBudget)
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnvironmentExpansion(t *testing.T) {
+	expand := Options{Expand: true, Formatting: true, Lists: true}
+
+	input := `\newenvironment{remark}[1][Remark]{\underline{#1:}}{}
+\begin{remark}[Note] Fast.\end{remark}
+\begin{remark} Slow.\end{remark}`
+	expected := `<!--\newenvironment{remark}[1][Remark]{\underline{#1:}}{}-->
+<u>Note:</u> Fast.
+<u>Remark:</u> Slow.`
+	assert.Equal(t, expected, convertWithOptions(input, expand))
+
+	// Nesting of the same custom environment
+	input = "\\newenvironment{steps}{\\begin{enumerate}}{\\end{enumerate}}" +
+		"\\begin{steps}\\item A\n\\begin{steps}\\item B\\end{steps}\\end{steps}"
+	expected = "<!--\\newenvironment{steps}{\\begin{enumerate}}{\\end{enumerate}}-->1. A\n   1. B"
+	assert.Equal(t, expected, convertWithOptions(input, expand))
+
+	// Without -expand, uses are wrapped as before
+	input = "\\newenvironment{x}{a}{b}\\begin{x}c\\end{x}"
+	assert.Equal(t, "<!--\\newenvironment{x}{a}{b}--><!--\\begin{x}c\\end{x}-->", convertWithOptions(input, Options{}))
+}
+
+func TestCommandExpansion(t *testing.T) {
+	expand := Options{Expand: true, Formatting: true, MathPassthrough: true}
+
+	input := "\\newcommand{\\name}{\\underline{merkderwn}}\\newcommand\\sq[1]{$#1^2$}" +
+		"\\def\\pair#1#2{(#1, #2)}\n" +
+		"\\name{} squares \\sq{x} in \\pair{a}{b}."
+	expected := "<!--\\newcommand{\\name}{\\underline{merkderwn}}--><!--\\newcommand\\sq[1]{$#1^2$}-->" +
+		"<!--\\def\\pair#1#2{(#1, #2)}-->\n" +
+		"<u>merkderwn</u> squares $x^2$ in (a, b)."
+	assert.Equal(t, expected, convertWithOptions(input, expand))
+
+	// Recursive definitions end up wrapped eventually
+	assert.Contains(t, convertWithOptions("\\def\\loop{\\loop}\\loop", expand), "<!--\\loop-->")
+
+	// As are definitions which would take forever to expand
+	c := NewConverter([]byte("\\def\\a{\\a\\a}\\a"), expand)
+	assert.Contains(t, string(c.Convert()), "<!--\\a-->")
+	assert.Equal(t, []string{"Stopped expanding definitions after 1140 expansions"}, c.Warnings())
+
+	// Math is left as it is
+	assert.Equal(t, "<!--\\newcommand{\\R}{\\mathbb{R}}--> $\\R$", convertWithOptions("\\newcommand{\\R}{\\mathbb{R}} $\\R$", expand))
+}
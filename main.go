@@ -1,23 +1,360 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"log/slog"
 	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 )
 
+// Options enable conversions that go beyond wrapping LaTeX in comments. The
+// zero value only wraps LaTeX in comments, except for what wrapping would
+// corrupt, see "Changes to the default output" in the README: \verb and
+// \lstinline become code spans, \(...\) and \[...\] are math with the
+// environments in them and metadata and front matter are copied as they are.
+type Options struct {
+	// Convert siunitx commands (\SI, \num, ...) to plain text
+	Units bool
+
+	// Leave math as is for MathJax instead of hiding it in comments
+	MathPassthrough bool
+
+	// Delimiters of passed through math: "dollars" ($x$, $$x$$, the default),
+	// "latex" (\(x\), \[x\]) or Confluence's "confluence" math macros
+	MathDelimiters string
+
+	// Convert math to Unicode text, e.g. \alpha^2 to α², for targets without
+	// math rendering
+	UnicodeMath bool
+
+	// Render math to images of this format ("svg") in AssetsDir, with the
+	// shell command RenderCommand or with latex and dvisvgm, see render.go
+	RenderMath    string
+	AssetsDir     string
+	RenderCommand string
+
+	// With RenderMath, embed the images as data URIs instead of linking them
+	InlineMathImages bool
+
+	// Copy the images of the document into this directory and link the
+	// copies instead, see images.go
+	CollectAssets string
+
+	// Compile the math with TexCommand (or pdflatex) and warn about errors
+	ValidateLatex bool
+	TexCommand    string
+
+	// Warn about references, images and included files whose target does
+	// not exist, see lint.go
+	CheckLinks bool
+
+	// Escape &, < and > in text and math, for targets that take HTML
+	EscapeHTML bool
+
+	// Escape &, <, > and "--" in the LaTeX wrapped in comments, so they are
+	// well-formed (X)HTML. MultiMarkdown copies comments as they are, so
+	// this changes the LaTeX it writes.
+	EscapeComments bool
+
+	// How to wrap LaTeX that is not converted: in HTML "comment"s (the
+	// default), in Confluence "noformat" blocks, as "pandoc-raw" LaTeX or
+	// "drop" it altogether
+	Wrap string
+
+	// With MathPassthrough, split environments at \intertext and emit its text
+	// as a paragraph instead of leaving it to MathJax
+	LiftIntertext bool
+
+	// Number labeled display equations and resolve \ref, for renderers that
+	// do not number equations themselves
+	NumberEquations bool
+
+	// Convert figure and table environments to Markdown images and tables
+	Floats bool
+
+	// Replace \listoffigures and \listoftables with lists of links to the
+	// converted figures and tables
+	ListOfFloats bool
+
+	// Convert sectioning commands (\section, \subsection, ...) to headings
+	Headings bool
+
+	// Make converted headings and the Markdown headings of the input this
+	// many levels lower (higher if negative), see headings.go
+	ShiftHeadings int
+
+	// How the renderer makes anchors for headings, which \ref to their
+	// \label links to: "github" (the default) or "pandoc", see slugs.go
+	Slugs string
+
+	// Convert itemize, enumerate and description environments to lists
+	Lists bool
+
+	// Copy wiki links and embeds ([[Note]], ![[image.png]]) as they are,
+	// for Obsidian and wikis, instead of taking them for optional arguments
+	// of a command before them
+	WikiLinks bool
+
+	// Convert beamer frames to slides separated by "---"
+	Slides bool
+
+	// What to do with \index{term}: "drop" it, keep it as invisible "anchor"
+	// or "generate" an index at the end. Wrapped in a comment otherwise.
+	Index string
+
+	// Convert \marginpar and \marginnote to "aside" elements or "footnote"s
+	MarginNotes string
+
+	// Convert text formatting commands (\fbox, ...) to Markdown or HTML
+	Formatting bool
+
+	// Highlight with ==text== instead of <mark>, for renderers supporting it
+	EqualsHighlights bool
+
+	// Replace \today with Date (or the current date if zero) in DateFormat
+	// (or "January 2, 2006" if empty)
+	Today      bool
+	Date       time.Time
+	DateFormat string
+
+	// Replace logos like \LaTeX with plain text
+	Logos bool
+
+	// What to do with content guarded by \iffalse ... \fi and friends: "drop"
+	// it or "keep" it. Either way the conditional itself is removed.
+	Conditionals string
+
+	// Convert hyperref's \href and \url to Markdown links
+	Links bool
+
+	// Enable the conversions for the packages loaded with \usepackage
+	DetectPackages bool
+
+	// Expand uses of commands and environments defined in the document
+	Expand bool
+
+	// The marker of text to copy as it is, "md" for <!--md-->...<!--/md-->
+	// if empty
+	LiteralMarker string
+
+	// Rules rewriting the paths of images, from=to pairs separated by
+	// commas, see images.go
+	RewriteImages string
+
+	// Make the output depend on nothing but the input and the options, see
+	// reproducible.go
+	Reproducible bool
+
+	// Make Convert fail on problems with the input, see errors.go
+	Strict bool
+
+	// Give up converting after this long, see Converter.Err
+	Timeout time.Duration
+
+	// Writes text, math and the LaTeX which is not converted. The default
+	// does what the options above say, see renderer.go
+	Renderer Renderer
+
+	// Gets warnings and debug events if not nil, see logging.go
+	Logger *slog.Logger
+
+	// Called with the statistics of every document converted by Convert and
+	// the error it returns, e.g. Metrics.Add
+	OnConvert func(Stats, error)
+
+	// Labels defined in other files, \ref falls back to them
+	externalLabels map[string]label
+
+	// The directory of the document, images are collected relative to it
+	sourceDir string
+
+	// In a project, the numbers before the file, the numbers taken up by
+	// the files it includes, or a function converting them, see includes.go
+	numbersBefore   counters
+	includedNumbers map[string]counters
+	includeFile     func(include string, before counters) counters
+}
+
+// Checks that the modes given as strings are known
+func (options Options) validate() error {
+	if options.Index != "" && !validIndexMode(options.Index) {
+		return fmt.Errorf("Unknown index mode %s, expected one of: drop, anchor, generate", options.Index)
+	}
+
+	if options.MarginNotes != "" && options.MarginNotes != "aside" && options.MarginNotes != "footnote" {
+		return fmt.Errorf("Unknown margin note style %s, expected one of: aside, footnote", options.MarginNotes)
+	}
+
+	if options.MathDelimiters != "" && options.MathDelimiters != "dollars" && options.MathDelimiters != "latex" && options.MathDelimiters != "confluence" {
+		return fmt.Errorf("Unknown math delimiters %s, expected one of: dollars, latex, confluence", options.MathDelimiters)
+	}
+
+	if options.RenderMath != "" && options.RenderMath != "svg" {
+		return fmt.Errorf("Unknown math image format %s, expected one of: svg", options.RenderMath)
+	}
+
+	if options.Wrap != "" && options.Wrap != "comment" && options.Wrap != "noformat" && options.Wrap != "pandoc-raw" && options.Wrap != "drop" {
+		return fmt.Errorf("Unknown wrap style %s, expected one of: comment, noformat, pandoc-raw, drop", options.Wrap)
+	}
+
+	if _, ok := slugStyles[options.Slugs]; options.Slugs != "" && !ok {
+		return fmt.Errorf("Unknown slug style %s, expected one of: github, pandoc", options.Slugs)
+	}
+
+	if options.Conditionals != "" && options.Conditionals != "drop" && options.Conditionals != "keep" {
+		return fmt.Errorf("Unknown conditional mode %s, expected one of: drop, keep", options.Conditionals)
+	}
+
+	if _, err := imageRewrites(options.RewriteImages); err != nil {
+		return err
+	}
+
+	if options.Reproducible {
+		return options.reproducible()
+	}
+	return nil
+}
+
 type Converter struct {
 	inputLength int
 
+	// A byte offset into the input. All syntax is ASCII, which never occurs
+	// inside multi-byte UTF-8 characters, so most of the scanning does not
+	// care about characters.
 	cursor int
 
-	in  []rune
+	in  []byte
 	out *bytes.Buffer
+
+	options Options
+
+	// State shared with the converters of fragments, see convertFragment
+	doc *document
+
+	// Fragments are part of another document which takes care of finishing
+	// the output, see Convert
+	fragment bool
+
+	// The position asked for last, in the input of the converter, see
+	// position
+	lastPosition Position
+
+	// Where the lines checked for Markdown constructs end, see markdown.go,
+	// and the lines checked for code fences, see headings.go
+	linesChecked  int
+	fencesChecked int
+}
+
+// State concerning the whole document
+type document struct {
+	// Converted figures and tables, for the lists of figures and tables,
+	// numbered after those in the files before, see includes.go
+	figures       []float
+	tables        []float
+	figuresBefore int
+	tablesBefore  int
+
+	// State of the heading conversion, see headings.go
+	headings headingState
+
+	// Collected \index entries
+	indexEntries []indexEntry
+
+	// Footnote definitions to append to the document
+	footnotes []string
+
+	// Commands and environments defined in the document, see macros.go
+	commands     map[string]definition
+	environments map[string]definition
+	expansions   int
+	expanded     int
+
+	// Expansions left for the document, see expansionsPerByte
+	expansionBudget int
+
+	// Macros defined so far, for \ifdefined, see conditionals.go
+	defined map[string]bool
+
+	// Number of the last numbered equation, see equations.go
+	equations    int
+	explicitTags bool
+
+	// Whether a slide was emitted, see slides.go
+	slides bool
+
+	// The fence of the code block the lines checked for code fences are in,
+	// nil if they are not, see headings.go
+	fence []byte
+
+	// Everything \ref can refer to, see references.go
+	labels map[string]label
+
+	// How often each anchor was generated, see reproducible.go, and each
+	// anchor of a heading, see slugs.go
+	anchors map[string]int
+	slugs   map[string]int
+
+	// Problems which did not stop the conversion, see Converter.Warnings
+	warnings []Warning
+
+	// Math to validate, see validate.go
+	math []mathSpan
+
+	// Problems with the input, see errors.go, and lone dollar signs, see
+	// lint.go
+	problems    []*PositionError
+	invalid     *PositionError
+	loneDollars []Position
+
+	// Counted while converting, see Report
+	stats Stats
+
+	// When to give up converting, with Options.Timeout. err is ErrTimeout
+	// once it is reached.
+	deadline time.Time
+	steps    int
+	err      error
+
+	// Converted in chunks, which start at this byte offset and after this
+	// many lines of the input. Their output is finished by ConvertChunked.
+	chunked      bool
+	offset, line int
+}
+
+// Returned by Converter.Err if the conversion took longer than Options.Timeout
+var ErrTimeout = errors.New("Conversion timed out")
+
+// A problem at a position of the input (lines and columns start at 1), or of
+// the whole input if Line is 0
+type Warning struct {
+	Line, Column int
+	Message      string
+}
+
+func (w Warning) String() string {
+	if w.Line == 0 {
+		return w.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", w.Line, w.Column, w.Message)
+}
+
+// Formats the warning for |file|, like "notes.xmd:3:6: message"
+func (w Warning) in(file string) string {
+	if w.Line == 0 {
+		return file + ": " + w.Message
+	}
+	return file + ":" + w.String()
 }
 
 /* Methods that operate on the input */
@@ -27,41 +364,194 @@ func (c *Converter) atEof() bool {
 	return c.cursor >= c.inputLength
 }
 
-// Returns the character at the given cursor
+// Returns the character starting at the given cursor, or "" inside of a
+// multi-byte character. Loops moving the cursor byte by byte thus see every
+// character once.
 func (c *Converter) at(cursor int) string {
-	return string(c.in[cursor])
+	if b := c.in[cursor]; b < utf8.RuneSelf {
+		return string(c.in[cursor : cursor+1])
+	} else if !utf8.RuneStart(b) {
+		return ""
+	}
+	_, size := utf8.DecodeRune(c.in[cursor:])
+	return string(c.in[cursor : cursor+size])
 }
 
-// Returns the character at the cursor
+// Returns the character at the cursor, see "at"
 func (c *Converter) current() string {
-	return string(c.in[c.cursor])
+	return c.at(c.cursor)
 }
 
-// Returns the next character after the cursor
+// Returns the next character after the cursor, or "" at the end of the input
 func (c *Converter) next() string {
-	return string(c.in[c.cursor+1])
+	return c.lookahead(1)
 }
 
-// Returns the next character after the cursor
+// Returns the character before the cursor
 func (c *Converter) prev() string {
-	return string(c.in[c.cursor-1])
+	_, size := utf8.DecodeLastRune(c.in[:c.cursor])
+	return string(c.in[c.cursor-size : c.cursor])
 }
 
-// Returns the next |n| characters after the cursor (i.e. excluding "current()")
+// Returns the next |n| bytes after the cursor (i.e. excluding "current()").
+// Returns less than |n| bytes if the input ends before.
 func (c *Converter) lookahead(n int) string {
-	return string(c.in[c.cursor+1 : c.cursor+1+n])
+	return c.lookaheadAt(n, c.cursor)
 }
 
 // Same as "lookahead" with a given cursor
 func (c *Converter) lookaheadAt(n int, cursor int) string {
-	return string(c.in[cursor+1 : cursor+1+n])
+	end := cursor + 1 + n
+	if end > c.inputLength {
+		end = c.inputLength
+	}
+	return string(c.in[cursor+1 : end])
+}
+
+// Moves the cursor to the next |s| or the end of the input if there is none.
+// Returns whether |s| was found.
+func (c *Converter) skipTo(s string) bool {
+	if c.atEof() {
+		return false
+	}
+	i := bytes.Index(c.in[c.cursor:], []byte(s))
+	if i < 0 {
+		c.cursor = c.inputLength
+		return false
+	}
+	c.cursor += i
+	return true
 }
 
-// Returns the previous |n| characters before the cursor (i.e. excluding "current()")
+// Returns the previous |n| bytes before the cursor (i.e. excluding "current()")
 func (c *Converter) lookback(n int) string {
 	return string(c.in[c.cursor-n : c.cursor])
 }
 
+// Returns the name of the command at the cursor, e.g. "SI" for "\SI{1}{\meter}",
+// or "" if there is no command at the cursor.
+func (c *Converter) commandName() string {
+	if c.atEof() || c.current() != "\\" {
+		return ""
+	}
+	end := c.cursor + 1
+	for end < c.inputLength {
+		r, size := utf8.DecodeRune(c.in[end:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		end += size
+	}
+	return string(c.in[c.cursor+1 : end])
+}
+
+// Moves the cursor past the command name at the cursor
+func (c *Converter) skipCommandName() {
+	c.cursor += 1 + len(c.commandName())
+}
+
+// Skips the "{}" or space which end commands without arguments, as in
+// "\today{}" or "\LaTeX\ is"
+func (c *Converter) skipCommandTerminator() {
+	if !c.atEof() && c.current() == "{" && c.lookahead(1) == "}" {
+		c.cursor += 2
+	} else if !c.atEof() && c.current() == "\\" && c.lookahead(1) == " " {
+		c.cursor += 1
+	}
+}
+
+// Reads a balanced group delimited by |open| and |close| at the cursor and
+// returns its content, moving the cursor past the closing delimiter. If there
+// is no complete group at the cursor, the cursor stays where it is.
+func (c *Converter) readGroup(open, close byte) (string, bool) {
+	if c.atEof() || c.in[c.cursor] != open {
+		return "", false
+	}
+
+	nesting := 0
+	for end := c.cursor; end < c.inputLength; end++ {
+		switch c.in[end] {
+		case '\\':
+			end += 1 // Skip escaped characters like \{
+		case open:
+			nesting += 1
+		case close:
+			nesting -= 1
+		}
+
+		if nesting == 0 {
+			content := string(c.in[c.cursor+1 : end])
+			c.cursor = end + 1
+			return content, true
+		}
+	}
+
+	return "", false
+}
+
+// Reads a mandatory {argument} at the cursor, see readGroup
+func (c *Converter) readArgument() (string, bool) {
+	return c.readGroup('{', '}')
+}
+
+// Reads an [optional] argument at the cursor, see readGroup
+func (c *Converter) readOptionalArgument() (string, bool) {
+	return c.readGroup('[', ']')
+}
+
+// Returns the name of the environment started at the cursor, e.g. "figure" for
+// "\begin{figure}", or "" if no environment starts at the cursor.
+func (c *Converter) environmentName() string {
+	if c.commandName() != "begin" {
+		return ""
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	name, _ := c.readArgument()
+	c.cursor = start
+
+	return name
+}
+
+// Reads the environment started at the cursor up to its matching \end and
+// returns its body, moving the cursor past the \end{...}. If the environment
+// is never closed, the cursor stays where it is.
+func (c *Converter) readEnvironment() (string, bool) {
+	name := c.environmentName()
+	start := c.cursor
+
+	c.skipCommandName()
+	c.readArgument()
+	bodyStart := c.cursor
+
+	nesting := 1
+	for !c.atEof() {
+		command := c.commandName()
+		if command != "begin" && command != "end" {
+			c.cursor += 1
+			continue
+		}
+
+		bodyEnd := c.cursor
+		c.skipCommandName()
+		if argument, ok := c.readArgument(); ok && argument == name {
+			if command == "begin" {
+				nesting += 1
+			} else {
+				nesting -= 1
+			}
+		}
+
+		if nesting == 0 {
+			return string(c.in[bodyStart:bodyEnd]), true
+		}
+	}
+
+	c.cursor = start
+	return "", false
+}
+
 /* Methods that operate on the output */
 
 // Writes a string to the output buffer
@@ -69,42 +559,133 @@ func (c *Converter) emit(s string) {
 	c.out.WriteString(s)
 }
 
+// Converts a piece of LaTeX taken from a converted command or environment
+// (captions, table cells, ...) with the same options
+func (c *Converter) convertFragment(tex string) string {
+	fragment := NewConverter([]byte(tex), c.options)
+	fragment.doc = c.doc
+	fragment.fragment = true
+	return string(fragment.Convert())
+}
+
 /* Parsing \o/ */
 
-// Everything inside an HTML comment is considered to be Latex and thus emitted 1:1
+// Everything inside an HTML comment is considered to be Latex and thus emitted
+// 1:1, see Renderer.EmitComment
 func (c *Converter) handleComments() bool {
 	if c.current() != "<" || c.lookahead(3) != "!--" {
 		return false
 	}
 
-	for !c.atEof() && (c.current() != "-" || c.lookahead(2) != "->") {
-		c.emit(c.current())
-		c.cursor += 1
+	c.cursor += 4
+	start := c.cursor
+	c.skipTo("-->")
+	c.logSpan(CommentSpan, start-4)
+	if problem, ok := invalidComment(string(c.in[start:c.cursor])); ok && !c.fragment {
+		p := c.position(start - 4)
+		c.warnAt(p.Line, p.Column, "HTML comment %s, which is not valid HTML", problem)
 	}
-	c.emit("-->")
+	c.doc.stats.Comments += 1
+	c.renderer().EmitComment(c.out, string(c.in[start:c.cursor]))
 	c.cursor += 3
 
 	return true
 }
 
+// An inline HTML tag, as CommonMark defines them
+var htmlTagRegexp = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*` +
+	`(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>` +
+	`|</[A-Za-z][A-Za-z0-9-]*\s*>)`)
+
+// HTML tags are text, so that their attribute values are not taken for math
+// or LaTeX, e.g. <img alt="price $5">
+func (c *Converter) handleHTMLTag() bool {
+	if c.current() != "<" || c.inputLength-c.cursor < 3 {
+		return false
+	}
+	if next := c.in[c.cursor+1]; next != '/' && !('a' <= next|0x20 && next|0x20 <= 'z') {
+		return false
+	}
+
+	match := htmlTagRegexp.FindIndex(c.in[c.cursor:])
+	if match == nil {
+		return false
+	}
+	c.emitInput(c.cursor + match[1])
+	return true
+}
+
 // CDATA blocks are comments which are completely dropped from the output
 func (c *Converter) handleCDATA() bool {
 	if c.current() != "<" || c.lookahead(8) != "![CDATA[" {
 		return false
 	}
 
-	for !c.atEof() && (c.current() != "]" || c.lookahead(2) != "]>") {
-		c.cursor += 1
-	}
+	c.skipTo("]]>")
 	c.cursor += 3 // For ]]>
 
 	return true
 }
 
+// Converters for individual commands, keyed by command name. A converter is
+// called with the cursor on the backslash and returns false if it does not
+// convert the command after all, in which case it must not move the cursor.
+var commandConverters = map[string]func(c *Converter) bool{}
+
+func (c *Converter) handleConvertibleCommand() bool {
+	if c.expandCommand() {
+		return true
+	}
+
+	name := c.commandName()
+	convert, ok := commandConverters[name]
+	if !ok {
+		return false
+	}
+
+	c.log(LevelTrace, c.cursor, "Converting command", "command", name)
+	if convert(c) {
+		c.doc.stats.Converted += 1
+		return true
+	}
+	c.log(slog.LevelDebug, c.cursor, "Declined to convert command", "command", name)
+	return false
+}
+
+// Converters for environments, keyed by environment name. Same rules as for
+// commandConverters, the cursor is on the "\begin".
+var environmentConverters = map[string]func(c *Converter) bool{}
+
+func (c *Converter) handleConvertibleEnvironment() bool {
+	name := c.environmentName()
+	if convert, ok := environmentConverters[name]; ok {
+		c.log(LevelTrace, c.cursor, "Converting environment", "environment", name)
+		if convert(c) {
+			c.doc.stats.Converted += 1
+			return true
+		}
+		c.log(slog.LevelDebug, c.cursor, "Declined to convert environment", "environment", name)
+	}
+	return c.expandEnvironment()
+}
+
 func (c *Converter) handleLatex() bool {
 	if c.current() == "\\" && c.next() != "\\" {
+		if c.handleConvertibleCommand() {
+			return true
+		}
+
 		if c.lookahead(5) == "begin" {
+			if c.handlePrefixedEnvironment() || c.handleConvertibleEnvironment() {
+				return true
+			}
+			start, name := c.cursor, c.environmentName()
 			c.handleLatexBlock()
+			if isDisplayMathEnvironment(strings.TrimSuffix(name, "*")) {
+				c.recordMath(start)
+			} else {
+				c.logSpan(EnvironmentSpan, start, "environment", name)
+			}
 		} else {
 			c.handleLatexCommand(true)
 		}
@@ -114,19 +695,14 @@ func (c *Converter) handleLatex() bool {
 }
 
 func (c *Converter) handleLatexCommand(emitCommentBlock bool) {
-	spaceRegexp := regexp.MustCompile("\\s")
-
-	if emitCommentBlock {
-		c.emit("<!--")
-	}
+	start := c.cursor
 
 	// The command name
 	for !c.atEof() &&
 		c.current() != "{" &&
 		c.current() != "[" &&
-		!spaceRegexp.MatchString(c.current()) {
+		!c.atNameEnd() {
 
-		c.emit(c.current())
 		c.cursor += 1
 	}
 
@@ -135,10 +711,22 @@ func (c *Converter) handleLatexCommand(emitCommentBlock bool) {
 		// All parameters are closed and there is no next parameter,
 		// i.e. \foo{bar}{baz} test 123
 		//                    ^
+		//
+		// Arguments need to follow right away, so a MultiMarkdown table
+		// caption ("[Caption]") or definition (": text") on the next line
+		// is not taken for one.
 		if nesting == 0 && c.current() != "{" && c.current() != "[" {
 			break
 		}
 
+		// Critic Markup after the command is text, i.e. \foo{++ added ++}
+		if nesting == 0 && isCriticMarkup(c.in[c.cursor:]) {
+			break
+		}
+		if nesting == 0 && c.options.WikiLinks && c.current() == "[" && c.lookahead(1) == "[" {
+			break
+		}
+
 		// This will break if there's an unbalanced number of different
 		// brace types, i.e. "[[]}" will result in nesting = 0. Don't care
 		// to fix that right now.
@@ -150,22 +738,33 @@ func (c *Converter) handleLatexCommand(emitCommentBlock bool) {
 			nesting -= 1
 		}
 
-		c.emit(c.current())
 		c.cursor += 1
 	}
+	if nesting > 0 {
+		c.problem(start, ErrUnbalancedBraces)
+		c.log(slog.LevelDebug, start, "Treating the rest of the input as arguments")
+	}
+	c.recordDefinitions(start)
+	c.recordIncludes(start)
 
 	if emitCommentBlock {
-		c.emit("-->")
+		c.logSpan(CommandSpan, start)
+		c.doc.stats.Wrapped += 1
+		latex := string(c.in[start:c.cursor])
+		if nesting == 0 {
+			latex = c.singleLineInHeading(start, latex)
+		}
+		c.renderer().EmitCommand(c.out, latex)
 	}
 }
 
 // Handles (nested) \begin{} ... \end{} blocks. Does not care wether you're
 // starting/ending the right environment, i.e. this will work:
 //
-//      \begin{figure} ... \end{math}
-//
+//	\begin{figure} ... \end{math}
 func (c *Converter) handleLatexBlock() {
-	c.emit("<!--")
+	c.doc.stats.Wrapped += 1
+	start := c.cursor
 	nesting := 0
 
 	for !c.atEof() {
@@ -184,18 +783,21 @@ func (c *Converter) handleLatexBlock() {
 		// "}" and then return.
 		if nesting == 0 {
 			c.handleLatexCommand(false)
-			c.emit("-->")
 			break
 		}
 
-		c.emit(c.current())
 		c.cursor += 1
 	}
+
+	c.renderer().EmitEnvironment(c.out, string(c.in[start:c.cursor]))
 }
 
 func (c *Converter) handleInlineMath() bool {
-	// Escaped dollar sign, skip
+	// Escaped dollar sign, skip. MathJax needs to see the escape as well.
 	if c.current() == "\\" && c.next() == "$" {
+		if c.options.MathPassthrough {
+			c.emit("\\")
+		}
 		c.emit("$")
 		c.cursor += 2
 		return true
@@ -205,24 +807,220 @@ func (c *Converter) handleInlineMath() bool {
 		return false
 	}
 
-	c.emit("<!--$")
+	if c.lookahead(1) == "$" {
+		return c.handleDisplayMath()
+	}
+
 	c.cursor += 1
+	start := c.cursor
 
-	for c.current() != "$" || c.prev() == "\\"  {
-		c.emit(c.current())
+	for c.skipTo("$") && c.prev() == "\\" {
 		c.cursor += 1
 	}
+	if c.atEof() {
+		c.problem(start-1, ErrUnterminatedMath)
+		c.log(slog.LevelDebug, start-1, "Treating the rest of the input as math")
+	} else {
+		c.lintDollar(start-1, c.cursor)
+	}
 
+	tex := string(c.in[start:c.cursor])
+	if !c.atEof() {
+		tex = c.singleLineInHeading(start, tex)
+	}
+	c.emitMath(tex)
 	c.cursor += 1
-	c.emit("$-->")
+	c.recordMath(start - 1)
 
 	return true
 }
 
-// Conversion loop iterating over all characters. Not very efficient, but does its job.
+// Handles $$display math$$ which, like inline math, is emitted as a whole
+func (c *Converter) handleDisplayMath() bool {
+	c.cursor += 2
+	start := c.cursor
+
+	for !c.atEof() && (c.current() != "$" || c.lookahead(1) != "$" || c.prev() == "\\") {
+		c.cursor += 1
+	}
+	if c.atEof() {
+		c.problem(start-2, ErrUnterminatedMath)
+		c.log(slog.LevelDebug, start-2, "Treating the rest of the input as math")
+	}
+
+	c.emitDisplayMath(string(c.in[start:c.cursor]))
+	c.cursor += 2
+	c.recordMath(start - 2)
+
+	return true
+}
+
+// Handles \(inline math\) and \[display math\]. Everything up to the closing
+// delimiter is math, including environments like \begin{cases}.
+func (c *Converter) handleMathDelimiters() bool {
+	if c.current() != "\\" || (c.lookahead(1) != "(" && c.lookahead(1) != "[") {
+		return false
+	}
+
+	display := c.lookahead(1) == "["
+	closing := byte(')')
+	if display {
+		closing = ']'
+	}
+
+	start := c.cursor + 2
+	for end := start; end+1 < c.inputLength; end++ {
+		if c.in[end] != '\\' {
+			continue
+		}
+		if c.in[end+1] != closing {
+			end += 1 // Skip escaped characters like \\
+			continue
+		}
+
+		if display {
+			c.emitDisplayMath(string(c.in[start:end]))
+		} else {
+			c.emitMath(string(c.in[start:end]))
+		}
+		c.cursor = end + 2
+		c.recordMath(start - 2)
+		return true
+	}
+
+	return false
+}
+
+// Same as emitMath for display math
+func (c *Converter) emitDisplayMath(tex string) {
+	c.renderer().EmitMath(c.out, tex, true)
+}
+
+// Writes inline math, see Renderer.EmitMath
+func (c *Converter) emitMath(tex string) {
+	c.renderer().EmitMath(c.out, tex, false)
+}
+
+// Writes text taken from the input, see Renderer.EmitText
+func (c *Converter) emitText(s string) {
+	c.renderer().EmitText(c.out, s)
+}
+
+// The characters the handlers of Convert look for, all other characters are
+// plain text. With Options.WikiLinks "[" is one as well, with
+// Options.ShiftHeadings "#" and with Options.RewriteImages or
+// Options.CollectAssets "!".
+const specialCharacters = "\\$<"
+
+// Whether the character at the cursor ends a wrapped command name: a space,
+// including those of other scripts, or punctuation of other scripts, e.g.
+// the ideographic full stop in "\LaTeX。"
+func (c *Converter) atNameEnd() bool {
+	b := c.in[c.cursor]
+	if b < utf8.RuneSelf {
+		return isSpace(b)
+	}
+	r, _ := utf8.DecodeRune(c.in[c.cursor:])
+	return unicode.IsSpace(r) || unicode.IsPunct(r)
+}
+
+// Same as \s in regular expressions
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\f' || b == '\r'
+}
+
+func (c *Converter) isSpecial(b byte) bool {
+	return b == '\\' || b == '$' || b == '<' || b == '[' && c.options.WikiLinks || b == '#' && c.options.ShiftHeadings != 0 || b == '!' && c.options.changesImages()
+}
+
+// Returns where the text from the cursor up to the next special character
+// ends, it includes the character at the cursor
+func (c *Converter) plainTextEnd() int {
+	special := specialCharacters
+	if c.options.WikiLinks {
+		special += "["
+	}
+	if c.options.ShiftHeadings != 0 {
+		special += "#"
+	}
+	if c.options.changesImages() {
+		special += "!"
+	}
+	if i := bytes.IndexAny(c.in[c.cursor+1:], special); i >= 0 {
+		return c.cursor + 1 + i
+	}
+	return c.inputLength
+}
+
+// Writes the text up to plainTextEnd at once, but not beyond |limit|
+func (c *Converter) emitPlainText(limit int) {
+	end := c.plainTextEnd()
+	if end > limit {
+		end = limit
+	}
+	c.emitInput(end)
+}
+
+// Emits the input from the cursor up to |end| as text
+func (c *Converter) emitInput(end int) {
+	// Copied as is unless the renderer does something with it
+	if _, ok := c.renderer().(optionsRenderer); ok && !c.options.EscapeHTML {
+		c.out.Write(c.in[c.cursor:end])
+	} else {
+		c.emitText(string(c.in[c.cursor:end]))
+	}
+	c.cursor = end
+}
+
+// Converts the whole input and returns the output
 func (c *Converter) Convert() []byte {
-	for !c.atEof() {
-		if c.handleComments() {
+	if c.options.Timeout > 0 && !c.fragment && c.doc.deadline.IsZero() {
+		c.doc.deadline = time.Now().Add(c.options.Timeout)
+	}
+
+	if c.options.Expand && !c.fragment {
+		c.collectDefinitions()
+	}
+
+	// The output is about as long as the input, wrapping adds a little.
+	// Converters which only scan the input never get here.
+	c.out.Grow(c.inputLength + c.inputLength/4)
+
+	if !c.fragment && c.doc.invalid != nil {
+		c.doc.problems = append(c.doc.problems, c.doc.invalid)
+		c.warnAt(c.doc.invalid.Position.Line, c.doc.invalid.Position.Column, "%s", ErrInvalidUTF8)
+	}
+
+	c.convertUntil(c.inputLength)
+
+	if !c.fragment && !c.doc.chunked {
+		c.finish()
+	}
+
+	return c.out.Bytes()
+}
+
+// Conversion loop iterating over all characters, see BenchmarkThesis and friends
+// before changing it. Stops once the cursor reaches |end|, which may be
+// passed by what is converted last, see ConvertParallel.
+func (c *Converter) convertUntil(end int) {
+	c.handleMetadata()
+	for c.cursor < end && !c.atEof() {
+		if c.timedOut() {
+			break
+		}
+
+		// None of the handlers would match
+		if !c.isSpecial(c.in[c.cursor]) {
+			c.emitPlainText(end)
+			continue
+		}
+
+		if c.handleLinkDefinition() {
+			continue
+		}
+
+		if c.handleLiteral() || c.handleComments() {
 			continue
 		}
 
@@ -230,52 +1028,494 @@ func (c *Converter) Convert() []byte {
 			continue
 		}
 
+		if c.handleHTMLTag() {
+			continue
+		}
+
+		if c.handleWikiLink() || c.handleMarkdownHeading() || c.handleMarkdownImage() {
+			continue
+		}
+
 		if c.handleInlineMath() {
 			continue
 		}
 
+		if c.handleMathDelimiters() {
+			continue
+		}
+
 		if c.handleLatex() {
 			continue
 		}
 
-		c.emit(c.current())
-		c.cursor += 1
+		c.emitPlainText(end)
 	}
+}
 
-	return c.out.Bytes()
+// Completes the output once the whole document is converted
+func (c *Converter) finish() {
+	c.validateLatex()
+	c.checkLinks()
+	c.resolveReferences()
+	c.insertListsOfFloats()
+	c.appendIndex()
+	c.appendFootnotes()
+}
+
+// Checks if the deadline has passed, now and then as it is called for every
+// character
+func (c *Converter) timedOut() bool {
+	if c.doc.deadline.IsZero() {
+		return false
+	}
+
+	c.doc.steps += 1
+	if c.doc.err == nil && c.doc.steps%1024 == 0 && time.Now().After(c.doc.deadline) {
+		c.doc.err = ErrTimeout
+		c.log(slog.LevelDebug, c.cursor, "Giving up on the rest of the input", "error", ErrTimeout)
+	}
+	return c.doc.err != nil
+}
+
+// Returns why Convert gave up, in which case its output is incomplete
+func (c *Converter) Err() error {
+	return c.doc.err
+}
+
+// Records a problem which does not stop the conversion
+func (c *Converter) warn(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	c.doc.warnings = append(c.doc.warnings, Warning{Message: message})
+	if c.options.Logger != nil {
+		c.options.Logger.Warn(message)
+	}
+}
+
+// Same as warn for a problem at |line| and |column|
+func (c *Converter) warnAt(line, column int, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	c.doc.warnings = append(c.doc.warnings, Warning{line, column, message})
+	if c.options.Logger != nil {
+		c.options.Logger.Warn(message, "line", line, "column", column)
+	}
+}
+
+// Returns the problems encountered by Convert, prefixed with their position
+// ("line:column: ") if they have one
+func (c *Converter) Warnings() []string {
+	var warnings []string
+	for _, w := range c.doc.warnings {
+		warnings = append(warnings, w.String())
+	}
+	return warnings
 }
 
 /* Utility */
 
 func ByteArrayToConverter(in []byte) Converter {
-	runes := []rune(string(in))
+	return NewConverter(in, Options{})
+}
+
+func NewConverter(in []byte, options Options) Converter {
+	if options.DetectPackages {
+		enablePackageOptions(in, &options)
+	}
+
+	doc := &document{
+		headings:      headingState{top: -1},
+		equations:     options.numbersBefore.equations,
+		figuresBefore: options.numbersBefore.figures,
+		tablesBefore:  options.numbersBefore.tables,
+	}
+	if position, ok := invalidUTF8(in); ok {
+		doc.invalid = &PositionError{ErrInvalidUTF8, position}
+		// Replaces each invalid byte, so the output is valid
+		in = replaceInvalidUTF8(in, position.Offset)
+	}
+
 	return Converter{
-		inputLength: len(runes),
+		inputLength: len(in),
 		cursor:      0,
-		in:          runes,
+		in:          in,
 		out:         new(bytes.Buffer),
+		options:     options,
+		doc:         doc,
+	}
+}
+
+// Statistics of a conversion
+type Stats struct {
+	InputBytes, OutputBytes int
+
+	// Pieces of math, including math environments
+	Math int
+
+	// Commands and environments converted, and those wrapped instead
+	Converted, Wrapped int
+
+	// HTML comments, which are wrapped LaTeX as well
+	Comments int
+
+	Warnings int
+	Duration time.Duration
+}
+
+// What happened while converting a document
+type Report struct {
+	Warnings []Warning
+	Stats    Stats
+
+	// The headings converted with Options.Headings, in order
+	Headings []Heading
+}
+
+// Converts |in| with |options|. If the options are invalid, the input is
+// binary (see ErrBinaryInput), the conversion takes longer than
+// Options.Timeout (see ErrTimeout) or, with Options.Strict, there are
+// problems with the input (see errors.go), it returns an error; the report
+// also tells about problems that did not stop the conversion.
+func Convert(in []byte, options Options) ([]byte, Report, error) {
+	if err := options.validate(); err != nil {
+		return nil, Report{}, err
+	}
+	if err := binaryInput(in); err != nil {
+		return nil, Report{}, err
+	}
+
+	start := time.Now()
+	c := NewConverter(in, options)
+	out := c.Convert()
+
+	stats := c.doc.stats
+	stats.InputBytes, stats.OutputBytes = len(in), len(out)
+	stats.Warnings = len(c.doc.warnings)
+	stats.Duration = time.Since(start)
+	report := Report{Warnings: c.doc.warnings, Stats: stats, Headings: c.doc.headings.converted}
+
+	err := c.Err()
+	if err == nil && options.Strict && len(c.doc.problems) > 0 {
+		err = c.doc.problems[0]
+	}
+	if options.OnConvert != nil {
+		options.OnConvert(stats, err)
 	}
+	if err != nil {
+		return nil, report, err
+	}
+	return out, report, nil
 }
 
+// Deprecated: Use Convert, which takes options and reports problems.
 func SXMD(in []byte) []byte {
 	c := ByteArrayToConverter(in)
 	return c.Convert()
 }
 
+// Defines the flags for the conversion options which documents may set in
+// their front matter, see frontmatter.go. Their defaults are the values of
+// |options|.
+func conversionFlags(flags *flag.FlagSet, options *Options) {
+	flags.BoolVar(&options.Units, "siunitx", options.Units, "convert siunitx commands (\\SI, \\num, ...) to plain text")
+	flags.BoolVar(&options.MathPassthrough, "math-passthrough", options.MathPassthrough, "leave math as is for MathJax instead of wrapping it in comments")
+	flags.StringVar(&options.MathDelimiters, "math-delimiters", options.MathDelimiters, "with -math-passthrough, delimit math with: dollars, latex (\\(...\\) and \\[...\\]) or confluence ({mathinline} and {mathdisplay})")
+	flags.StringVar(&options.Wrap, "wrap", options.Wrap, "wrap LaTeX that is not converted in: comment, noformat (Confluence) or pandoc-raw (raw LaTeX for pandoc), or drop it")
+	flags.BoolVar(&options.UnicodeMath, "unicode-math", options.UnicodeMath, "convert math to Unicode text, e.g. \\alpha^2 to α²")
+	flags.BoolVar(&options.EscapeHTML, "escape-html", options.EscapeHTML, "escape &, < and > in text and math, for targets taking HTML")
+	flags.BoolVar(&options.WikiLinks, "wiki-links", options.WikiLinks, "copy [[wiki links]] and ![[embeds]] as they are, for Obsidian and wikis")
+	flags.StringVar(&options.RewriteImages, "rewrite-images", options.RewriteImages, "rewrite the paths of images starting with from to start with to instead, e.g. figures/=/static/img/ (several rules separated by commas)")
+	flags.StringVar(&options.LiteralMarker, "literal-marker", options.LiteralMarker, "copy the text between <!--marker--> and <!--/marker--> as it is (default md)")
+	flags.BoolVar(&options.EscapeComments, "escape-comments", options.EscapeComments, "escape &, <, > and -- in the LaTeX wrapped in comments, so they are well-formed HTML")
+	flags.BoolVar(&options.LiftIntertext, "lift-intertext", options.LiftIntertext, "with -math-passthrough, lift \\intertext out of math environments as paragraphs")
+	flags.BoolVar(&options.NumberEquations, "number-equations", options.NumberEquations, "number labeled equations and resolve \\ref, for renderers without equation numbering")
+	flags.BoolVar(&options.Floats, "floats", options.Floats, "convert figure and table environments to Markdown")
+	flags.BoolVar(&options.ListOfFloats, "float-lists", options.ListOfFloats, "with -floats, replace \\listoffigures and \\listoftables with lists of links")
+	flags.BoolVar(&options.Headings, "headings", options.Headings, "convert sectioning commands (\\section, ...) to Markdown headings")
+	flags.IntVar(&options.ShiftHeadings, "shift-headings", options.ShiftHeadings, "make converted and Markdown headings this many levels lower, e.g. to embed chapters in a larger document")
+	flags.StringVar(&options.Slugs, "slugs", options.Slugs, "with -headings and -number-equations, link \\ref to headings with the anchors generated by: github or pandoc (default github)")
+	flags.BoolVar(&options.Lists, "lists", options.Lists, "convert itemize, enumerate and description environments to Markdown lists")
+	flags.StringVar(&options.Index, "index", options.Index, "what to do with \\index{term}: drop, anchor or generate an index")
+	flags.StringVar(&options.MarginNotes, "margin-notes", options.MarginNotes, "convert \\marginpar and \\marginnote to: aside or footnote")
+	flags.BoolVar(&options.Formatting, "formatting", options.Formatting, "convert text formatting commands (\\fbox, ...) to Markdown or HTML")
+	flags.BoolVar(&options.EqualsHighlights, "highlight-equals", options.EqualsHighlights, "with -formatting, convert \\hl{text} to ==text== instead of <mark>")
+	flags.BoolVar(&options.Today, "today", options.Today, "replace \\today with the current date")
+	flags.StringVar(&options.DateFormat, "date-format", options.DateFormat, "with -today, format the date like this Go time layout (default \"January 2, 2006\")")
+	flags.BoolVar(&options.Logos, "logos", options.Logos, "replace logos like \\LaTeX with plain text")
+	flags.StringVar(&options.Conditionals, "conditionals", options.Conditionals, "what to do with content disabled by \\iffalse ... \\fi: drop or keep")
+	flags.BoolVar(&options.Links, "links", options.Links, "convert \\href and \\url to Markdown links")
+	flags.BoolVar(&options.DetectPackages, "detect-packages", options.DetectPackages, "enable the conversions for the packages loaded with \\usepackage")
+	flags.BoolVar(&options.Expand, "expand", options.Expand, "expand uses of commands and environments defined in the document")
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fix" {
+		os.Exit(fixCommand(os.Args[2:]))
+	} else if len(os.Args) > 1 && os.Args[1] == "stats" {
+		os.Exit(statsCommand(os.Args[2:]))
+	} else if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		os.Exit(selftestCommand(os.Args[2:]))
+	} else if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+
+	var options Options
+	config := configPath(os.Args[1:])
+	if config != "" {
+		var err error
+		if options, _, err = loadConfig(config, options); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	flag.String("config", config, "read the configuration from this file instead of "+configName+" (empty for none)")
+	conversionFlags(flag.CommandLine, &options)
+	flag.StringVar(&options.RenderMath, "render-math", "", "render math to images in -assets-dir, in this format: svg")
+	flag.StringVar(&options.AssetsDir, "assets-dir", "assets", "directory for rendered math")
+	flag.StringVar(&options.RenderCommand, "render-command", "", "with -render-math, render with this shell command reading math from stdin and writing the image to stdout, instead of latex and dvisvgm")
+	flag.BoolVar(&options.InlineMathImages, "inline-math-images", false, "with -render-math, embed the images as data URIs in <img> tags")
+	flag.StringVar(&options.CollectAssets, "collect-assets", "", "copy the images of converted figures and Markdown images into this directory and link the copies")
+	flag.BoolVar(&options.ValidateLatex, "validate-latex", false, "compile the math with TeX in draft mode and print its errors")
+	flag.BoolVar(&options.CheckLinks, "check-links", false, "warn about \\ref to undefined labels and \\includegraphics, \\input and \\include of files which do not exist")
+	flag.StringVar(&options.TexCommand, "tex-command", defaultTexCommand, "with -validate-latex, the TeX binary (and arguments) to compile with")
+	date := flag.String("date", "", "with -today, use this date (YYYY-MM-DD) instead of the current one")
+	resolveIncludes := flag.Bool("resolve-includes", false, "with -number-equations, resolve \\ref to labels in files included with \\input or \\include")
+	stdinFilename := flag.String("stdin-filename", "<stdin>", "when reading stdin, the name of the input in diagnostics")
+	cacheDir := flag.String("cache", "", "cache converted files in this directory and reuse them while the file and options are unchanged")
+	flag.BoolVar(&options.Reproducible, "reproducible", false, "make the output depend only on the input and options: \\today needs -date or SOURCE_DATE_EPOCH, generated anchors are derived from content")
+	flag.BoolVar(&options.Strict, "strict", false, "fail on problems with the input like unterminated math, unbalanced braces or invalid UTF-8")
+	flag.DurationVar(&options.Timeout, "timeout", 0, "give up converting a file after this long, e.g. 10s")
+	maxFileSize := flag.String("max-file-size", "", "do not convert files larger than this, e.g. 50M")
+	filesFrom := flag.String("files-from", "", "also convert the files listed in this file (- for stdin), one per line")
+	flag.StringVar(filesFrom, "filelist", "", "same as -files-from")
+	nulSeparated := flag.Bool("0", false, "with -files-from, the files are separated by NUL characters, as printed by find -print0")
+	chunkSize := flag.String("chunk-size", "", "convert files in chunks of about this size, e.g. 4M, so they need not fit into memory")
+	jobs := flag.Int("jobs", 1, "convert each file in segments, this many at once (0 for as many as there are CPUs)")
+	mmap := flag.Bool("mmap", false, "map files into memory instead of reading them, so only the parts being converted are resident")
+	noProgress := flag.Bool("no-progress", false, "do not report the progress of converting several files on stderr")
+	format := flag.String("format", "", "convert to these formats, comma-separated presets like mathjax,pandoc (needs -out-dir with {format} for several)")
+	outDir := flag.String("out-dir", "", "write the converted files into this directory, {format} is replaced by the format, e.g. build/{format}")
+	flag.StringVar(outDir, "o", "", "same as -out-dir")
+	recursive := flag.Bool("r", false, "convert the files in the directories given (default the working directory) and their subdirectories whose name matches -pattern, into -out-dir or with -i")
+	pattern := flag.String("pattern", "*.md", "with -r, convert the files whose name matches this pattern")
+	followSymlinks := flag.Bool("follow-symlinks", false, "with -r, follow symbolic links to files and directories instead of skipping them")
+	inPlace := flag.Bool("i", false, "replace the files with their conversion, once it succeeded")
+	backup := flag.String("backup", "", "with -i, keep the original files with this suffix, e.g. .bak")
+	watch := flag.Bool("watch", false, "convert the files again whenever they change, e.g. for a live preview")
+	concat := flag.Bool("concat", false, "convert the files into a single document on stdout, in the order given")
+	separator := flag.String("separator", "\\n\\n", "with -concat, put this between the files, \\n is a newline")
+	demoteHeadings := flag.Bool("demote-headings", false, "with -concat, make the headings of each file one level lower")
+	preset := flag.String("preset", "", "enable the options for a target, one of: "+presetNames())
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [file-to-convert, - or none for stdin] [more files]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s fix [-w] <file to fix> [more files]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s stats <file> [more files]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s selftest\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s config show [options]\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
 	flag.Parse()
-	if len(flag.Args()) != 1 {
-		fmt.Printf("Usage: %s <file-to-convert>\n", filepath.Base(os.Args[0]))
+	files := flag.Args()
+	if *filesFrom != "" {
+		listed, err := readFileList(*filesFrom, *nulSeparated)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		files = append(files, listed...)
+	}
+	args := files
+	var relative map[string]string
+	if *recursive {
+		if *outDir == "" && !*inPlace {
+			// Files matching *.md would be converted onto themselves
+			fmt.Fprintln(os.Stderr, "-r needs -out-dir (or -o) or -i")
+			os.Exit(1)
+		}
+		if _, err := filepath.Match(*pattern, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid pattern %s\n", *pattern)
+			os.Exit(1)
+		}
+		if len(files) == 0 {
+			files = []string{"."}
+			args = files
+		}
+		var err error
+		if files, relative, err = walkFiles(files, *pattern, *outDir, *followSymlinks); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		} else if len(files) == 0 {
+			fmt.Fprintf(os.Stderr, "No files match %s\n", *pattern)
+			os.Exit(1)
+		}
+	}
+	if len(files) == 0 && *filesFrom == "" {
+		// Input piped in, e.g. cat notes.xmd | merkderwn | pandoc
+		if isTerminal(os.Stdin) {
+			flag.Usage()
+			os.Exit(1)
+		}
+		files = []string{"-"}
+	}
+
+	if *date != "" {
+		var err error
+		if options.Date, err = time.Parse("2006-01-02", *date); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid date %s, expected YYYY-MM-DD\n", *date)
+			os.Exit(1)
+		}
+	} else if options.Reproducible {
+		var err error
+		if options.Date, err = sourceDate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *preset != "" {
+		if err := applyPreset(*preset, &options); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := options.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	inputFilePath := flag.Arg(0)
-	content, err := ioutil.ReadFile(inputFilePath)
+	formats, err := parseFormats(*format)
 	if err != nil {
-		fmt.Printf("Could not read input file %s", inputFilePath)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(formats) > 1 && !strings.Contains(*outDir, "{format}") {
+		fmt.Fprintln(os.Stderr, "Converting to several formats needs -out-dir with {format}")
 		os.Exit(1)
 	}
+	for _, format := range formats {
+		formatOptions := options
+		applyPreset(format, &formatOptions)
+		if err := formatOptions.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s with -format %s\n", err, format)
+			os.Exit(1)
+		}
+	}
 
-	content = SXMD(content)
-	os.Stdout.Write(content)
+	var maxBytes int64
+	if *maxFileSize != "" {
+		var err error
+		if maxBytes, err = parseSize(*maxFileSize); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var chunkBytes int64
+	if *chunkSize != "" {
+		var err error
+		if chunkBytes, err = parseSize(*chunkSize); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := options.chunkable(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *jobs == 0 {
+		*jobs = runtime.NumCPU()
+	}
+	if *jobs > 1 {
+		if err := options.parallelizable(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if chunkBytes > 0 {
+			fmt.Fprintln(os.Stderr, "-jobs cannot be combined with -chunk-size")
+			os.Exit(1)
+		}
+	}
+
+	r := run{
+		options:         options,
+		maxFileSize:     maxBytes,
+		chunkSize:       int(chunkBytes),
+		mmap:            *mmap,
+		jobs:            *jobs,
+		resolveIncludes: *resolveIncludes,
+		cacheDir:        *cacheDir,
+		stdinFilename:   *stdinFilename,
+		progress:        !*noProgress,
+		formats:         formats,
+		outDir:          *outDir,
+		relative:        relative,
+		inPlace:         *inPlace,
+		backup:          *backup,
+	}
+	if *concat && *outDir != "" {
+		fmt.Fprintln(os.Stderr, "-concat cannot be combined with -out-dir")
+		os.Exit(1)
+	}
+	if *inPlace && (*concat || *outDir != "" || *watch) {
+		fmt.Fprintln(os.Stderr, "-i cannot be combined with -concat, -out-dir or -watch")
+		os.Exit(1)
+	}
+	several := len(files) > 1 || *filesFrom != "" || *outDir != "" || *recursive || *inPlace
+	convert := func(files []string) int {
+		if *concat {
+			out := bufio.NewWriter(os.Stdout)
+			failed := r.concatFiles(files, unescapeSeparator(*separator), *demoteHeadings, out)
+			if err := out.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "Could not write output: %s\n", err)
+				return len(files)
+			}
+			if failed > 0 {
+				fmt.Fprintf(os.Stderr, "Could not convert %d of %d files\n", failed, len(files))
+			}
+			return failed
+		}
+		if several {
+			return r.convertFiles(files)
+		}
+
+		r.stream = true
+		out := bufio.NewWriter(os.Stdout)
+		if _, err := r.convertFile(files[0], out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := out.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write output: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if *watch {
+		for _, file := range files {
+			if file == "-" {
+				fmt.Fprintln(os.Stderr, "-watch needs files, not stdin")
+				os.Exit(1)
+			}
+		}
+		list := func() []string {
+			if *recursive {
+				// Files added since are converted as well
+				if walked, walkedRelative, err := walkFiles(args, *pattern, *outDir, *followSymlinks); err == nil {
+					files, r.relative = walked, walkedRelative
+				}
+			}
+			return files
+		}
+		convertAgain := func(files []string) int {
+			// Included files may have changed as well
+			r.project = nil
+			return convert(files)
+		}
+		watchFiles(list, convertAgain, os.Stderr, nil)
+	}
+	if convert(files) > 0 {
+		os.Exit(1)
+	}
 }
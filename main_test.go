@@ -3,10 +3,12 @@ package main
 import (
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func ConvertAndCompareFile(t *testing.T, inputFilePath string) {
@@ -44,6 +46,10 @@ Files %s and %s were not the same:
 func TestExampleFiles(t *testing.T) {
 	files, _ := filepath.Glob("./example-files/*.xmd")
 	for _, file := range files {
+		// Converted with other options, see TestSelftest
+		if _, err := os.Stat(strings.TrimSuffix(file, ".xmd") + ".flags"); err == nil {
+			continue
+		}
 		ConvertAndCompareFile(t, file)
 	}
 }
@@ -62,7 +68,7 @@ func TestEofCases(t *testing.T) {
 	assert.Equal(t, "<!--\\foo[-->", string(c.Convert()))
 
 	c = getTestConverter("\\begin")
-	assert.Equal(t, "<!--\\begin", string(c.Convert()))
+	assert.Equal(t, "<!--\\begin-->", string(c.Convert()))
 
 	c = getTestConverter("\\foobar")
 	assert.Equal(t, "<!--\\foobar-->", string(c.Convert()))
@@ -73,8 +79,9 @@ func getTestConverter(input string) Converter {
 }
 
 func TestUnicodeLengthIsValid(t *testing.T) {
+	// The cursor moves over bytes, not characters
 	c := getTestConverter("Falsches Üben von Xylophonmusik quält jeden größeren Zwerg")
-	assert.Equal(t, 58, c.inputLength)
+	assert.Equal(t, 62, c.inputLength)
 }
 
 func TestGeneralCursorFunctions(t *testing.T) {
@@ -82,14 +89,150 @@ func TestGeneralCursorFunctions(t *testing.T) {
 	assert.Equal(t, "F", c.current())
 	assert.Equal(t, "a", c.next())
 	assert.Equal(t, "Ü", c.at(9))
-	assert.Equal(t, "alsches Üben ", c.lookahead(13))
-	assert.Equal(t, "Üben von Xylophonmusik", c.lookaheadAt(22, 8))
+	assert.Equal(t, "", c.at(10))
+	assert.Equal(t, "b", c.at(11))
+	assert.Equal(t, "alsches Üben ", c.lookahead(14))
+	assert.Equal(t, "Üben von Xylophonmusik", c.lookaheadAt(23, 8))
 }
 
 func TestLookback(t *testing.T) {
 	c := getTestConverter("Falsches Üben von Xylophonmusik quält jeden größeren Zwerg")
-	c.cursor += 10
-	assert.Equal(t, " Ü", c.lookback(2))
+	c.cursor += 11
+	assert.Equal(t, " Ü", c.lookback(3))
 	assert.Equal(t, "Ü", c.prev())
-	assert.Equal(t, "Falsches Ü", c.lookback(10))
+	assert.Equal(t, "Falsches Ü", c.lookback(11))
+}
+
+func TestMultiByteCharacters(t *testing.T) {
+	assert.Equal(t, "größer <!--\\größe{x}--> ä", convertWithOptions("größer \\größe{x} ä", Options{}))
+
+	c := getTestConverter("a\\größe{x}")
+	c.cursor = 1
+	assert.Equal(t, "größe", c.commandName())
+	c.skipCommandName()
+	assert.Equal(t, "{", c.current())
+
+	// Invalid bytes are replaced like before
+	assert.Equal(t, "a\ufffd\ufffdb", convertWithOptions("a\xff\xfeb", Options{}))
+}
+
+func TestCommandsInOtherScripts(t *testing.T) {
+	assert.Equal(t, "数学<!--\\LaTeX-->、次の文", convertWithOptions("数学\\LaTeX、次の文", Options{}))
+	assert.Equal(t, "<!--\\alpha-->，β", convertWithOptions("\\alpha，β", Options{}))
+	assert.Equal(t, "a <!--\\foo-->\u00a0bar", convertWithOptions("a \\foo\u00a0bar", Options{}))
+	assert.Equal(t, "x<!--\\foo-->\u3000y", convertWithOptions("x\\foo\u3000y", Options{}))
+	assert.Equal(t, "$x$。", convertWithOptions("$x$。", Options{MathPassthrough: true}))
+}
+
+func TestTimeout(t *testing.T) {
+	input := []byte(strings.Repeat("\\foo{bar} $x$ ", 100000))
+
+	c := NewConverter(input, Options{Timeout: time.Nanosecond})
+	c.Convert()
+	assert.Equal(t, ErrTimeout, c.Err())
+
+	c = NewConverter(input, Options{Timeout: time.Minute})
+	c.Convert()
+	assert.Nil(t, c.Err())
+}
+
+func TestConvert(t *testing.T) {
+	out, report, err := Convert([]byte("$x$ \\foo \\SI{1}{\\meter} \\begin{bar}\\end{bar} $$y$$"), Options{Units: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "<!--$x$--> <!--\\foo--> 1 m <!--\\begin{bar}\\end{bar}--> <!--$$y$$-->", string(out))
+	assert.Empty(t, report.Warnings)
+	assert.Equal(t, 2, report.Stats.Math)
+	assert.Equal(t, 1, report.Stats.Converted)
+	assert.Equal(t, 2, report.Stats.Wrapped)
+	assert.Equal(t, 50, report.Stats.InputBytes)
+	assert.Equal(t, len(out), report.Stats.OutputBytes)
+}
+
+func TestConvertErrors(t *testing.T) {
+	_, _, err := Convert([]byte("$x$"), Options{Wrap: "bubblewrap"})
+	assert.Error(t, err)
+
+	_, _, err = Convert([]byte(strings.Repeat("$x$", 100000)), Options{Timeout: time.Nanosecond})
+	assert.Equal(t, ErrTimeout, err)
+
+	_, report, err := Convert([]byte("$x$"), Options{RenderMath: "svg", RenderCommand: "false"})
+	assert.NoError(t, err)
+	assert.Len(t, report.Warnings, 1)
+}
+
+func TestSkipTo(t *testing.T) {
+	c := getTestConverter("ab-->cd")
+	assert.True(t, c.skipTo("-->"))
+	assert.Equal(t, 2, c.cursor)
+	assert.False(t, c.skipTo("$"))
+	assert.True(t, c.atEof())
+
+	assert.Equal(t, "a $\\$x$ b", convertWithOptions("a $\\$x$ b", Options{MathPassthrough: true}))
+}
+
+// Documents to benchmark the conversion with
+
+const thesisParagraph = `\section{Results}
+Let $f(x) = \sum_{i=0}^{n} \alpha_i x^i$ and $g \in \mathcal{O}(n \log n)$, then
+\begin{align}
+  f(x) &= \int_0^1 \frac{\partial g}{\partial t} \, dt \label{eq:f} \\
+  &\leq \sqrt{\SI{3}{\meter}} + \cite{knuth}
+\end{align}
+as \eqref{eq:f} shows, see also \ref{fig:plot} and $$\lim_{n \to \infty} a_n = 0.$$
+
+`
+
+const readmeParagraph = `Merkderwn converts Markdown with embedded LaTeX to plain Markdown. Most of
+a README is prose like this, with the occasional <em>HTML</em> tag, a list of
+features and a [link](http://example.com) or two, but hardly any math.
+
+- Fast
+- Simple
+
+`
+
+func benchmarkConvert(b *testing.B, in []byte, options Options) {
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Convert(in, options)
+	}
+}
+
+func BenchmarkThesis(b *testing.B) {
+	benchmarkConvert(b, []byte(strings.Repeat(thesisParagraph, 1000)), Options{})
+}
+
+func BenchmarkThesisPassthrough(b *testing.B) {
+	options := Options{MathPassthrough: true, Units: true, Headings: true, NumberEquations: true}
+	benchmarkConvert(b, []byte(strings.Repeat(thesisParagraph, 1000)), options)
+}
+
+func BenchmarkReadme(b *testing.B) {
+	benchmarkConvert(b, []byte(strings.Repeat(readmeParagraph, 2000)), Options{})
+}
+
+func BenchmarkNesting(b *testing.B) {
+	nesting := strings.Repeat("\\begin{a}\\foo{{[", 500) + strings.Repeat("]}}\\end{a}", 500)
+	benchmarkConvert(b, []byte(strings.Repeat(nesting+"\n\n", 20)), Options{})
+}
+
+func TestOutputIsPreallocated(t *testing.T) {
+	in := strings.Repeat("Some text and \\emph{more}. ", 1000)
+	c := getTestConverter(in)
+	assert.Equal(t, 0, c.out.Cap())
+	c.Convert()
+	assert.True(t, c.out.Cap() >= len(in))
+	assert.True(t, c.out.Cap() < 2*len(in))
+}
+
+func TestHTMLTags(t *testing.T) {
+	assert.Equal(t, `<img alt="price $5"> costs <!--$5$-->`, convertWithOptions(`<img alt="price $5"> costs $5$`, Options{}))
+	assert.Equal(t, `<a title='$x$' href=#a>$y$</a>`, convertWithOptions(`<a title='$x$' href=#a>$y$</a>`, Options{MathPassthrough: true}))
+	assert.Equal(t, "<span\n  title=\"\\foo\"/>", convertWithOptions("<span\n  title=\"\\foo\"/>", Options{}))
+
+	// Not tags
+	assert.Equal(t, "a <y and <!--$z$-->>", convertWithOptions("a <y and $z$>", Options{}))
+	assert.Equal(t, "1 <2 <!--$x$-->", convertWithOptions("1 <2 $x$", Options{}))
+	assert.Equal(t, `&lt;b title="&lt;"&gt;`+"<!--$x$-->", convertWithOptions(`<b title="<">$x$`, Options{EscapeHTML: true}))
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Markdown constructs which are copied as they are instead of being scanned
+// for math and LaTeX, e.g. the URL of
+//
+//	[id]: http://example.com/$path "Title"
+//
+// or MultiMarkdown's metadata and YAML front matter at the top of the
+// document:
+//
+//	Title: Notes
+//	LaTeX Input: mmd-article-header
+//
+// Critic Markup ({++ added ++}, {-- deleted --}, ...) is text as well and
+// not taken for the arguments of a command before it. So are wiki links and
+// embeds ([[Note]], ![[image.png]]) with Options.WikiLinks.
+//
+// Where none of the heuristics is right, <!--md-->$5 and $6<!--/md--> marks
+// the text between the markers as text, which they are removed from.
+
+// A link reference definition on a single line, as CommonMark defines them.
+// Footnote definitions ([^1]: ...) are text.
+var linkDefinitionRegexp = regexp.MustCompile(`^ {0,3}\[(?:[^\]\\^]|\\.)(?:[^\]\\]|\\.)*\]:[ \t]*(?:<[^<>\n]*>|[^ \t\n<]+)` +
+	`(?:[ \t]+(?:"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|\((?:[^()\\\n]|\\.)*\)))?[ \t]*\r?$`)
+
+// A line of metadata and the indented lines continuing the one before
+var metadataLineRegexp = regexp.MustCompile(`^(?:[A-Za-z0-9][A-Za-z0-9 _-]*:.*|[ \t]+\S.*)$`)
+
+// Copies MultiMarkdown's metadata at the start of the document, which are
+// the lines up to the first blank one if all of them are "key: value" or
+// indented, or the YAML front matter between --- lines
+func (c *Converter) handleMetadata() bool {
+	if c.fragment || c.cursor != 0 || c.doc.offset != 0 {
+		return false
+	}
+	if end := frontMatterEnd(c.in); end > 0 {
+		c.emitInput(end)
+		return true
+	}
+
+	end := 0
+	for end < c.inputLength {
+		lineEnd := c.inputLength
+		if i := bytes.IndexByte(c.in[end:], '\n'); i >= 0 {
+			lineEnd = end + i
+		}
+		line := bytes.TrimSuffix(c.in[end:lineEnd], []byte("\r"))
+		if len(line) == 0 {
+			break
+		}
+		if !metadataLineRegexp.Match(line) || end == 0 && (line[0] == ' ' || line[0] == '\t') {
+			return false
+		}
+		end = lineEnd
+		if end < c.inputLength {
+			end += 1
+		}
+	}
+	if end == 0 {
+		return false
+	}
+
+	c.emitInput(end)
+	return true
+}
+
+// Copies the rest of the line at the cursor if it is a link reference
+// definition. Lines are checked once, at their first special character.
+func (c *Converter) handleLinkDefinition() bool {
+	if c.fragment || c.cursor < c.linesChecked {
+		return false
+	}
+
+	lineStart := c.linesChecked + bytes.LastIndexByte(c.in[c.linesChecked:c.cursor], '\n') + 1
+	lineEnd := c.inputLength
+	if i := bytes.IndexByte(c.in[c.cursor:], '\n'); i >= 0 {
+		lineEnd = c.cursor + i
+	}
+	c.linesChecked = lineEnd
+
+	if !linkDefinitionRegexp.Match(c.in[lineStart:lineEnd]) {
+		return false
+	}
+	c.emitInput(lineEnd)
+	return true
+}
+
+// The delimiters of Critic Markup: additions, deletions, substitutions,
+// highlights and comments
+var criticMarkupDelimiters = [][2]string{{"{++", "++}"}, {"{--", "--}"}, {"{~~", "~~}"}, {"{==", "==}"}, {"{>>", "<<}"}}
+
+// Critic Markup is looked for this far, so looking does not take long
+const maxCriticMarkupLength = 1 << 16
+
+// Whether |in| starts with Critic Markup, which is closed in the same
+// paragraph and has balanced braces. "{--}" is an en dash in LaTeX.
+func isCriticMarkup(in []byte) bool {
+	if len(in) < 6 || in[0] != '{' {
+		return false
+	}
+	if len(in) > maxCriticMarkupLength {
+		in = in[:maxCriticMarkupLength]
+	}
+
+	for _, delimiters := range criticMarkupDelimiters {
+		if string(in[:3]) != delimiters[0] {
+			continue
+		}
+		end := bytes.Index(in[3:], []byte(delimiters[1]))
+		return end >= 0 && balanced(in[3:3+end]) && !bytes.Contains(in[3:3+end], []byte("\n\n"))
+	}
+	return false
+}
+
+// Whether the braces in |in| are balanced
+func balanced(in []byte) bool {
+	nesting := 0
+	for _, b := range in {
+		if b == '{' {
+			nesting += 1
+		} else if b == '}' {
+			nesting -= 1
+		}
+		if nesting < 0 {
+			return false
+		}
+	}
+	return nesting == 0
+}
+
+// Copies the wiki link or embed at the cursor, which ends on its line
+func (c *Converter) handleWikiLink() bool {
+	if !c.options.WikiLinks || c.current() != "[" || c.lookahead(1) != "[" {
+		return false
+	}
+
+	for end := c.cursor + 2; end+1 < c.inputLength && c.in[end] != '\n'; end++ {
+		if c.in[end] == ']' && c.in[end+1] == ']' {
+			c.emitInput(end + 2)
+			return true
+		}
+	}
+	return false
+}
+
+// Copies the text between <!--md--> and <!--/md--> (with the marker of
+// Options.LiteralMarker) in the same paragraph as it is, without the markers
+func (c *Converter) handleLiteral() bool {
+	marker := c.options.LiteralMarker
+	if marker == "" {
+		marker = "md"
+	}
+	open, close := []byte("<!--"+marker+"-->"), []byte("<!--/"+marker+"-->")
+	if !bytes.HasPrefix(c.in[c.cursor:], open) {
+		return false
+	}
+
+	end := bytes.Index(c.in[c.cursor+len(open):], close)
+	if end < 0 || bytes.Contains(c.in[c.cursor+len(open):c.cursor+len(open)+end], []byte("\n\n")) {
+		return false
+	}
+	c.cursor += len(open)
+	c.emitInput(c.cursor + end)
+	c.cursor += len(close)
+	return true
+}
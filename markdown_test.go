@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLinkDefinitions(t *testing.T) {
+	for _, definition := range []string{
+		`[id]: http://example.com/$path "Title with \ backslash"`,
+		`  [a\]b]: <http://example.com/$x$> '$y$'`,
+		`[id]: /$a$ (\cite{x})`,
+	} {
+		assert.Equal(t, "A <!--$x$-->\n"+definition+"\n<!--\\cite{x}-->", convertWithOptions("A $x$\n"+definition+"\n\\cite{x}", Options{}), definition)
+	}
+
+	// Not definitions
+	assert.Equal(t, "[^1]: <!--$x$-->", convertWithOptions("[^1]: $x$", Options{}))
+	assert.Equal(t, "[id]: /a <!--$x$-->", convertWithOptions("[id]: /a $x$", Options{}))
+	assert.Equal(t, "    [id]: <!--$x$-->", convertWithOptions("    [id]: $x$", Options{}))
+	assert.Equal(t, "a [id]: <!--$x$-->", convertWithOptions("a [id]: $x$", Options{}))
+}
+
+func TestMetadata(t *testing.T) {
+	metadata := "Title: Notes on $x$\nLaTeX Input: mmd-article-header\n  \\usepackage{amsmath}\nquotes language: english\n"
+	assert.Equal(t, metadata+"\nText <!--$x$-->", convertWithOptions(metadata+"\nText $x$", Options{}))
+	assert.Equal(t, "Title: \\foo\r\n\r\n<!--\\foo-->", convertWithOptions("Title: \\foo\r\n\r\n\\foo", Options{}))
+	assert.Equal(t, "Title: \\foo", convertWithOptions("Title: \\foo", Options{}))
+
+	// Not metadata
+	assert.Equal(t, "Title: <!--$x$-->\nand <!--$y$-->", convertWithOptions("Title: $x$\nand $y$", Options{}))
+	assert.Equal(t, "  Title: <!--$x$-->", convertWithOptions("  Title: $x$", Options{}))
+	assert.Equal(t, "a\n\nTitle: <!--$x$-->", convertWithOptions("a\n\nTitle: $x$", Options{}))
+}
+
+func TestCriticMarkup(t *testing.T) {
+	assert.Equal(t, "A <!--\\cite{x}-->{++ new ++} and <!--\\foo-->{-- old --}", convertWithOptions("A \\cite{x}{++ new ++} and \\foo{-- old --}", Options{}))
+	assert.Equal(t, "<!--\\foo-->{~~ a~>b ~~}{== c ==}{>> d <<}", convertWithOptions("\\foo{~~ a~>b ~~}{== c ==}{>> d <<}", Options{}))
+	assert.Equal(t, "{++ <!--$x$--> ++}", convertWithOptions("{++ $x$ ++}", Options{}))
+
+	// Inside of arguments
+	assert.Equal(t, "<!--\\foo{a {++ b ++} c}-->", convertWithOptions("\\foo{a {++ b ++} c}", Options{}))
+	assert.True(t, isCriticMarkup([]byte("{++a++}")))
+	assert.False(t, isCriticMarkup([]byte("{+")))
+	assert.False(t, isCriticMarkup([]byte("{++a\n\nb++}")))
+
+	// En dashes
+	assert.Equal(t, "<!--\\foo{--}{---}-->", convertWithOptions("\\foo{--}{---}", Options{}))
+}
+
+func TestWikiLinks(t *testing.T) {
+	options := Options{WikiLinks: true}
+	assert.Equal(t, "See <!--\\cite{x}-->[[Note $5]] and ![[plot $x$.png]] <!--$y$-->", convertWithOptions("See \\cite{x}[[Note $5]] and ![[plot $x$.png]] $y$", options))
+	assert.Equal(t, "<!--\\foo[a]-->[[b|c]]", convertWithOptions("\\foo[a][[b|c]]", options))
+	assert.Equal(t, "[[a <!--$x$-->\n]]", convertWithOptions("[[a $x$\n]]", options))
+
+	// Optional arguments in LaTeX
+	assert.Equal(t, "<!--\\item[[a]]-->", convertWithOptions("\\item[[a]]", Options{}))
+}
+
+func TestDefinitionsAndCaptionsAfterCommands(t *testing.T) {
+	assert.Equal(t, "Term <!--\\foo-->\n: definition <!--$x$-->", convertWithOptions("Term \\foo\n: definition $x$", Options{}))
+	assert.Equal(t, "| a | <!--\\foo{b}--> |\n| - | - |\n[Caption <!--$x$-->]", convertWithOptions("| a | \\foo{b} |\n| - | - |\n[Caption $x$]", Options{}))
+	assert.Equal(t, "<!--\\end{table}-->\n[Caption]", convertWithOptions("\\end{table}\n[Caption]", Options{}))
+}
+
+func TestLiterals(t *testing.T) {
+	assert.Equal(t, "Costs $5 and $6, <!--$x$-->", convertWithOptions("Costs <!--md-->$5 and $6<!--/md-->, $x$", Options{}))
+	assert.Equal(t, "a \\foo{<!--$x$-->}", convertWithOptions("a <!--raw-->\\foo{<!--/raw--><!--$x$-->}", Options{LiteralMarker: "raw"}))
+	assert.Equal(t, "&lt;$x$", convertWithOptions("<!--md--><$x$<!--/md-->", Options{EscapeHTML: true}))
+
+	// Not closed in the same paragraph
+	assert.Equal(t, "<!--md--><!--$x$-->\n\n<!--/md-->", convertWithOptions("<!--md-->$x$\n\n<!--/md-->", Options{}))
+	assert.Equal(t, "<!--md--><!--$x$-->", convertWithOptions("<!--md-->$x$", Options{}))
+}
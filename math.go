@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+)
+
+// Commands and environments that only make sense as math. When math is passed
+// through to MathJax they are emitted as math so MathJax (and its extensions)
+// can render them, otherwise they are wrapped like any other command.
+
+// Environments MathJax renders on their own, they are passed through as is
+var displayMathEnvironments = []string{
+	"equation", "align", "alignat", "flalign", "gather", "multline", "eqnarray", "displaymath",
+}
+
+// Environments that are only valid inside math. Inside a math span or one of
+// the displayMathEnvironments they are part of it, on their own they are
+// emitted as display math.
+var innerMathEnvironments = []string{
+	"split", "aligned", "alignedat", "gathered", "cases",
+	"matrix", "pmatrix", "bmatrix", "Bmatrix", "vmatrix", "Vmatrix", "smallmatrix", "array",
+}
+
+func init() {
+	for _, name := range displayMathEnvironments {
+		environmentConverters[name] = (*Converter).convertMathEnvironment
+		environmentConverters[name+"*"] = (*Converter).convertMathEnvironment
+	}
+	for _, name := range innerMathEnvironments {
+		environmentConverters[name] = (*Converter).convertMathEnvironment
+	}
+
+	// mhchem, MathJax renders these with its mhchem extension
+	commandConverters["ce"] = (*Converter).convertMathCommand
+	commandConverters["pu"] = (*Converter).convertMathCommand
+
+	commandConverters["boxed"] = (*Converter).convertMathCommand
+
+	commandConverters["ensuremath"] = (*Converter).convertEnsuremath
+}
+
+// Emits commands like \ce{H2O} as inline math $\ce{H2O}$
+func (c *Converter) convertMathCommand() bool {
+	if !c.options.MathPassthrough {
+		return false
+	}
+
+	start := c.cursor
+	name := c.commandName()
+	c.skipCommandName()
+
+	argument, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emitMath("\\" + name + "{" + argument + "}")
+	return true
+}
+
+// \ensuremath{x} is math by definition, its content is emitted as inline math
+func (c *Converter) convertEnsuremath() bool {
+	start := c.cursor
+	c.skipCommandName()
+
+	math, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emitMath(math)
+	return true
+}
+
+func (c *Converter) convertMathEnvironment() bool {
+	if !c.options.MathPassthrough && !c.options.NumberEquations && !c.options.UnicodeMath && c.options.RenderMath == "" {
+		return false
+	}
+
+	start := c.cursor
+	name := c.environmentName()
+	body, ok := c.readEnvironment()
+	if !ok {
+		return false
+	}
+	c.recordMath(start)
+
+	for _, inner := range innerMathEnvironments {
+		if name != inner {
+			continue
+		}
+		if !c.options.MathPassthrough && !c.options.UnicodeMath && c.options.RenderMath == "" {
+			c.cursor = start
+			return false
+		}
+		c.emitDisplayMath(string(c.in[start:c.cursor]))
+		return true
+	}
+
+	parts, texts := []string{body}, []string{}
+	if c.options.LiftIntertext && c.options.MathPassthrough {
+		parts, texts = splitIntertext(body)
+	}
+
+	for i, part := range parts {
+		if i > 0 {
+			c.emit("\n\n" + strings.TrimSpace(c.convertFragment(texts[i-1])) + "\n\n")
+		}
+		c.emitMathEnvironment(name, part, c.nextEquationTag)
+	}
+	return true
+}
+
+// Emits a display math environment after numbering its rows with |tag|, see
+// numberRows. With Options.NumberEquations labeled equations get an anchor
+// and their number next to them instead.
+func (c *Converter) emitMathEnvironment(name, body string, tag func(labeled bool) string) {
+	body, labels := c.numberRows(name, body, tag)
+
+	if c.options.NumberEquations && len(labels) > 0 {
+		var numbers []string
+		for _, l := range labels {
+			c.emit("<a id=\"" + c.doc.labels[l].anchor + "\"></a>")
+			numbers = append(numbers, "("+c.doc.labels[l].number+")")
+		}
+		c.emit(`<span class="equation-number" style="float: right">` + strings.Join(numbers, ", ") + "</span>\n")
+
+		// The renderer must not number them again
+		if !strings.HasSuffix(name, "*") {
+			name += "*"
+		}
+	}
+
+	environment := "\\begin{" + name + "}" + body + "\\end{" + name + "}"
+	if r, ok := c.renderer().(optionsRenderer); ok {
+		r.emitMathEnvironment(c.out, environment, body)
+	} else {
+		c.renderer().EmitMath(c.out, environment, true)
+	}
+}
+
+// Splits the body of a math environment at \intertext{text} and
+// \shortintertext{text}, returning the math parts and the texts between them
+func splitIntertext(body string) ([]string, []string) {
+	var parts, texts []string
+	c := ByteArrayToConverter([]byte(body))
+	partStart := 0
+
+	for !c.atEof() {
+		if c.environmentName() != "" {
+			if _, ok := c.readEnvironment(); ok {
+				continue
+			}
+		}
+
+		name := c.commandName()
+		if name != "intertext" && name != "shortintertext" {
+			c.cursor += 1
+			continue
+		}
+
+		partEnd := c.cursor
+		c.skipCommandName()
+		text, ok := c.readArgument()
+		if !ok {
+			continue
+		}
+
+		part := strings.TrimRight(string(c.in[partStart:partEnd]), " \t\n")
+		parts = append(parts, strings.TrimSuffix(part, "\\\\")+"\n")
+		texts = append(texts, text)
+		partStart = c.cursor
+	}
+	return append(parts, string(c.in[partStart:])), texts
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMathPassthrough(t *testing.T) {
+	passthrough := Options{MathPassthrough: true}
+	assert.Equal(t, "a <!--$x^2$--> b", convertWithOptions("a $x^2$ b", Options{}))
+	assert.Equal(t, "a $x^2$ b", convertWithOptions("a $x^2$ b", passthrough))
+	assert.Equal(t, "costs \\$5", convertWithOptions("costs \\$5", passthrough))
+}
+
+func TestUnterminatedMath(t *testing.T) {
+	assert.Equal(t, "<!--$x$-->", convertWithOptions("$x", Options{}))
+}
+
+func TestChemistryPassthrough(t *testing.T) {
+	passthrough := Options{MathPassthrough: true}
+	assert.Equal(t, "Water is $\\ce{H2O}$.", convertWithOptions("Water is \\ce{H2O}.", passthrough))
+	assert.Equal(t, "$\\ce{A -> B}$", convertWithOptions("$\\ce{A -> B}$", passthrough))
+	assert.Equal(t, "<!--\\ce{H2O}-->", convertWithOptions("\\ce{H2O}", Options{}))
+}
+
+func TestDisplayMath(t *testing.T) {
+	input := "$$a = \\boxed{b + c}$$"
+	assert.Equal(t, "<!--$$a = \\boxed{b + c}$$-->", convertWithOptions(input, Options{}))
+	assert.Equal(t, input, convertWithOptions(input, Options{MathPassthrough: true}))
+	assert.Equal(t, "<!--$$a \\$$ b$$-->", convertWithOptions("$$a \\$$ b$$", Options{}))
+
+	// \boxed is math, even outside of math
+	assert.Equal(t, "$\\boxed{x}$", convertWithOptions("\\boxed{x}", Options{MathPassthrough: true}))
+}
+
+func TestEnsuremath(t *testing.T) {
+	assert.Equal(t, "the <!--$\\alpha$--> value", convertWithOptions("the \\ensuremath{\\alpha} value", Options{}))
+	assert.Equal(t, "the $\\alpha$ value", convertWithOptions("the \\ensuremath{\\alpha} value", Options{MathPassthrough: true}))
+}
+
+func TestMathDelimiters(t *testing.T) {
+	assert.Equal(t, "a <!--$x$--> b", convertWithOptions("a \\(x\\) b", Options{}))
+	assert.Equal(t, "<!--$$[0, 1)$$-->", convertWithOptions("\\[[0, 1)\\]", Options{}))
+	assert.Equal(t, "$$a \\\\ b$$", convertWithOptions("\\[a \\\\ b\\]", Options{MathPassthrough: true}))
+
+	// Unterminated, wrapped as a command like before
+	assert.Equal(t, "<!--\\(x-->", convertWithOptions("\\(x", Options{}))
+}
+
+func TestEnvironmentsInsideMath(t *testing.T) {
+	cases := "f(x) = \\begin{cases} 0 & x < 0 \\\\ [1em] 1 & x \\geq 0 \\end{cases}"
+	matrix := "\\begin{pmatrix} a & b \\\\ c & d \\end{pmatrix}"
+	array := "\\left[\\begin{array}{cc} 1 & 2 \\end{array}\\right)"
+
+	for _, math := range []string{cases, matrix, array} {
+		assert.Equal(t, "<!--$"+math+"$-->", convertWithOptions("$"+math+"$", Options{}))
+		assert.Equal(t, "<!--$$"+math+"$$-->", convertWithOptions("$$"+math+"$$", Options{}))
+		assert.Equal(t, "<!--$"+math+"$-->", convertWithOptions("\\("+math+"\\)", Options{}))
+		assert.Equal(t, "<!--$$"+math+"$$-->", convertWithOptions("\\["+math+"\\]", Options{}))
+	}
+}
+
+func TestMathEnvironments(t *testing.T) {
+	passthrough := Options{MathPassthrough: true}
+
+	equation := "\\begin{equation}\\begin{split} a &= b \\\\ &= c \\end{split}\\end{equation}"
+	assert.Equal(t, "<!--"+equation+"-->", convertWithOptions(equation, Options{}))
+	assert.Equal(t, equation, convertWithOptions(equation, passthrough))
+
+	align := "\\begin{align*} x &= 1 \\end{align*}"
+	assert.Equal(t, align, convertWithOptions(align, passthrough))
+
+	// Inner environments need math around them, but only once
+	aligned := "\\begin{aligned} x &= 1 \\\\ y &= \\begin{gathered} 2 \\end{gathered} \\end{aligned}"
+	assert.Equal(t, "$$"+aligned+"$$", convertWithOptions(aligned, passthrough))
+	assert.Equal(t, "$$"+aligned+"$$", convertWithOptions("$$"+aligned+"$$", passthrough))
+}
+
+func TestIntertext(t *testing.T) {
+	input := "\\begin{align}\na &= 1 \\\\\n\\intertext{and hence $a$}\nb &= 2\n\\end{align}"
+	assert.Equal(t, input, convertWithOptions(input, Options{MathPassthrough: true}))
+
+	expected := "\\begin{align}\na &= 1 \n\\end{align}\n\nand hence $a$\n\n\\begin{align}\nb &= 2\n\\end{align}"
+	assert.Equal(t, expected, convertWithOptions(input, Options{MathPassthrough: true, LiftIntertext: true}))
+}
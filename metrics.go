@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics add up the statistics of conversions, for services converting many
+// documents to monitor their throughput and error rate. They are safe for
+// concurrent use and, as String returns JSON, can be published with expvar:
+//
+//	metrics := &Metrics{}
+//	expvar.Publish("merkderwn", metrics)
+//	options.OnConvert = metrics.Add
+//
+// Use Snapshot to export them elsewhere, e.g. to Prometheus.
+type Metrics struct {
+	documents, failed       int64
+	inputBytes, outputBytes int64
+	math                    int64
+	converted, wrapped      int64
+	comments, warnings      int64
+	duration                int64
+}
+
+// The totals of the conversions added to Metrics
+type MetricsSnapshot struct {
+	// Documents converted, including those failing with an error
+	Documents int64 `json:"documents"`
+	Failed    int64 `json:"failed"`
+
+	InputBytes  int64 `json:"input_bytes"`
+	OutputBytes int64 `json:"output_bytes"`
+
+	// Spans of the input by kind, see Stats
+	Math      int64 `json:"math"`
+	Converted int64 `json:"converted"`
+	Wrapped   int64 `json:"wrapped"`
+	Comments  int64 `json:"comments"`
+
+	Warnings int64         `json:"warnings"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Adds the statistics of a conversion and the error it failed with, if any
+func (m *Metrics) Add(stats Stats, err error) {
+	atomic.AddInt64(&m.documents, 1)
+	if err != nil {
+		atomic.AddInt64(&m.failed, 1)
+	}
+	atomic.AddInt64(&m.inputBytes, int64(stats.InputBytes))
+	atomic.AddInt64(&m.outputBytes, int64(stats.OutputBytes))
+	atomic.AddInt64(&m.math, int64(stats.Math))
+	atomic.AddInt64(&m.converted, int64(stats.Converted))
+	atomic.AddInt64(&m.wrapped, int64(stats.Wrapped))
+	atomic.AddInt64(&m.comments, int64(stats.Comments))
+	atomic.AddInt64(&m.warnings, int64(stats.Warnings))
+	atomic.AddInt64(&m.duration, int64(stats.Duration))
+}
+
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		Documents:   atomic.LoadInt64(&m.documents),
+		Failed:      atomic.LoadInt64(&m.failed),
+		InputBytes:  atomic.LoadInt64(&m.inputBytes),
+		OutputBytes: atomic.LoadInt64(&m.outputBytes),
+		Math:        atomic.LoadInt64(&m.math),
+		Converted:   atomic.LoadInt64(&m.converted),
+		Wrapped:     atomic.LoadInt64(&m.wrapped),
+		Comments:    atomic.LoadInt64(&m.comments),
+		Warnings:    atomic.LoadInt64(&m.warnings),
+		Duration:    time.Duration(atomic.LoadInt64(&m.duration)),
+	}
+}
+
+// Returns the snapshot as JSON, see expvar.Var
+func (m *Metrics) String() string {
+	out, _ := json.Marshal(m.Snapshot())
+	return string(out)
+}
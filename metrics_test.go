@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := &Metrics{}
+	options := Options{OnConvert: metrics.Add, Strict: true}
+
+	Convert([]byte("$x$ \\foo <!--y-->"), options)
+	Convert([]byte("$x"), options)
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, int64(2), snapshot.Documents)
+	assert.Equal(t, int64(1), snapshot.Failed)
+	assert.Equal(t, int64(19), snapshot.InputBytes)
+	assert.Equal(t, int64(2), snapshot.Math)
+	assert.Equal(t, int64(1), snapshot.Wrapped)
+	assert.Equal(t, int64(1), snapshot.Comments)
+	assert.Equal(t, int64(1), snapshot.Warnings)
+	assert.True(t, snapshot.Duration > 0)
+
+	var decoded MetricsSnapshot
+	assert.NoError(t, json.Unmarshal([]byte(metrics.String()), &decoded))
+	assert.Equal(t, snapshot, decoded)
+}
+
+func TestMetricsConcurrent(t *testing.T) {
+	metrics := &Metrics{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics.Add(Stats{InputBytes: 3, Duration: time.Millisecond}, nil)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), metrics.Snapshot().Documents)
+	assert.Equal(t, int64(30), metrics.Snapshot().InputBytes)
+	assert.Equal(t, 10*time.Millisecond, metrics.Snapshot().Duration)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"io/ioutil"
+)
+
+// Reads the file at |path|, memory mapping is only supported on Unix
+func MapFile(path string) (data []byte, unmap func() error, err error) {
+	data, err = ioutil.ReadFile(path)
+	return data, func() error { return nil }, err
+}
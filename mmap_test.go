@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.xmd")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("Größe $x$"), 0644))
+	data, unmap, err := MapFile(path)
+	assert.NoError(t, err)
+	out, _, err := Convert(data, Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, unmap())
+	assert.Equal(t, "Größe <!--$x$-->", string(out))
+
+	empty := filepath.Join(dir, "empty.xmd")
+	assert.NoError(t, ioutil.WriteFile(empty, nil, 0644))
+	data, unmap, err = MapFile(empty)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+	assert.NoError(t, unmap())
+
+	_, _, err = MapFile(filepath.Join(dir, "missing.xmd"))
+	assert.Error(t, err)
+}
+
+func TestConvertMappedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.xmd"), filepath.Join(dir, "b.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$x$"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("$y$ is too large"), 0644))
+
+	r := run{mmap: true, maxFileSize: 10}
+	assert.Equal(t, 1, r.convertFiles([]string{a, b}))
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "a.md"))
+	assert.Equal(t, "<!--$x$-->", string(out))
+
+	r.chunkSize = 2
+	assert.Equal(t, 1, r.convertFiles([]string{a, b}))
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "a.md"))
+	assert.Equal(t, "<!--$x$-->", string(out))
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// Maps the file at |path| into memory instead of reading it, so only the
+// pages touched while converting are resident. The data is read-only and
+// must not be used after calling |unmap|. Files which cannot be mapped, like
+// pipes, are read instead.
+func MapFile(path string) (data []byte, unmap func() error, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() || info.Size() == 0 {
+		data, err := ioutil.ReadAll(file)
+		return data, func() error { return nil }, err
+	}
+
+	data, err = syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conversion of margin notes, depending on Options.MarginNotes either to
+//
+//      <aside class="marginnote">text</aside>
+//
+// or to a footnote whose definition is appended to the document.
+
+func init() {
+	commandConverters["marginpar"] = (*Converter).convertMarginNote
+	commandConverters["marginnote"] = (*Converter).convertMarginNote
+}
+
+// \marginpar[left text]{text} and \marginnote{text}[offset]
+func (c *Converter) convertMarginNote() bool {
+	style := c.options.MarginNotes
+	if style != "aside" && style != "footnote" {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+	note, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+	c.readOptionalArgument()
+
+	note = strings.TrimSpace(c.convertFragment(note))
+	if style == "aside" {
+		c.emit("<aside class=\"marginnote\">" + note + "</aside>")
+	} else {
+		c.emitFootnote(note)
+	}
+	return true
+}
+
+// Emits a footnote reference, the definition goes to the end of the document.
+// Its lines after the first are indented, see prefixes.go.
+func (c *Converter) emitFootnote(text string) {
+	id := fmt.Sprintf("note-%d", len(c.doc.footnotes)+1)
+	c.doc.footnotes = append(c.doc.footnotes, fmt.Sprintf("[^%s]: %s", id, addPrefix(text, footnoteIndentation)))
+	c.emit("[^" + id + "]")
+}
+
+func (c *Converter) appendFootnotes() {
+	if len(c.doc.footnotes) > 0 {
+		c.emit("\n\n" + strings.Join(c.doc.footnotes, "\n") + "\n")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMarginNotes(t *testing.T) {
+	input := "Fast\\marginpar{Check $n$!} and safe\\marginnote{Really?}[1cm]."
+	assert.Equal(t, "Fast<!--\\marginpar{Check $n$!}--> and safe<!--\\marginnote{Really?}[1cm]-->.",
+		convertWithOptions(input, Options{}))
+
+	assert.Equal(t, "Fast<aside class=\"marginnote\">Check <!--$n$-->!</aside> and "+
+		"safe<aside class=\"marginnote\">Really?</aside>.",
+		convertWithOptions(input, Options{MarginNotes: "aside"}))
+
+	assert.Equal(t, "Fast[^note-1] and safe[^note-2].\n\n"+
+		"[^note-1]: Check <!--$n$-->!\n"+
+		"[^note-2]: Really?\n",
+		convertWithOptions(input, Options{MarginNotes: "footnote"}))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Packages loaded with \usepackage and the options enabling their conversion.
+// listings and minted need none, \lstinline is always converted.
+var packageOptions = map[string]func(options *Options){
+	"siunitx":  func(options *Options) { options.Units = true },
+	"hyperref": func(options *Options) { options.Links = true },
+	"url":      func(options *Options) { options.Links = true },
+	"soul":     func(options *Options) { options.Formatting = true },
+	"ulem":     func(options *Options) { options.Formatting = true },
+}
+
+// Enables the options for all packages loaded in |in|
+func enablePackageOptions(in []byte, options *Options) {
+	for _, name := range loadedPackages(in) {
+		if enable, ok := packageOptions[name]; ok {
+			enable(options)
+		}
+	}
+}
+
+// Returns the packages loaded with \usepackage[...]{a,b} or \RequirePackage
+// in the preamble, i.e. before \begin{document} if there is one. Verbatim,
+// code and comments are skipped, as they do not load anything.
+func loadedPackages(in []byte) []string {
+	var packages []string
+	c := ByteArrayToConverter(in)
+	for !c.atEof() {
+		if c.skipCode() {
+			continue
+		}
+
+		switch c.commandName() {
+		case "usepackage", "RequirePackage":
+			c.skipCommandName()
+			c.readOptionalArgument()
+			if names, ok := c.readArgument(); ok {
+				for _, name := range strings.Split(names, ",") {
+					packages = append(packages, strings.TrimSpace(name))
+				}
+			}
+		case "begin":
+			if c.environmentName() == "document" {
+				return packages
+			}
+			c.cursor += 1
+		case "verb":
+			if !c.convertVerb() {
+				c.cursor += 1
+			}
+		case "lstinline", "mintinline":
+			if !c.convertInlineListing() {
+				c.cursor += 1
+			}
+		default:
+			c.cursor += 1
+		}
+	}
+	return packages
+}
+
+// Moves the cursor past a comment or a Markdown code span or block at the
+// cursor, if there is one
+func (c *Converter) skipCode() bool {
+	switch {
+	case c.current() == "<" && c.lookahead(3) == "!--":
+		c.cursor += 4
+		if c.skipTo("-->") {
+			c.cursor += 3
+		}
+		return true
+	case c.current() == "`":
+		end := c.cursor
+		for end < c.inputLength && c.in[end] == '`' {
+			end += 1
+		}
+		fence := c.in[c.cursor:end]
+		c.cursor = end
+		if i := bytes.Index(c.in[end:], fence); i >= 0 {
+			c.cursor = end + i + len(fence)
+		}
+		return true
+	}
+	return false
+}
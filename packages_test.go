@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoadedPackages(t *testing.T) {
+	input := "\\usepackage[utf8]{inputenc}\n\\usepackage{siunitx, hyperref}\n\\RequirePackage{soul}"
+	assert.Equal(t, []string{"inputenc", "siunitx", "hyperref", "soul"}, loadedPackages([]byte(input)))
+
+	// Only packages which are actually loaded count
+	input = "\\verb|\\usepackage{siunitx}| `\\usepackage{soul}` <!--\\usepackage{url}-->\n" +
+		"```\n\\usepackage{ulem}\n```\n\\usepackage{hyperref}\n\\begin{document}\\usepackage{listings}"
+	assert.Equal(t, []string{"hyperref"}, loadedPackages([]byte(input)))
+}
+
+func TestDetectPackages(t *testing.T) {
+	input := "\\usepackage{siunitx}\n\\SI{3}{\\meter} \\url{x}"
+	assert.Equal(t, "<!--\\usepackage{siunitx}-->\n3 m <!--\\url{x}-->", convertWithOptions(input, Options{DetectPackages: true}))
+	assert.Equal(t, "<!--\\usepackage{siunitx}-->\n<!--\\SI{3}{\\meter}--> <!--\\url{x}-->", convertWithOptions(input, Options{}))
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Conversion of one large document on several cores. The input is split into
+// segments at blank lines, which are converted at the same time and joined
+// in order.
+//
+// Whether a blank line is outside of any construct is only known once the
+// input before it is converted, which is what takes long. So the segments
+// are converted on the assumption that they are, each converter carrying on
+// past the end of its segment until what it converts ends. If it ends after
+// the blank line, e.g. in an environment spanning several paragraphs, the
+// next segment is converted again from where it ended. Input which is a
+// single construct, e.g. \begin{document} ... \end{document}, is thus not
+// converted faster.
+//
+// Segments have a document of their own, options which need the state of
+// the document before are not supported, see parallelizable. Renderers are
+// used by several segments at once, rendered math is written so that
+// segments rendering the same math do not get in each other's way.
+
+// Segments are at least this long, shorter ones are not worth the overhead
+const minSegmentSize = 1 << 16
+
+// Segments per job, so jobs converting faster take on the segments of the
+// slower ones
+const segmentsPerJob = 4
+
+// Same as Convert with |jobs| segments converted at the same time, or as
+// many as there are CPUs if it is 0. The output is the same, except that
+// renderers may get text in more runs.
+func ConvertParallel(in []byte, options Options, jobs int) ([]byte, Report, error) {
+	if err := options.validate(); err != nil {
+		return nil, Report{}, err
+	}
+	if err := binaryInput(in); err != nil {
+		return nil, Report{}, err
+	}
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	return convertParallel(in, options, jobs, minSegmentSize)
+}
+
+// Same as ConvertParallel with segments of at least |minSize| bytes
+func convertParallel(in []byte, options Options, jobs, minSize int) ([]byte, Report, error) {
+	start := time.Now()
+	base := NewConverter(in, options)
+	if err := base.options.parallelizable(); err != nil {
+		return nil, Report{}, err
+	}
+
+	var deadline time.Time
+	if options.Timeout > 0 {
+		deadline = start.Add(options.Timeout)
+	}
+
+	doc := base.doc
+	if doc.invalid != nil {
+		doc.problems = append(doc.problems, doc.invalid)
+		base.warnAt(doc.invalid.Position.Line, doc.invalid.Position.Column, "%s", ErrInvalidUTF8)
+	}
+
+	segments := base.segments(jobs, minSize)
+	base.convertSegments(segments, jobs, deadline)
+
+	// Segments are right if the one before ended where they start
+	next := 0
+	for i := range segments {
+		s := &segments[i]
+		if s.end <= next {
+			s.doc, s.out = nil, nil
+			continue
+		}
+		if s.start != next {
+			base.log(slog.LevelDebug, next, "Converting segment again", "converted-from", s.start)
+			*s = base.convertSegment(next, s.end, deadline)
+		}
+		next = s.stop
+	}
+
+	size := 0
+	for _, s := range segments {
+		size += len(s.out)
+	}
+	base.out.Grow(size)
+	for _, s := range segments {
+		if s.doc == nil {
+			continue
+		}
+		base.out.Write(s.out)
+		doc.warnings = append(doc.warnings, s.doc.warnings...)
+		doc.problems = append(doc.problems, s.doc.problems...)
+		doc.stats.add(s.doc.stats)
+		if doc.err == nil {
+			doc.err = s.doc.err
+		}
+	}
+	base.finish()
+	out := base.out.Bytes()
+
+	stats := doc.stats
+	stats.InputBytes, stats.OutputBytes = len(in), len(out)
+	stats.Warnings = len(doc.warnings)
+	stats.Duration = time.Since(start)
+	report := Report{Warnings: doc.warnings, Stats: stats}
+
+	err := doc.err
+	if err == nil && options.Strict && len(doc.problems) > 0 {
+		err = doc.problems[0]
+	}
+	if options.OnConvert != nil {
+		options.OnConvert(stats, err)
+	}
+	if err != nil {
+		return nil, report, err
+	}
+	return out, report, nil
+}
+
+// A part of the input from byte start up to (excluding) byte end, converted
+// up to stop
+type segment struct {
+	start, end, stop int
+	out              []byte
+	doc              *document
+}
+
+// Splits the input into segments for |jobs| jobs, at the first blank line
+// after their size
+func (c *Converter) segments(jobs, minSize int) []segment {
+	size := c.inputLength / (jobs * segmentsPerJob)
+	if size < minSize {
+		size = minSize
+	}
+
+	var segments []segment
+	start := 0
+	for start+size < c.inputLength {
+		i := bytes.Index(c.in[start+size:], []byte("\n\n"))
+		end := start + size + i + 2
+		if i < 0 || end >= c.inputLength {
+			break
+		}
+		segments = append(segments, segment{start: start, end: end})
+		start = end
+	}
+	return append(segments, segment{start: start, end: c.inputLength})
+}
+
+// Converts the segments with |jobs| goroutines
+func (c *Converter) convertSegments(segments []segment, jobs int, deadline time.Time) {
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < jobs; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				segments[i] = c.convertSegment(segments[i].start, segments[i].end, deadline)
+			}
+		}()
+	}
+
+	for i := range segments {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// Converts the input from |start| up to |end| or past it, with a document of
+// its own. The whole input is kept, so positions and what handlers look at
+// around the cursor are the same as for the whole document.
+func (c *Converter) convertSegment(start, end int, deadline time.Time) segment {
+	doc := &document{headings: headingState{top: -1}, deadline: deadline}
+
+	s := *c
+	s.cursor = start
+	s.out = new(bytes.Buffer)
+	s.out.Grow(end - start + (end-start)/4)
+	s.doc = doc
+	s.convertUntil(end)
+
+	return segment{start, end, s.cursor, s.out.Bytes(), doc}
+}
+
+// Adds the counts of |other|
+func (s *Stats) add(other Stats) {
+	s.Math += other.Math
+	s.Converted += other.Converted
+	s.Wrapped += other.Wrapped
+	s.Comments += other.Comments
+}
+
+// Checks that segments can be converted without the document before them
+func (options Options) parallelizable() error {
+	if err := options.chunkable(); err != nil {
+		return err
+	}
+
+	switch {
+	case options.Floats:
+		return errors.New("Numbering figures and tables needs the whole document")
+	case options.Index == "anchor" || options.Index == "generate":
+		return errors.New("Numbering index entries needs the whole document")
+	case options.MarginNotes == "footnote":
+		return errors.New("Numbering footnotes needs the whole document")
+	case options.Expand:
+		return errors.New("Expanding definitions needs the whole document")
+	case options.Conditionals == "drop":
+		return errors.New("Deciding \\ifdefined needs the whole document")
+	case options.ShiftHeadings != 0:
+		return errors.New("Telling headings from code blocks needs the whole document")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const parallelDocument = `\usepackage{siunitx}
+Text with $x$ and \SI{3}{\meter}.
+
+$$a
+
+b$$
+
+\begin{tikzpicture}
+
+\end{tikzpicture}
+
+<!-- a
+
+comment -->
+
+Größe $y
+
+\foo{a
+
+b}
+
+\bar{
+`
+
+func TestConvertParallel(t *testing.T) {
+	options := Options{DetectPackages: true}
+	for _, in := range []string{parallelDocument, "\xff" + parallelDocument, strings.Repeat(parallelDocument+"\n\n", 5)} {
+		expected, expectedReport, err := Convert([]byte(in), options)
+		assert.NoError(t, err)
+
+		for _, size := range []int{1, 3, 16, 100, 10000} {
+			for _, jobs := range []int{1, 3} {
+				name := fmt.Sprint("size ", size, ", jobs ", jobs)
+				out, report, err := convertParallel([]byte(in), options, jobs, size)
+				assert.NoError(t, err)
+				assert.Equal(t, string(expected), string(out), name)
+				assert.Equal(t, expectedReport.Warnings, report.Warnings, name)
+
+				expectedReport.Stats.Duration, report.Stats.Duration = 0, 0
+				assert.Equal(t, expectedReport.Stats, report.Stats, name)
+			}
+		}
+	}
+}
+
+func TestConvertParallelStrict(t *testing.T) {
+	_, _, err := convertParallel([]byte("a\n\nb $x\n\nc\\foo{"), Options{Strict: true}, 2, 1)
+	var positionErr *PositionError
+	assert.True(t, errors.As(err, &positionErr))
+	assert.Equal(t, Position{5, 3, 3}, positionErr.Position)
+}
+
+func TestConvertParallelRendersMath(t *testing.T) {
+	options := renderOptions(t, "printf '<svg/>'")
+	options.InlineMathImages = true
+	in := []byte(strings.Repeat("$x$ and $y$\n\n", 50))
+
+	expected, _, err := Convert(in, options)
+	assert.NoError(t, err)
+	out, _, err := convertParallel(in, options, 4, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(out))
+
+	// Only the images are left
+	files, _ := ioutil.ReadDir(options.AssetsDir)
+	assert.Len(t, files, 2)
+}
+
+func TestSegments(t *testing.T) {
+	c := ByteArrayToConverter([]byte("a\n\nb\n\n\nc\n\n"))
+	assert.Equal(t, []segment{{start: 0, end: 3}, {start: 3, end: 6}, {start: 6, end: 10}}, c.segments(2, 1))
+	assert.Equal(t, []segment{{start: 0, end: 10}}, c.segments(2, 100))
+}
+
+func TestConvertParallelNeedsParallelizableOptions(t *testing.T) {
+	for _, options := range []Options{{Headings: true}, {Floats: true}, {Index: "anchor"}, {MarginNotes: "footnote"}, {Expand: true}, {Slides: true}, {NumberEquations: true}} {
+		_, _, err := ConvertParallel([]byte("a"), options, 2)
+		assert.Error(t, err)
+	}
+
+	// Enabled for a package
+	_, _, err := ConvertParallel([]byte("\\usepackage{hyperref}"), Options{DetectPackages: true}, 2)
+	assert.NoError(t, err)
+}
+
+func BenchmarkThesisParallel(b *testing.B) {
+	in := []byte(strings.Repeat(thesisParagraph, 1000))
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ConvertParallel(in, Options{}, 0)
+	}
+}
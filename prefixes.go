@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// Environments in Markdown blockquotes, list items and footnote definitions,
+// whose lines start with the "> " of the blockquote or the indentation of the
+// item or footnote, e.g.
+//
+//	> \begin{itemize}
+//	> \item First
+//	> \end{itemize}
+//
+//	1. \begin{align}
+//	   x
+//	   \end{align}
+//
+//	[^1]: \begin{align}
+//	    x
+//	    \end{align}
+//
+// They are converted without the prefix, as if they were not quoted, and the
+// prefix is put in front of each line of the output again, so the blockquote
+// list or footnote goes on after them. Like other fragments, their problems are not reported
+// at a position and their math is not validated.
+
+// A list item marker at the end of the line up to an environment, after the
+// blockquotes and indentation the item is in
+var listItemPrefixRegexp = regexp.MustCompile(`^([ \t>]*)([-*+]|[0-9]{1,9}[.)])([ \t]+)$`)
+
+// The start of a footnote definition up to an environment. Footnotes of
+// several lines are indented by four spaces.
+var footnotePrefixRegexp = regexp.MustCompile(`^([ \t>]*)\[\^[^\]]+\]:[ \t]*$`)
+
+const footnoteIndentation = "    "
+
+// Returns the prefix of the lines of the environment at the cursor if the
+// line up to it is one, e.g. "> " or "> > ", or the indentation of the list
+// item or footnote it is in, e.g. "   " for "1. "
+func (c *Converter) blockPrefix() (string, bool) {
+	lineStart := bytes.LastIndexByte(c.in[:c.cursor], '\n') + 1
+	prefix := string(c.in[lineStart:c.cursor])
+	if m := listItemPrefixRegexp.FindStringSubmatch(prefix); m != nil {
+		return m[1] + strings.Repeat(" ", len(m[2])) + m[3], true
+	}
+	if m := footnotePrefixRegexp.FindStringSubmatch(prefix); m != nil {
+		return m[1] + footnoteIndentation, true
+	}
+	if prefix == "" || strings.Trim(prefix, "> \t") != "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// Converts the environment at the cursor if it spans several lines of a
+// blockquote or list item
+func (c *Converter) handlePrefixedEnvironment() bool {
+	prefix, ok := c.blockPrefix()
+	if !ok {
+		return false
+	}
+
+	start := c.cursor
+	if _, ok := c.readEnvironment(); !ok || bytes.IndexByte(c.in[start:c.cursor], '\n') < 0 {
+		c.cursor = start
+		return false
+	}
+
+	// Lines of list items and footnotes can not be continued lazily, they
+	// end the item
+	latex, all := removePrefix(string(c.in[start:c.cursor]), prefix)
+	if !all && !strings.Contains(prefix, ">") {
+		c.cursor = start
+		return false
+	}
+	c.emit(addPrefix(c.convertFragment(latex), prefix))
+	return true
+}
+
+// Removes |prefix| from the lines of |s| after the first and returns
+// whether all of them had it. Lines without it are kept as they are, like
+// Markdown continues blockquotes lazily.
+func removePrefix(s, prefix string) (string, bool) {
+	trimmed := strings.TrimRight(prefix, " \t")
+	all := true
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], prefix) {
+			lines[i] = lines[i][len(prefix):]
+		} else if strings.HasPrefix(lines[i], trimmed) && strings.TrimSpace(lines[i][len(trimmed):]) == "" {
+			lines[i] = ""
+		} else if strings.HasPrefix(lines[i], trimmed) && trimmed != "" {
+			lines[i] = lines[i][len(trimmed):]
+		} else {
+			all = all && strings.TrimSpace(lines[i]) == ""
+		}
+	}
+	return strings.Join(lines, "\n"), all
+}
+
+// Puts |prefix| in front of the lines of |s| after the first, without its
+// trailing spaces on empty lines
+func addPrefix(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = prefix + lines[i]
+		} else if i < len(lines)-1 {
+			lines[i] = strings.TrimRight(prefix, " \t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQuotedEnvironments(t *testing.T) {
+	quoted := "> a\n> \\begin{itemize}\n> \\item b\n>\n> \\item c\n> \\end{itemize}\n> d"
+
+	// Wrapped environments keep the prefixes of the input
+	assert.Equal(t, "> a\n> <!--\\begin{itemize}\n> \\item b\n>\n> \\item c\n> \\end{itemize}-->\n> d", convertWithOptions(quoted, Options{}))
+	assert.Equal(t, "> a\n> - b\n> - c\n> d", convertWithOptions(quoted, Options{Lists: true}))
+
+	assert.Equal(t, "> > <a id=\"eq:x\"></a><span class=\"equation-number\" style=\"float: right\">(1)</span>\n> > \\begin{align*}\n> > x \\label{eq:x}\n> > \\end{align*}",
+		convertWithOptions("> > \\begin{align}\n> > x \\label{eq:x}\n> > \\end{align}", Options{NumberEquations: true, MathPassthrough: true}))
+
+	// Lazily continued lines
+	assert.Equal(t, "> - b\n> - c", convertWithOptions("> \\begin{itemize}\n\\item b\n> \\item c\n\\end{itemize}", Options{Lists: true}))
+	assert.Equal(t, "> <!--\\begin{foo}x\\end{foo}-->", convertWithOptions("> \\begin{foo}x\\end{foo}", Options{}))
+}
+
+func TestListItemEnvironments(t *testing.T) {
+	options := Options{Floats: true}
+	assert.Equal(t, "- a\n  <a id=\"figure-1\"></a>\n  ![X](x.png)\n- b",
+		convertWithOptions("- a\n  \\begin{figure}\n  \\includegraphics{x.png}\n  \\caption{X}\n  \\end{figure}\n- b", options))
+	assert.Equal(t, "1. <a id=\"figure-1\"></a>\n   ![X](x.png)\n2. b",
+		convertWithOptions("1. \\begin{figure}\n   \\includegraphics{x.png}\\caption{X}\n   \\end{figure}\n2. b", options))
+	assert.Equal(t, "> * <a id=\"figure-1\"></a>\n>   ![X](x.png)",
+		convertWithOptions("> * \\begin{figure}\n>   \\includegraphics{x.png}\\caption{X}\\end{figure}", options))
+
+	// Lines which are not indented end the item, the environment is
+	// converted as usual
+	assert.Equal(t, "- <!--\\begin{foo}\nx\n\\end{foo}-->", convertWithOptions("- \\begin{foo}\nx\n\\end{foo}", Options{}))
+}
+
+func TestFootnoteEnvironments(t *testing.T) {
+	assert.Equal(t, "[^1]: proof uses $\\epsilon$-$\\delta$", convertWithOptions("[^1]: proof uses $\\epsilon$-$\\delta$", Options{MathPassthrough: true}))
+
+	footnote := "Text[^1].\n\n[^1]: \\begin{align}\n    x \\label{eq:x}\n    \\end{align}\n\n    More.\n"
+	assert.Equal(t, "Text[^1].\n\n[^1]: <a id=\"eq:x\"></a><span class=\"equation-number\" style=\"float: right\">(1)</span>\n    \\begin{align*}\n    x \\label{eq:x}\n    \\end{align*}\n\n    More.\n",
+		convertWithOptions(footnote, Options{MathPassthrough: true, NumberEquations: true}))
+
+	// Margin notes which become footnotes
+	assert.Equal(t, "a[^note-1]\n\n[^note-1]: - b\n    - c\n",
+		convertWithOptions("a\\marginpar{\\begin{itemize}\\item b\\item c\\end{itemize}}", Options{MarginNotes: "footnote", Lists: true}))
+}
+
+func TestPrefixes(t *testing.T) {
+	removed, all := removePrefix("a\n> b\n>\n> c", "> ")
+	assert.Equal(t, "a\nb\n\nc", removed)
+	assert.True(t, all)
+	_, all = removePrefix("a\n  b\n\n c", "  ")
+	assert.False(t, all)
+	assert.Equal(t, "a\n> b\n>\n> c\n", addPrefix("a\nb\n\nc\n", "> "))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Presets enable the options suitable for a particular target. They add to
+// the options given explicitly.
+var presets = map[string]func(options *Options){
+	// Beamer decks to reveal.js/Marp slides
+	"slides": func(options *Options) {
+		options.Slides = true
+		options.Lists = true
+		options.Headings = true
+		options.Floats = true
+		options.MathPassthrough = true
+	},
+
+	// Notes to import as Anki cards, Anki's MathJax only looks for \(...\)
+	// and \[...\] and fields are HTML
+	"anki": func(options *Options) {
+		options.MathPassthrough = true
+		options.MathDelimiters = "latex"
+		options.EscapeHTML = true
+	},
+
+	// Websites rendering math with MathJax or KaTeX
+	"mathjax": func(options *Options) {
+		options.MathPassthrough = true
+	},
+
+	// Markdown for pandoc, e.g. for PDFs, which reads $...$ and turns
+	// headings, lists, links and images with captions into LaTeX again
+	"pandoc": func(options *Options) {
+		options.MathPassthrough = true
+		options.Headings = true
+		options.Lists = true
+		options.Links = true
+		options.Floats = true
+	},
+
+	// Pages to paste into Confluence, which shows HTML comments as text
+	"confluence": func(options *Options) {
+		options.MathPassthrough = true
+		options.MathDelimiters = "confluence"
+		options.Wrap = "noformat"
+	},
+
+	// Readable plain text for chat and email, where nothing renders math
+	"plaintext": func(options *Options) {
+		options.UnicodeMath = true
+		options.Wrap = "drop"
+		options.Units = true
+		options.Logos = true
+		options.Today = true
+		options.Links = true
+		options.Lists = true
+		options.Headings = true
+		options.Conditionals = "drop"
+	},
+
+	// Chapters for EPUB packagers, which need valid XHTML. Math is rendered
+	// to images in case the reader has no MathML support and nothing is left
+	// in comments.
+	"epub": func(options *Options) {
+		options.RenderMath = "svg"
+		options.Wrap = "drop"
+		options.EscapeHTML = true
+		options.Headings = true
+		options.Lists = true
+		options.Floats = true
+		options.Formatting = true
+		options.Links = true
+		options.Units = true
+		options.Logos = true
+		options.Conditionals = "drop"
+	},
+}
+
+func applyPreset(name string, options *Options) error {
+	preset, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("Unknown preset %s, expected one of: %s", name, presetNames())
+	}
+
+	preset(options)
+	return nil
+}
+
+func presetNames() string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Formats to convert to are presets, given like "mathjax,pandoc"
+func parseFormats(list string) ([]string, error) {
+	var formats []string
+	for _, format := range strings.Split(list, ",") {
+		if format = strings.TrimSpace(format); format != "" {
+			formats = append(formats, format)
+		}
+	}
+	return formats, checkFormats(formats)
+}
+
+func checkFormats(formats []string) error {
+	for _, format := range formats {
+		if _, ok := presets[format]; !ok {
+			return fmt.Errorf("Unknown format %s, expected one of: %s", format, presetNames())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestAnkiPreset(t *testing.T) {
+	var anki Options
+	assert.NoError(t, applyPreset("anki", &anki))
+
+	input := `If $a < b$ & $$b < c$$ then \(a < c\) <!--\cite{x}-->
+\begin{align}a &= b\end{align}`
+	expected := `If \(a &lt; b\) &amp; \[b &lt; c\] then \(a &lt; c\) <!--\cite{x}-->
+\[\begin{align}a &amp;= b\end{align}\]`
+	assert.Equal(t, expected, convertWithOptions(input, anki))
+}
+
+func TestLatexMathDelimiters(t *testing.T) {
+	options := Options{MathPassthrough: true, MathDelimiters: "latex"}
+	assert.Equal(t, "\\(x\\) and \\[y < z\\]", convertWithOptions("$x$ and $$y < z$$", options))
+}
+
+func TestConfluencePreset(t *testing.T) {
+	var confluence Options
+	assert.NoError(t, applyPreset("confluence", &confluence))
+
+	input := `See $x$ and \cite{knuth} <!--\foo-->
+\begin{tikzpicture}\draw (0,0);\end{tikzpicture}
+\begin{equation}a\end{equation}`
+	expected := `See {mathinline}x{mathinline} and {noformat}\cite{knuth}{noformat} {noformat}\foo{noformat}
+{noformat}\begin{tikzpicture}\draw (0,0);\end{tikzpicture}{noformat}
+{mathdisplay}\begin{equation}a\end{equation}{mathdisplay}`
+	assert.Equal(t, expected, convertWithOptions(input, confluence))
+}
+
+func TestNoformatWrapping(t *testing.T) {
+	options := Options{Wrap: "noformat"}
+	assert.Equal(t, "{noformat}$x${noformat} {noformat}\\ref{a}{noformat}", convertWithOptions("$x$ \\ref{a}", options))
+	assert.Equal(t, "{code}\\foo{{noformat}}{code}", convertWithOptions("\\foo{{noformat}}", options))
+}
+
+func TestPlaintextPreset(t *testing.T) {
+	var plaintext Options
+	assert.NoError(t, applyPreset("plaintext", &plaintext))
+
+	input := `\section{Results}
+We found \emph{exactly} $\alpha \approx 0.5$\cite{knuth}.
+\begin{tikzpicture}\draw (0,0);\end{tikzpicture}
+\iffalse draft \fi<!--\vspace{1em}-->Done.`
+	expected := `# Results
+We found exactly α ≈ 0.5.
+
+Done.`
+	assert.Equal(t, expected, convertWithOptions(input, plaintext))
+}
+
+func TestEpubPreset(t *testing.T) {
+	var epub Options
+	assert.NoError(t, applyPreset("epub", &epub))
+	epub.AssetsDir = renderOptions(t, "").AssetsDir
+	epub.RenderCommand = "printf '<svg/>'"
+	epub.InlineMathImages = true
+
+	input := `\section{A & B}
+If $a<b$ then \textbf{a} <!--\vspace{1em}--> \label{x}`
+	expected := `# A &amp; B
+If <img src="data:image/svg+xml;base64,PHN2Zy8+" alt="a&lt;b"/> then a`
+	assert.Equal(t, expected, strings.TrimSpace(convertWithOptions(input, epub)))
+
+	// Math which could not be rendered is not dropped
+	epub.RenderCommand = "false"
+	c := NewConverter([]byte("Text $\\badmacro$ and"), epub)
+	assert.Equal(t, "Text `$\\badmacro$` and", string(c.Convert()))
+	assert.Len(t, c.doc.problems, 1)
+}
+
+func TestParseFormats(t *testing.T) {
+	formats, err := parseFormats("mathjax, pandoc,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mathjax", "pandoc"}, formats)
+
+	formats, err = parseFormats("")
+	assert.NoError(t, err)
+	assert.Empty(t, formats)
+
+	_, err = parseFormats("mathjax,html")
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Resolution of \ref, \eqref and \autoref to links, with Options.NumberEquations.
+// Labels of equations, figures, tables and converted headings are known, all
+// others are wrapped as before. As references may come before their labels,
+// they are emitted as markers first and resolved once the whole document is
+// converted.
+//
+// Labels of other files link to the converted file, see includes.go.
+
+// Something \ref can refer to
+type label struct {
+	// What \ref shows, the number or the title of a heading
+	number string
+	anchor string
+
+	// The converted file defining the label, "" for the current one
+	file string
+
+	// "equation", "figure", "table" or "section"
+	kind string
+}
+
+var referenceMarkerRegexp = regexp.MustCompile("\x00(ref|eqref|autoref)\\{([^}\x00]*)\\}\x00")
+
+var referenceNames = map[string]string{
+	"equation": "Equation",
+	"figure":   "Figure",
+	"table":    "Table",
+}
+
+func init() {
+	commandConverters["ref"] = (*Converter).convertReference
+	commandConverters["eqref"] = (*Converter).convertReference
+	commandConverters["autoref"] = (*Converter).convertReference
+}
+
+// Remembers what \ref{label} refers to
+func (c *Converter) setLabel(name, number, kind string) {
+	if c.doc.labels == nil {
+		c.doc.labels = map[string]label{}
+	}
+	name = strings.TrimSpace(name)
+	c.doc.labels[name] = label{
+		number: strings.TrimSpace(number),
+		anchor: name,
+		kind:   kind,
+	}
+}
+
+func (c *Converter) convertReference() bool {
+	if !c.options.NumberEquations {
+		return false
+	}
+
+	start := c.cursor
+	command := c.commandName()
+	c.skipCommandName()
+	name, ok := c.readArgument()
+	if !ok || strings.ContainsRune(name, '\x00') {
+		c.cursor = start
+		return false
+	}
+
+	c.emit("\x00" + command + "{" + strings.TrimSpace(name) + "}\x00")
+	return true
+}
+
+func (c *Converter) resolveReferences() {
+	if !c.options.NumberEquations {
+		return
+	}
+
+	out := referenceMarkerRegexp.ReplaceAllStringFunc(c.out.String(), func(marker string) string {
+		match := referenceMarkerRegexp.FindStringSubmatch(marker)
+		command, name := match[1], match[2]
+
+		l, ok := c.doc.labels[name]
+		if !ok {
+			l, ok = c.options.externalLabels[name]
+		}
+		if !ok {
+			return c.wrap("\\" + command + "{" + name + "}")
+		}
+
+		text := l.number
+		switch {
+		case l.kind == "section":
+			// The title of the heading
+		case command == "eqref":
+			text = "(" + text + ")"
+		case command == "autoref":
+			text = referenceNames[l.kind] + " " + text
+		}
+		return "[" + text + "](" + l.file + "#" + l.anchor + ")"
+	})
+	c.out.Reset()
+	c.out.WriteString(out)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Rendering of math to SVG images for hosts that do not allow MathJax, e.g.
+//
+//      $x^2$  =>  ![x²](assets/eq-3f2a...svg)
+//
+// The alt text is the math converted to Unicode text, see unicodemath.go, so
+// screen readers have something to read.
+//
+// Images are named after the hash of the math and the renderer, so math that
+// was rendered before is not rendered again. Only enabled with
+// Options.RenderMath. If rendering fails, the math is emitted as a code span
+// instead, whatever Options.Wrap says, so it is never lost, and the failure
+// is a problem (ErrRenderMath).
+//
+// With Options.InlineMathImages the images are embedded as data URIs instead,
+// so the output is a single self-contained file:
+//
+//      $x^2$  =>  <img src="data:image/svg+xml;base64,..." alt="x²"/>
+
+// Document math is rendered in by default, with latex and dvisvgm
+const renderDocument = `\documentclass[preview]{standalone}
+\usepackage{amsmath,amssymb}
+\begin{document}
+%s
+\end{document}
+`
+
+// Renders |math| (with its delimiters, e.g. "$x$" or "\[x\]") and returns
+// an image of it, described by |tex| (without delimiters), or the math as a
+// code span if it could not be rendered. Returns false without
+// Options.RenderMath.
+func (c *Converter) renderedMath(math, tex string) (string, bool) {
+	if c.options.RenderMath == "" {
+		return "", false
+	}
+
+	path, err := c.renderMath(math)
+	if err != nil {
+		c.problem(c.cursor, fmt.Errorf("%w %s: %s", ErrRenderMath, math, err))
+		return codeSpan(math), true
+	}
+
+	alt := strings.Replace(unicodeMath(tex), "\n", " ", -1)
+	if !c.options.InlineMathImages {
+		return "![" + markdownAltEscaper.Replace(alt) + "](" + filepath.ToSlash(path) + ")", true
+	}
+
+	image, err := ioutil.ReadFile(path)
+	if err != nil {
+		c.problem(c.cursor, fmt.Errorf("%w %s: %s", ErrRenderMath, math, err))
+		return codeSpan(math), true
+	}
+	return `<img src="data:` + mediaTypes[c.options.RenderMath] + ";base64," + base64.StdEncoding.EncodeToString(image) + `" alt="` + attributeEscaper.Replace(alt) + `"/>`, true
+}
+
+var markdownAltEscaper = strings.NewReplacer("\\", "\\\\", "[", "\\[", "]", "\\]")
+
+var attributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// Media types of the formats math is rendered to, for data URIs
+var mediaTypes = map[string]string{
+	"svg": "image/svg+xml",
+}
+
+// Returns the path of the image of |math|, rendering it if it does not
+// exist yet
+func (c *Converter) renderMath(math string) (string, error) {
+	hash := sha256.Sum256([]byte(c.options.RenderCommand + "\x00" + math))
+	name := "eq-" + hex.EncodeToString(hash[:])[:16] + "." + c.options.RenderMath
+	path := filepath.Join(c.options.AssetsDir, name)
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	var svg []byte
+	var err error
+	if c.options.RenderCommand != "" {
+		svg, err = renderWithCommand(c.options.RenderCommand, math)
+	} else {
+		svg, err = renderWithLatex(math)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(c.options.AssetsDir, 0755); err != nil {
+		return "", err
+	}
+	return path, writeAsset(path, svg)
+}
+
+// Writes |data| to a file of its own first and renames it to |path|, so
+// conversions rendering the same math at once never read half an image
+func writeAsset(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), ".merkderwn-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Runs |command| with the shell, it gets the math on stdin and writes the
+// image to stdout
+func renderWithCommand(command, math string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(math)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil && stderr.Len() > 0 {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	} else if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+func renderWithLatex(math string) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "merkderwn")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tex := filepath.Join(dir, "eq.tex")
+	if err := ioutil.WriteFile(tex, []byte(fmt.Sprintf(renderDocument, math)), 0644); err != nil {
+		return nil, err
+	}
+
+	for _, args := range [][]string{
+		{"latex", "-interaction=nonstopmode", "-halt-on-error", "eq.tex"},
+		{"dvisvgm", "--no-fonts", "--exact", "eq.dvi", "-o", "eq.svg"},
+	} {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil && len(bytes.TrimSpace(output)) > 0 {
+			return nil, fmt.Errorf("%s failed: %s", args[0], lastLine(output))
+		} else if err != nil {
+			// Not installed, for example
+			return nil, fmt.Errorf("%s failed: %s", args[0], err)
+		}
+	}
+
+	return ioutil.ReadFile(filepath.Join(dir, "eq.svg"))
+}
+
+// The errors of latex and dvisvgm are at the end of their output
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func renderOptions(t *testing.T, command string) Options {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return Options{RenderMath: "svg", AssetsDir: filepath.Join(dir, "assets"), RenderCommand: command}
+}
+
+func TestRenderMath(t *testing.T) {
+	options := renderOptions(t, "cat")
+
+	out := convertWithOptions("$x$ and \\[y\\] and $x$", options)
+	images, _ := filepath.Glob(filepath.Join(options.AssetsDir, "eq-*.svg"))
+	assert.Len(t, images, 2)
+	assert.Equal(t, 2, strings.Count(out, "![x]("+filepath.ToSlash(options.AssetsDir)+"/eq-"))
+	assert.Equal(t, 1, strings.Count(out, "![y]("+filepath.ToSlash(options.AssetsDir)+"/eq-"))
+
+	// The command gets the math with its delimiters
+	for _, image := range images {
+		svg, _ := ioutil.ReadFile(image)
+		assert.Contains(t, []string{"$x$", "\\[y\\]"}, string(svg))
+	}
+}
+
+func TestRenderMathCache(t *testing.T) {
+	options := renderOptions(t, "cat")
+	first := convertWithOptions("$x$", options)
+	images, _ := filepath.Glob(filepath.Join(options.AssetsDir, "eq-*.svg"))
+	assert.Len(t, images, 1)
+	assert.NoError(t, ioutil.WriteFile(images[0], []byte("cached"), 0644))
+
+	// Rendered images are reused
+	assert.Equal(t, first, convertWithOptions("$x$", options))
+	svg, _ := ioutil.ReadFile(images[0])
+	assert.Equal(t, "cached", string(svg))
+
+	// The renderer is part of the hash
+	options.RenderCommand = "cat; true"
+	assert.NotEqual(t, first, convertWithOptions("$x$", options))
+}
+
+func TestRenderMathFailure(t *testing.T) {
+	options := renderOptions(t, "echo broken >&2; false")
+
+	c := NewConverter([]byte("$x$"), options)
+	assert.Equal(t, "`$x$`", string(c.Convert()))
+	assert.Len(t, c.Warnings(), 1)
+	assert.Contains(t, c.Warnings()[0], "broken")
+
+	// Kept when the LaTeX which is not converted is dropped
+	options.Wrap = "drop"
+	options.Strict = true
+	out, _, err := Convert([]byte("Text $\\badmacro$ and"), options)
+	assert.Nil(t, out)
+	assert.True(t, errors.Is(err, ErrRenderMath))
+	options.Strict = false
+	assert.Equal(t, "Text `$\\badmacro$` and", convertWithOptions("Text $\\badmacro$ and", options))
+
+	// Without latex there is no output to tell why
+	t.Setenv("PATH", "")
+	c = NewConverter([]byte("$x$"), renderOptions(t, ""))
+	c.Convert()
+	assert.Len(t, c.Warnings(), 1)
+	assert.Contains(t, c.Warnings()[0], "latex failed: exec: \"latex\"")
+}
+
+func TestInlineMathImages(t *testing.T) {
+	options := renderOptions(t, "printf '<svg/>'")
+	options.InlineMathImages = true
+
+	assert.Equal(t, `<img src="data:image/svg+xml;base64,PHN2Zy8+" alt="x &lt; y"/>`, convertWithOptions("$x < y$", options))
+}
+
+func TestRenderedMathAltText(t *testing.T) {
+	options := renderOptions(t, "cat")
+
+	out := convertWithOptions("$[a, b] \\subseteq \\mathbb{R}^2$", options)
+	assert.True(t, strings.HasPrefix(out, `![\[a, b\] ⊆ ℝ²](`), out)
+
+	out = convertWithOptions("\\begin{align}a &= b \\\\ c &= d\\end{align}", options)
+	assert.True(t, strings.HasPrefix(out, `![a = b c = d](`), out)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Renderers write the parts of the input the converter does not convert:
+// text, math and the LaTeX left as is. The default renderer does what the
+// options say, e.g. it wraps LaTeX in comments and passes math through with
+// Options.MathPassthrough. Other output formats can be added with a Renderer
+// of their own, set as Options.Renderer.
+type Renderer interface {
+	// Text of the input, e.g. Markdown
+	EmitText(w io.Writer, text string)
+
+	// Math without its delimiters. Display math is math in $$...$$ or \[...\]
+	// and math environments, which are passed with their \begin and \end.
+	EmitMath(w io.Writer, tex string, display bool)
+
+	// A LaTeX command which is not converted, with its arguments
+	EmitCommand(w io.Writer, latex string)
+
+	// A LaTeX environment which is not converted, from \begin to \end
+	EmitEnvironment(w io.Writer, latex string)
+
+	// The content of an HTML comment in the input
+	EmitComment(w io.Writer, content string)
+}
+
+func (c *Converter) renderer() Renderer {
+	if c.options.Renderer != nil {
+		return c.options.Renderer
+	}
+	return optionsRenderer{c}
+}
+
+// The default Renderer
+type optionsRenderer struct {
+	c *Converter
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Writes the text, escaped with Options.EscapeHTML
+func (r optionsRenderer) EmitText(w io.Writer, text string) {
+	if r.c.options.EscapeHTML {
+		text = htmlEscaper.Replace(text)
+	}
+	io.WriteString(w, text)
+}
+
+// Writes math, either hidden in a comment for MultiMarkdown or as is for
+// MathJax to pick up. It may also be converted to Unicode text or rendered.
+func (r optionsRenderer) EmitMath(w io.Writer, tex string, display bool) {
+	open, close := "$", "$"
+	rendered := "$" + tex + "$"
+	if display {
+		open, close = "$$", "$$"
+		rendered = "\\[" + tex + "\\]"
+	}
+
+	if r.c.options.UnicodeMath {
+		r.EmitText(w, unicodeMath(tex))
+		return
+	}
+	if image, ok := r.c.renderedMath(rendered, tex); ok {
+		io.WriteString(w, image)
+		return
+	}
+	if r.c.options.MathPassthrough {
+		open, close := r.c.mathDelimiters(display)
+		r.EmitText(w, open+tex+close)
+		return
+	}
+	r.EmitCommand(w, open+tex+close)
+}
+
+// Writes a math environment, which is passed through without delimiters if
+// they are $$. |body| is the environment without \begin and \end.
+func (r optionsRenderer) emitMathEnvironment(w io.Writer, environment, body string) {
+	if r.c.options.UnicodeMath {
+		r.EmitText(w, unicodeMath(body))
+	} else if image, ok := r.c.renderedMath(environment, body); ok {
+		io.WriteString(w, image)
+	} else if r.c.options.MathPassthrough && r.c.options.MathDelimiters != "" && r.c.options.MathDelimiters != "dollars" {
+		// Renderers which only look for delimiters would miss the environment
+		r.EmitMath(w, environment, true)
+	} else if r.c.options.MathPassthrough {
+		r.EmitText(w, environment)
+	} else {
+		r.EmitEnvironment(w, environment)
+	}
+}
+
+// Wraps LaTeX that is not converted so it is kept but not rendered, see
+// Options.Wrap
+func (r optionsRenderer) EmitCommand(w io.Writer, latex string) {
+	switch r.c.options.Wrap {
+	case "noformat":
+		// A {noformat} in it would end the block
+		if strings.Contains(latex, "{noformat}") {
+			io.WriteString(w, "{code}"+latex+"{code}")
+		} else {
+			io.WriteString(w, "{noformat}"+latex+"{noformat}")
+		}
+	case "pandoc-raw":
+		io.WriteString(w, pandocRaw(latex, false))
+	case "drop":
+	default:
+		if r.c.options.EscapeComments {
+			latex = escapeComment(latex)
+		}
+		io.WriteString(w, "<!--"+latex+"-->")
+	}
+}
+
+// Escapes |content| so a comment of it is well-formed: &, < and > like text,
+// and hyphens after a hyphen or at the end, as comments can not contain "--"
+// or end in "-". Decoding the entities gives the content back.
+func escapeComment(content string) string {
+	content = htmlEscaper.Replace(content)
+	if !strings.Contains(content, "--") && !strings.HasSuffix(content, "-") {
+		return content
+	}
+
+	var escaped strings.Builder
+	for i := 0; i < len(content); i++ {
+		if content[i] == '-' && (i > 0 && content[i-1] == '-' || i == len(content)-1) {
+			escaped.WriteString("&#45;")
+		} else {
+			escaped.WriteByte(content[i])
+		}
+	}
+	return escaped.String()
+}
+
+// Returns what makes a comment of |content| invalid HTML, if anything. They
+// are written escaped with Options.EscapeComments.
+func invalidComment(content string) (string, bool) {
+	switch {
+	case strings.HasPrefix(content, ">"):
+		return "starts with \">\"", true
+	case strings.HasPrefix(content, "->"):
+		return "starts with \"->\"", true
+	case strings.Contains(content, "--"):
+		return "contains \"--\"", true
+	case strings.HasSuffix(content, "-"):
+		return "ends with \"-\"", true
+	}
+	return "", false
+}
+
+func (r optionsRenderer) EmitEnvironment(w io.Writer, latex string) {
+	if r.c.options.Wrap == "pandoc-raw" {
+		// A fence in the middle of a line is text
+		io.WriteString(w, pandocRaw(latex, r.c.atLineStart()))
+		return
+	}
+	r.EmitCommand(w, latex)
+}
+
+// Returns |latex| as raw LaTeX for pandoc, which keeps it in LaTeX and PDF
+// output: inline code with the {=latex} attribute, or a fenced code block
+// with it for a |block|. The fences are longer than the backticks in it.
+func pandocRaw(latex string, block bool) string {
+	if !block {
+		return codeSpan(latex) + "{=latex}"
+	}
+	fence := "```"
+	for strings.Contains(latex, fence) {
+		fence += "`"
+	}
+	return fence + "{=latex}\n" + latex + "\n" + fence
+}
+
+func (r optionsRenderer) EmitComment(w io.Writer, content string) {
+	r.EmitCommand(w, content)
+}
+
+// Whether nothing but indentation was written on the line of the output so
+// far
+func (c *Converter) atLineStart() bool {
+	out := c.out.Bytes()
+	line := out[bytes.LastIndexByte(out, '\n')+1:]
+	return len(bytes.Trim(line, " \t")) == 0
+}
+
+// Returns the delimiters of passed through inline or display math
+func (c *Converter) mathDelimiters(display bool) (string, string) {
+	switch {
+	case c.options.MathDelimiters == "latex" && display:
+		return "\\[", "\\]"
+	case c.options.MathDelimiters == "latex":
+		return "\\(", "\\)"
+	case c.options.MathDelimiters == "confluence" && display:
+		return "{mathdisplay}", "{mathdisplay}"
+	case c.options.MathDelimiters == "confluence":
+		return "{mathinline}", "{mathinline}"
+	case display:
+		return "$$", "$$"
+	default:
+		return "$", "$"
+	}
+}
+
+// Returns |latex| as the renderer writes LaTeX that is not converted
+func (c *Converter) wrap(latex string) string {
+	var out bytes.Buffer
+	c.renderer().EmitCommand(&out, latex)
+	return out.String()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Writes HTML instead of Markdown with hidden LaTeX
+type htmlRenderer struct{}
+
+func (htmlRenderer) EmitText(w io.Writer, text string) {
+	io.WriteString(w, text)
+}
+
+func (htmlRenderer) EmitMath(w io.Writer, tex string, display bool) {
+	fmt.Fprintf(w, `<span class="math" data-display="%t">%s</span>`, display, tex)
+}
+
+func (htmlRenderer) EmitCommand(w io.Writer, latex string) {
+	io.WriteString(w, "<code>"+latex+"</code>")
+}
+
+func (htmlRenderer) EmitEnvironment(w io.Writer, latex string) {
+	io.WriteString(w, "<pre>"+latex+"</pre>")
+}
+
+func (htmlRenderer) EmitComment(w io.Writer, content string) {
+	io.WriteString(w, "<pre>"+content+"</pre>")
+}
+
+func TestRenderer(t *testing.T) {
+	options := Options{Renderer: htmlRenderer{}}
+
+	assert.Equal(t, `a <span class="math" data-display="false">x</span>`, convertWithOptions("a $x$", options))
+	assert.Equal(t, `<span class="math" data-display="true">y</span>`, convertWithOptions("$$y$$", options))
+	assert.Equal(t, `<span class="math" data-display="true">y</span>`, convertWithOptions("\\[y\\]", options))
+	assert.Equal(t, "<code>\\foo{bar}</code> b", convertWithOptions("\\foo{bar} b", options))
+	assert.Equal(t, "<pre>\\begin{tikzpicture}\\end{tikzpicture}</pre>", convertWithOptions("\\begin{tikzpicture}\\end{tikzpicture}", options))
+	assert.Equal(t, "<pre>\\foo</pre>", convertWithOptions("<!--\\foo-->", options))
+
+	// Math environments are passed with \begin and \end
+	options.MathPassthrough = true
+	assert.Equal(t, `<span class="math" data-display="true">\begin{align}x\end{align}</span>`, convertWithOptions("\\begin{align}x\\end{align}", options))
+}
+
+func TestDefaultRenderer(t *testing.T) {
+	var out strings.Builder
+	c := ByteArrayToConverter([]byte(""))
+	c.options.Wrap = "noformat"
+	c.renderer().EmitCommand(&out, "\\foo")
+	c.renderer().EmitMath(&out, "x", false)
+	assert.Equal(t, "{noformat}\\foo{noformat}{noformat}$x${noformat}", out.String())
+}
+
+func TestPandocRaw(t *testing.T) {
+	options := Options{Wrap: "pandoc-raw"}
+	assert.Equal(t, "See `\\cite{knuth}`{=latex} and `$x$`{=latex}.", convertWithOptions("See \\cite{knuth} and $x$.", options))
+	assert.Equal(t, "```{=latex}\n\\begin{tikzpicture}\\draw (0,0);\\end{tikzpicture}\n```\n", convertWithOptions("\\begin{tikzpicture}\\draw (0,0);\\end{tikzpicture}\n", options))
+
+	assert.Equal(t, "inline `\\begin{x}y\\end{x}`{=latex} z", convertWithOptions("inline \\begin{x}y\\end{x} z", options))
+	assert.Equal(t, "a\n  ```{=latex}\n\\begin{x}y\\end{x}\n```", convertWithOptions("a\n  \\begin{x}y\\end{x}", options))
+
+	assert.Equal(t, "``\\verb|`|``{=latex}", pandocRaw("\\verb|`|", false))
+	assert.Equal(t, "`` `x ``{=latex}", pandocRaw("`x", false))
+	assert.Equal(t, "````{=latex}\n```\n````", pandocRaw("```", true))
+}
+
+func TestEscapeComments(t *testing.T) {
+	options := Options{EscapeComments: true}
+	assert.Equal(t, "a <!--\\cite[1-&#45;2]{x}--> b", convertWithOptions("a \\cite[1--2]{x} b", options))
+	assert.Equal(t, "<!--\\draw[-&#45;&gt;]--> (a) --- (b);", convertWithOptions("\\draw[-->] (a) --- (b);", options))
+	assert.Equal(t, "<!--\\begin{tabular}{ll} a &amp; b \\\\ \\end{tabular}-->", convertWithOptions("\\begin{tabular}{ll} a & b \\\\ \\end{tabular}", options))
+	assert.Equal(t, "<!--\\foo{-&#45;&#45;}-->", convertWithOptions("\\foo{---}", options))
+	assert.Equal(t, "x&#45;", escapeComment("x-"))
+
+	// Only with the option, MultiMarkdown needs the LaTeX as is
+	assert.Equal(t, "<!--\\cite[1--2]{x}-->", convertWithOptions("\\cite[1--2]{x}", Options{}))
+}
+
+func TestInvalidComments(t *testing.T) {
+	c := NewConverter([]byte("a\n <!-- a -- b --> <!--ok-->"), Options{EscapeComments: true})
+	assert.Equal(t, "a\n <!-- a -&#45; b --> <!--ok-->", string(c.Convert()))
+	assert.Equal(t, []string{"2:2: HTML comment contains \"--\", which is not valid HTML"}, c.Warnings())
+
+	problem, _ := invalidComment("->x")
+	assert.Equal(t, "starts with \"->\"", problem)
+	problem, _ = invalidComment("x-")
+	assert.Equal(t, "ends with \"-\"", problem)
+	_, ok := invalidComment(" x - y ")
+	assert.False(t, ok)
+}
+
+// Records the text it gets
+type textRecorder struct {
+	htmlRenderer
+	texts *[]string
+}
+
+func (r textRecorder) EmitText(w io.Writer, text string) {
+	*r.texts = append(*r.texts, text)
+	io.WriteString(w, text)
+}
+
+func TestRendererGetsRunsOfText(t *testing.T) {
+	var texts []string
+	options := Options{Renderer: textRecorder{texts: &texts}}
+	assert.Equal(t, "Größe <code>\\foo</code> a < b c", convertWithOptions("Größe \\foo a < b c", options))
+	assert.Equal(t, []string{"Größe ", " a ", "< b c"}, texts)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+)
+
+// Commands that are replaced by plain text
+
+var logos = map[string]string{
+	"TeX":      "TeX",
+	"LaTeX":    "LaTeX",
+	"LaTeXe":   "LaTeX2ε",
+	"BibTeX":   "BibTeX",
+	"XeTeX":    "XeTeX",
+	"XeLaTeX":  "XeLaTeX",
+	"LuaTeX":   "LuaTeX",
+	"LuaLaTeX": "LuaLaTeX",
+	"ConTeXt":  "ConTeXt",
+	"AmS":      "AMS",
+	"AmSTeX":   "AMS-TeX",
+	"METAFONT": "METAFONT",
+}
+
+func init() {
+	commandConverters["today"] = (*Converter).convertToday
+
+	for name := range logos {
+		commandConverters[name] = (*Converter).convertLogo
+	}
+}
+
+func (c *Converter) convertToday() bool {
+	if !c.options.Today {
+		return false
+	}
+
+	date := c.options.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	format := c.options.DateFormat
+	if format == "" {
+		format = "January 2, 2006"
+	}
+
+	c.skipCommandName()
+	c.skipCommandTerminator()
+	c.emit(date.Format(format))
+	return true
+}
+
+func (c *Converter) convertLogo() bool {
+	if !c.options.Logos {
+		return false
+	}
+
+	logo := logos[c.commandName()]
+	c.skipCommandName()
+	c.skipCommandTerminator()
+	c.emit(logo)
+	return true
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestToday(t *testing.T) {
+	date := time.Date(2015, time.March, 4, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "As of <!--\\today.-->", convertWithOptions("As of \\today.", Options{}))
+	assert.Equal(t, "As of March 4, 2015.", convertWithOptions("As of \\today.", Options{Today: true, Date: date}))
+	assert.Equal(t, "2015-03-04 is", convertWithOptions("\\today{} is", Options{Today: true, Date: date, DateFormat: "2006-01-02"}))
+	assert.Equal(t, "2015-03-04 is", convertWithOptions("\\today\\ is", Options{Today: true, Date: date, DateFormat: "2006-01-02"}))
+	assert.Equal(t, time.Now().Format("2006"), convertWithOptions("\\today", Options{Today: true, DateFormat: "2006"}))
+}
+
+func TestLogos(t *testing.T) {
+	logos := Options{Logos: true}
+	assert.Equal(t, "Written in <!--\\LaTeX-->", convertWithOptions("Written in \\LaTeX", Options{}))
+	assert.Equal(t, "Written in LaTeX", convertWithOptions("Written in \\LaTeX", logos))
+	assert.Equal(t, "LaTeX2ε and BibTeX are", convertWithOptions("\\LaTeXe{} and \\BibTeX\\ are", logos))
+	assert.Equal(t, "TeX.", convertWithOptions("\\TeX.", logos))
+}
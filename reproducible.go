@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Reproducible output, with Options.Reproducible: the output only depends on
+// the input and the options. \today needs Options.Date, which the command
+// takes from SOURCE_DATE_EPOCH unless -date is given, and the anchors
+// generated for figures, tables and index entries without a \label are
+// derived from their content instead of their number, so they stay the same
+// when others are added before them.
+
+// Returns the anchor of the |n|th figure, table or index entry (|kind|) of
+// the document, whose content is |content|
+func (c *Converter) generatedAnchor(kind string, n int, content string) string {
+	if !c.options.Reproducible {
+		return fmt.Sprintf("%s-%d", kind, n)
+	}
+
+	hash := sha256.Sum256([]byte(content))
+	anchor := fmt.Sprintf("%s-%x", kind, hash[:4])
+
+	// The same content again, e.g. a term indexed twice
+	if c.doc.anchors == nil {
+		c.doc.anchors = map[string]int{}
+	}
+	c.doc.anchors[anchor] += 1
+	if count := c.doc.anchors[anchor]; count > 1 {
+		anchor = fmt.Sprintf("%s-%d", anchor, count)
+	}
+	return anchor
+}
+
+// Returns the date of SOURCE_DATE_EPOCH (seconds since 1970), which builds
+// set to make their output reproducible, or the zero time if it is not set
+func sourceDate() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Time{}, nil
+	}
+
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid SOURCE_DATE_EPOCH %s, expected seconds since 1970", epoch)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// Checks that nothing but the input and the options decide the output
+func (options Options) reproducible() error {
+	if options.Today && options.Date.IsZero() {
+		return errors.New("Replacing \\today reproducibly needs -date or SOURCE_DATE_EPOCH")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestReproducibleAnchors(t *testing.T) {
+	options := Options{Floats: true, Index: "anchor", Reproducible: true}
+	anchors := func(in string) []string {
+		return regexp.MustCompile(`id="([^"]*)"`).FindAllString(convertWithOptions(in, options), -1)
+	}
+
+	figure := "\\begin{figure}\\includegraphics{b.png}\\end{figure}"
+	before := anchors(figure + "\nTrees\\index{tree} and trees\\index{tree}")
+	if assert.Len(t, before, 3) {
+		assert.True(t, regexp.MustCompile(`^id="figure-[0-9a-f]{8}"$`).MatchString(before[0]), before[0])
+		assert.True(t, regexp.MustCompile(`^id="index-[0-9a-f]{8}"$`).MatchString(before[1]), before[1])
+		assert.Equal(t, before[1][:len(before[1])-1]+`-2"`, before[2])
+	}
+
+	// Anchors stay the same when others are added before them
+	after := anchors("\\begin{figure}\\includegraphics{a.png}\\end{figure}\nGraphs\\index{graph}\n" +
+		figure + "\nTrees\\index{tree} and trees\\index{tree}")
+	assert.Equal(t, before, after[2:])
+	assert.NotEqual(t, after[0], before[0])
+
+	// Labels are kept
+	assert.Equal(t, []string{`id="fig:a"`}, anchors("\\begin{figure}\\includegraphics{a.png}\\label{fig:a}\\end{figure}"))
+}
+
+func TestReproducibleDate(t *testing.T) {
+	options := Options{Today: true, Reproducible: true}
+	assert.Error(t, options.validate())
+	options.Date = time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, options.validate())
+	assert.Equal(t, "February 1, 2020", convertWithOptions("\\today", options))
+
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	os.Setenv("SOURCE_DATE_EPOCH", "1580515200")
+	date, err := sourceDate()
+	assert.NoError(t, err)
+	assert.Equal(t, options.Date, date)
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = sourceDate()
+	assert.Error(t, err)
+
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	date, err = sourceDate()
+	assert.NoError(t, err)
+	assert.True(t, date.IsZero())
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The selftest command, which converts the example files built into the
+// binary and compares the output with the expected one, so a build can be
+// checked on the platform it runs on. Each example is a pair of name.xmd and
+// name.md, converted with the default options or with the flags in
+// name.flags (see conversionFlags).
+
+//go:embed example-files/*.xmd example-files/*.md example-files/*.flags
+var corpus embed.FS
+
+// Converts the examples in the example-files directory of |files|, writing
+// the result of each to |w|. Returns the number of examples which failed.
+func selftest(files fs.FS, w io.Writer) int {
+	inputs, _ := fs.Glob(files, "example-files/*.xmd")
+	failed := 0
+	for _, input := range inputs {
+		name := strings.TrimSuffix(input, ".xmd")
+		if err := runExample(files, name); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %s\n", path.Base(name), err)
+			failed += 1
+		} else {
+			fmt.Fprintf(w, "ok   %s\n", path.Base(name))
+		}
+	}
+	return failed
+}
+
+// Converts the example |name| and compares the output with the expected one
+func runExample(files fs.FS, name string) error {
+	in, err := fs.ReadFile(files, name+".xmd")
+	if err != nil {
+		return err
+	}
+	expected, err := fs.ReadFile(files, name+".md")
+	if err != nil {
+		return err
+	}
+
+	var options Options
+	if args, err := fs.ReadFile(files, name+".flags"); err == nil {
+		flags := flag.NewFlagSet(path.Base(name), flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		conversionFlags(flags, &options)
+		if err := flags.Parse(strings.Fields(string(args))); err != nil {
+			return fmt.Errorf("Invalid flags: %s", err)
+		}
+	}
+
+	out, _, err := Convert(in, options)
+	if err != nil {
+		return err
+	}
+
+	got := strings.Split(string(out), "\n")
+	want := strings.Split(string(expected), "\n")
+	for i := 0; i < len(got) || i < len(want); i++ {
+		var gotLine, wantLine string
+		if i < len(got) {
+			gotLine = got[i]
+		}
+		if i < len(want) {
+			wantLine = want[i]
+		}
+		if gotLine != wantLine {
+			return fmt.Errorf("Line %d differs\n  expected: %q\n  got:      %q", i+1, wantLine, gotLine)
+		}
+	}
+	return nil
+}
+
+// Runs the selftest command with |args|, returns the exit code
+func selftestCommand(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s selftest\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if failed := selftest(corpus, os.Stdout); failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d examples failed\n", failed)
+		return 1
+	}
+	return 0
+}
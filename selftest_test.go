@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelftest(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, 0, selftest(corpus, &out), out.String())
+	assert.Contains(t, out.String(), "ok   options\n")
+	assert.Contains(t, out.String(), "ok   simple\n")
+}
+
+func TestSelftestMismatch(t *testing.T) {
+	files := fstest.MapFS{
+		"example-files/a.xmd":   {Data: []byte("$x$\n\\foo\n")},
+		"example-files/a.md":    {Data: []byte("$x$\n\\foo\n")},
+		"example-files/a.flags": {Data: []byte("-math-passthrough")},
+		"example-files/b.xmd":   {Data: []byte("\\unknown-flag")},
+		"example-files/b.md":    {Data: []byte("")},
+		"example-files/b.flags": {Data: []byte("-unknown-flag")},
+	}
+
+	var out bytes.Buffer
+	assert.Equal(t, 2, selftest(files, &out))
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, "FAIL a: Line 2 differs", lines[0])
+	assert.Equal(t, "  expected: \"\\\\foo\"", lines[1])
+	assert.Equal(t, "  got:      \"<!--\\\\foo-->\"", lines[2])
+	assert.True(t, strings.HasPrefix(lines[3], "FAIL b: Invalid flags: "), lines[3])
+}
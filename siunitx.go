@@ -0,0 +1,341 @@
+package main
+
+import (
+	"strings"
+)
+
+// Conversion of siunitx commands to plain text, e.g.
+//
+//      \SI{3.5}{\kilo\meter\per\hour}  =>  3.5 km/h
+//      \num{1e-3}                      =>  1×10⁻³
+//
+// Only enabled with Options.Units, otherwise the commands are wrapped in
+// comments like every other command.
+
+func init() {
+	commandConverters["SI"] = (*Converter).convertQuantity
+	commandConverters["qty"] = (*Converter).convertQuantity
+	commandConverters["si"] = (*Converter).convertUnit
+	commandConverters["unit"] = (*Converter).convertUnit
+	commandConverters["num"] = (*Converter).convertNumber
+	commandConverters["ang"] = (*Converter).convertAngle
+	commandConverters["SIrange"] = (*Converter).convertQuantityRange
+	commandConverters["qtyrange"] = (*Converter).convertQuantityRange
+	commandConverters["numrange"] = (*Converter).convertNumberRange
+}
+
+var unitPrefixes = map[string]string{
+	"yocto": "y", "zepto": "z", "atto": "a", "femto": "f", "pico": "p",
+	"nano": "n", "micro": "µ", "milli": "m", "centi": "c", "deci": "d",
+	"deca": "da", "deka": "da", "hecto": "h", "kilo": "k", "mega": "M",
+	"giga": "G", "tera": "T", "peta": "P", "exa": "E", "zetta": "Z",
+	"yotta": "Y",
+}
+
+var unitSymbols = map[string]string{
+	"ampere": "A", "candela": "cd", "kelvin": "K", "kilogram": "kg",
+	"gram": "g", "meter": "m", "metre": "m", "mole": "mol", "second": "s",
+	"becquerel": "Bq", "degreeCelsius": "°C", "celsius": "°C",
+	"coulomb": "C", "farad": "F", "gray": "Gy", "hertz": "Hz", "henry": "H",
+	"joule": "J", "lumen": "lm", "katal": "kat", "lux": "lx", "newton": "N",
+	"ohm": "Ω", "pascal": "Pa", "radian": "rad", "siemens": "S",
+	"sievert": "Sv", "steradian": "sr", "tesla": "T", "volt": "V",
+	"watt": "W", "weber": "Wb", "day": "d", "hour": "h", "minute": "min",
+	"hectare": "ha", "litre": "L", "liter": "L", "tonne": "t",
+	"electronvolt": "eV", "bar": "bar", "percent": "%", "degree": "°",
+	"arcminute": "′", "arcsecond": "″", "bit": "bit", "byte": "B",
+	"decibel": "dB", "angstrom": "Å", "bel": "B", "neper": "Np",
+}
+
+var superscripts = strings.NewReplacer(
+	"0", "⁰", "1", "¹", "2", "²", "3", "³", "4", "⁴", "5", "⁵", "6", "⁶",
+	"7", "⁷", "8", "⁸", "9", "⁹", "+", "⁺", "-", "⁻", "−", "⁻",
+)
+
+func superscript(s string) string {
+	return superscripts.Replace(s)
+}
+
+// \SI[options]{value}[pre-unit]{unit}
+func (c *Converter) convertQuantity() bool {
+	if !c.options.Units {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+
+	value, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+	preUnit, _ := c.readOptionalArgument()
+	unit, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(formatQuantity(value, preUnit, unit))
+	return true
+}
+
+// \si[options]{unit}
+func (c *Converter) convertUnit() bool {
+	if !c.options.Units {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+
+	unit, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(formatUnit(unit))
+	return true
+}
+
+// \num[options]{number}
+func (c *Converter) convertNumber() bool {
+	if !c.options.Units {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+
+	number, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(formatNumber(number))
+	return true
+}
+
+// \ang[options]{degrees;minutes;seconds}
+func (c *Converter) convertAngle() bool {
+	if !c.options.Units {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+
+	angle, ok := c.readArgument()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	marks := []string{"°", "′", "″"}
+	for i, part := range strings.SplitN(angle, ";", 3) {
+		if part = strings.TrimSpace(part); part != "" {
+			c.emit(formatNumber(part) + marks[i])
+		}
+	}
+	return true
+}
+
+// \SIrange[options]{from}{to}{unit}
+func (c *Converter) convertQuantityRange() bool {
+	if !c.options.Units {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+
+	from, ok1 := c.readArgument()
+	to, ok2 := c.readArgument()
+	unit, ok3 := c.readArgument()
+	if !ok1 || !ok2 || !ok3 {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(formatQuantity(from, "", unit) + " to " + formatQuantity(to, "", unit))
+	return true
+}
+
+// \numrange[options]{from}{to}
+func (c *Converter) convertNumberRange() bool {
+	if !c.options.Units {
+		return false
+	}
+
+	start := c.cursor
+	c.skipCommandName()
+	c.readOptionalArgument()
+
+	from, ok1 := c.readArgument()
+	to, ok2 := c.readArgument()
+	if !ok1 || !ok2 {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(formatNumber(from) + " to " + formatNumber(to))
+	return true
+}
+
+func formatQuantity(value, preUnit, unit string) string {
+	number := formatNumber(value)
+	if strings.Contains(number, "±") {
+		number = "(" + number + ")"
+	}
+	if preUnit != "" {
+		number = formatUnit(preUnit) + " " + number
+	}
+	return number + " " + formatUnit(unit)
+}
+
+// Formats numbers like "1e-3" as "1×10⁻³" and "1.5+-0.2" as "1.5 ± 0.2"
+func formatNumber(number string) string {
+	number = strings.Replace(number, "\\pm", "+-", -1)
+
+	var parts []string
+	for _, part := range strings.Split(number, "+-") {
+		parts = append(parts, formatScientific(strings.TrimSpace(part)))
+	}
+	return strings.Join(parts, " ± ")
+}
+
+func formatScientific(number string) string {
+	mantissa, exponent := number, ""
+	if i := strings.IndexAny(number, "eEdD"); i >= 0 {
+		mantissa, exponent = strings.TrimSpace(number[:i]), strings.TrimSpace(number[i+1:])
+	}
+	exponent = strings.TrimPrefix(exponent, "+")
+
+	if exponent == "" {
+		return mantissa
+	}
+	if mantissa == "" {
+		return "10" + superscript(exponent)
+	}
+	return mantissa + "×10" + superscript(exponent)
+}
+
+// Formats units given either literally ("km/h", "m.s^{-1}") or as unit
+// macros ("\kilo\meter\per\hour").
+func formatUnit(unit string) string {
+	if !strings.Contains(unit, "\\") {
+		return formatLiteralUnit(unit)
+	}
+
+	var numerator, denominator []string
+	prefix, power, per := "", "", false
+
+	// The unit added last, \squared and friends raise it
+	var last *[]string
+
+	add := func(symbol string) {
+		symbol = prefix + symbol + power
+		if per {
+			last = &denominator
+		} else {
+			last = &numerator
+		}
+		*last = append(*last, symbol)
+		prefix, power, per = "", "", false
+	}
+
+	// Appends a power to the unit added last (\squared, \tothe{3}, ...)
+	raise := func(exponent string) {
+		if last != nil {
+			(*last)[len(*last)-1] += superscript(exponent)
+		}
+	}
+
+	c := ByteArrayToConverter([]byte(unit))
+	for !c.atEof() {
+		name := c.commandName()
+		if name == "" {
+			if literal := c.current(); strings.TrimSpace(literal) != "" && literal != "~" {
+				add(formatLiteralUnit(literal))
+			}
+			c.cursor += 1
+			continue
+		}
+		c.skipCommandName()
+
+		switch name {
+		case "per":
+			per = true
+		case "square":
+			power = "²"
+		case "cubic":
+			power = "³"
+		case "squared":
+			raise("2")
+		case "cubed":
+			raise("3")
+		case "tothe":
+			exponent, _ := c.readArgument()
+			raise(exponent)
+		case "raiseto":
+			exponent, _ := c.readArgument()
+			power = superscript(exponent)
+		default:
+			if symbol, ok := unitPrefixes[name]; ok {
+				prefix += symbol
+			} else if symbol, ok := unitSymbols[name]; ok {
+				add(symbol)
+			} else {
+				add(name)
+			}
+		}
+	}
+
+	result := strings.Join(numerator, "·")
+	if result == "" && len(denominator) > 0 {
+		result = "1"
+	}
+	switch len(denominator) {
+	case 0:
+	case 1:
+		result += "/" + denominator[0]
+	default:
+		result += "/(" + strings.Join(denominator, "·") + ")"
+	}
+	return result
+}
+
+// Formats literal units like "m.s^{-1}" as "m·s⁻¹"
+func formatLiteralUnit(unit string) string {
+	var result strings.Builder
+	c := ByteArrayToConverter([]byte(strings.TrimSpace(unit)))
+	for !c.atEof() {
+		switch c.current() {
+		case "^":
+			c.cursor += 1
+			if exponent, ok := c.readArgument(); ok {
+				result.WriteString(superscript(exponent))
+			} else if !c.atEof() {
+				result.WriteString(superscript(c.current()))
+				c.cursor += 1
+			}
+			continue
+		case ".":
+			result.WriteString("·")
+		case "~":
+			result.WriteString(" ")
+		default:
+			result.WriteString(c.current())
+		}
+		c.cursor += 1
+	}
+	return result.String()
+}
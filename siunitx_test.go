@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func convertWithOptions(input string, options Options) string {
+	c := NewConverter([]byte(input), options)
+	return string(c.Convert())
+}
+
+func TestUnitsAreWrappedByDefault(t *testing.T) {
+	assert.Equal(t, "<!--\\num{1e-3}-->", convertWithOptions("\\num{1e-3}", Options{}))
+}
+
+func TestUnitConversion(t *testing.T) {
+	units := Options{Units: true}
+	assert.Equal(t, "3.5 km/h", convertWithOptions("\\SI{3.5}{\\kilo\\meter\\per\\hour}", units))
+	assert.Equal(t, "1×10⁻³", convertWithOptions("\\num{1e-3}", units))
+	assert.Equal(t, "9.81 m/s²", convertWithOptions("\\SI{9.81}{\\meter\\per\\second\\squared}", units))
+	assert.Equal(t, "1 m²/s", convertWithOptions("\\SI{1}{\\per\\second\\meter\\squared}", units))
+	assert.Equal(t, "J/(mol·K)", convertWithOptions("\\si{\\joule\\per\\mole\\per\\kelvin}", units))
+	assert.Equal(t, "(1.5 ± 0.2) mA", convertWithOptions("\\SI{1.5+-0.2}{\\milli\\ampere}", units))
+	assert.Equal(t, "5 km²", convertWithOptions("\\qty{5}{\\square\\kilo\\meter}", units))
+	assert.Equal(t, "2 m·s⁻¹", convertWithOptions("\\SI[round-mode=places]{2}{m.s^{-1}}", units))
+	assert.Equal(t, "1 to 2 mm", convertWithOptions("\\numrange{1}{2} mm", units))
+	assert.Equal(t, "10 °C to 20 °C", convertWithOptions("\\SIrange{10}{20}{\\celsius}", units))
+	assert.Equal(t, "12°30′", convertWithOptions("\\ang{12;30}", units))
+}
+
+func TestIncompleteUnitCommandsAreWrapped(t *testing.T) {
+	units := Options{Units: true}
+	assert.Equal(t, "<!--\\SI{3.5}-->", convertWithOptions("\\SI{3.5}", units))
+	assert.Equal(t, "<!--\\num-->", convertWithOptions("\\num", units))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Conversion of beamer frames to slides for reveal.js or Marp:
+//
+//      \begin{frame}{Title}
+//        ...
+//      \end{frame}
+//
+// becomes
+//
+//      ---
+//
+//      ## Title
+//
+//      ...
+//
+// The separator is left out for the very first slide. Overlays are dropped:
+// \pause is removed and \only<2>{...} and friends are replaced by their
+// content. Items with overlays become fragments, see lists.go.
+
+func init() {
+	environmentConverters["frame"] = (*Converter).convertFrame
+	commandConverters["pause"] = (*Converter).convertPause
+	commandConverters["only"] = (*Converter).convertOverlay
+	commandConverters["uncover"] = (*Converter).convertOverlay
+	commandConverters["visible"] = (*Converter).convertOverlay
+	commandConverters["onslide"] = (*Converter).convertOverlay
+	commandConverters["alert"] = (*Converter).convertOverlay
+}
+
+// \begin{frame}<overlay>[options]{title}{subtitle} ... \end{frame}
+func (c *Converter) convertFrame() bool {
+	if !c.options.Slides {
+		return false
+	}
+
+	start := c.cursor
+	body, ok := c.readEnvironment()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	// \begin{frame}<overlay>[<default overlay>][options], all dropped
+	frame := ByteArrayToConverter([]byte(body))
+	frame.readGroup('<', '>')
+	for {
+		if _, ok := frame.readOptionalArgument(); !ok {
+			break
+		}
+	}
+	title, _ := frame.readArgument()
+	subtitle, _ := frame.readArgument()
+	body = string(frame.in[frame.cursor:])
+
+	if title == "" {
+		title, _ = commandArgument(body, "frametitle")
+	}
+	if subtitle == "" {
+		subtitle, _ = commandArgument(body, "framesubtitle")
+	}
+	body = removeCommand(removeCommand(body, "frametitle"), "framesubtitle")
+
+	// Only the output before the first slide is looked at, it is empty but
+	// for a title page or the like
+	if c.doc.slides || len(bytes.TrimSpace(c.out.Bytes())) > 0 {
+		c.emitBlankLine()
+		c.emit("---\n\n")
+	}
+	c.doc.slides = true
+	if title = strings.TrimSpace(c.convertFragment(title)); title != "" {
+		c.emit("## " + title + "\n\n")
+	}
+	if subtitle = strings.TrimSpace(c.convertFragment(subtitle)); subtitle != "" {
+		c.emit("### " + subtitle + "\n\n")
+	}
+	c.emit(strings.TrimSpace(c.convertFragment(body)) + "\n")
+	return true
+}
+
+// Ends the output with a blank line, so "---" is not taken for the
+// underline of a heading
+func (c *Converter) emitBlankLine() {
+	out := c.out.Bytes()
+	switch {
+	case bytes.HasSuffix(out, []byte("\n\n")):
+	case bytes.HasSuffix(out, []byte("\n")):
+		c.emit("\n")
+	default:
+		c.emit("\n\n")
+	}
+}
+
+func (c *Converter) convertPause() bool {
+	if !c.options.Slides {
+		return false
+	}
+
+	c.skipCommandName()
+	return true
+}
+
+// \only<overlay>{content}, the content is emitted regardless of the overlay.
+// \alert{content} is emphasized.
+func (c *Converter) convertOverlay() bool {
+	if !c.options.Slides {
+		return false
+	}
+
+	start := c.cursor
+	name := c.commandName()
+	c.skipCommandName()
+	c.readGroup('<', '>')
+
+	content, ok := c.readArgument()
+	if !ok {
+		if name == "onslide" {
+			// \onslide<2-> without an argument applies to the rest of the frame
+			return true
+		}
+		c.cursor = start
+		return false
+	}
+
+	content = c.convertFragment(content)
+	if name == "alert" {
+		content = "**" + content + "**"
+	}
+	c.emit(content)
+	return true
+}
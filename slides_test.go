@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFrameConversion(t *testing.T) {
+	var slides Options
+	assert.NoError(t, applyPreset("slides", &slides))
+
+	input := `\begin{frame}{Motivation}
+  Why $x$?
+\end{frame}
+
+\begin{frame}[fragile]
+  \frametitle{Results}
+  \framesubtitle{So far}
+  Good.
+\end{frame}
+`
+	expected := `## Motivation
+
+Why $x$?
+
+
+---
+
+## Results
+
+### So far
+
+Good.
+
+`
+	assert.Equal(t, expected, convertWithOptions(input, slides))
+
+	// Text before the first slide is not made a heading by the separator
+	input = "Intro text\n\\begin{frame}{A}\\end{frame}\\begin{frame}{B}\\end{frame}"
+	assert.Equal(t, "Intro text\n\n---\n\n## A\n\n\n---\n\n## B\n\n\n", convertWithOptions(input, slides))
+}
+
+func TestFrameOverlays(t *testing.T) {
+	var slides Options
+	assert.NoError(t, applyPreset("slides", &slides))
+
+	input := "\\begin{frame}<2>[<+->][fragile]{T}{Sub}Body\\end{frame}"
+	assert.Equal(t, "## T\n\n### Sub\n\nBody\n", convertWithOptions(input, slides))
+}
+
+func TestFramesAreWrappedWithoutSlides(t *testing.T) {
+	input := "\\begin{frame}{A}\\end{frame}"
+	assert.Equal(t, "<!--"+input+"-->", convertWithOptions(input, Options{}))
+}
+
+func TestUnknownPreset(t *testing.T) {
+	var options Options
+	assert.Error(t, applyPreset("powerpoint", &options))
+}
+
+func TestOverlays(t *testing.T) {
+	var slides Options
+	assert.NoError(t, applyPreset("slides", &slides))
+
+	input := `\begin{itemize}
+  \item First
+  \pause
+  \item<2-> Second \only<3>{with $x$}
+  \item \alert{Third}
+\end{itemize}`
+	expected := "- First\n" +
+		"- Second with $x$" + fragmentAnnotation + "\n" +
+		"- **Third**"
+	assert.Equal(t, expected, convertWithOptions(input, slides))
+
+	input = "\\begin{enumerate}[<+->]\\item A \\item B\\end{enumerate}"
+	assert.Equal(t, "1. A"+fragmentAnnotation+"\n2. B"+fragmentAnnotation, convertWithOptions(input, slides))
+}
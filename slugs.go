@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Anchors of converted headings, so \ref to the \label of a section links to
+// the anchor the Markdown renderer generates for the heading. Renderers make
+// them from the text of the heading, each in their own way (Options.Slugs),
+// and number the ones which occur again (intro, intro-1, ...). Only
+// converted headings are counted, not the Markdown headings in the input.
+
+// Rules for making an anchor of the text of a heading, by renderer
+var slugStyles = map[string]func(text string) string{
+	"github": githubSlug,
+	"pandoc": pandocSlug,
+}
+
+// What does not show in the text of a heading: comments, HTML tags and the
+// destinations of links
+var headingMarkupRegexp = regexp.MustCompile(`<!--[\s\S]*?-->|<[^>]*>|\]\([^)]*\)`)
+
+// Returns the anchor the renderer of |style| ("github" if empty) generates for
+// a heading with |title|, without a number for headings occurring again
+func Slug(title, style string) string {
+	if style == "" {
+		style = "github"
+	}
+	return slugStyles[style](headingMarkupRegexp.ReplaceAllString(title, ""))
+}
+
+// Lowercase letters, numbers, - and _, with a - for each space
+func githubSlug(text string) string {
+	var slug strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_' {
+			slug.WriteRune(r)
+		} else if r == ' ' {
+			slug.WriteRune('-')
+		}
+	}
+	return slug.String()
+}
+
+// Lowercase letters, numbers, -, _ and ., with a - for spaces, from the first
+// letter on. "section" if nothing is left.
+func pandocSlug(text string) string {
+	var slug strings.Builder
+	space := false
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			slug.WriteRune('-')
+			space = false
+		}
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_' || r == '.' {
+			slug.WriteRune(r)
+		}
+	}
+
+	anchor := strings.TrimLeftFunc(slug.String(), func(r rune) bool { return !unicode.IsLetter(r) })
+	if anchor == "" {
+		return "section"
+	}
+	return anchor
+}
+
+// Returns the anchor of the converted heading with |title|
+func (c *Converter) headingAnchor(title string) string {
+	anchor := Slug(title, c.options.Slugs)
+	if c.doc.slugs == nil {
+		c.doc.slugs = map[string]int{}
+	}
+	n := c.doc.slugs[anchor]
+	c.doc.slugs[anchor] = n + 1
+	if n > 0 {
+		anchor = fmt.Sprintf("%s-%d", anchor, n)
+	}
+	return anchor
+}
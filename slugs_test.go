@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSlugs(t *testing.T) {
+	for title, slugs := range map[string][2]string{
+		"Hello, World!":                    {"hello-world", "hello-world"},
+		"2.1 Results  and  Über-Fälle":     {"21-results--and--über-fälle", "results-and-über-fälle"},
+		"Growth of <!--$x$--> over *time*": {"growth-of--over-time", "growth-of-over-time"},
+		"See [the code](http://a.b/c_d)":   {"see-the-code", "see-the-code"},
+		"snake_case and v1.2":              {"snake_case-and-v12", "snake_case-and-v1.2"},
+		"42":                               {"42", "section"},
+	} {
+		assert.Equal(t, slugs[0], Slug(title, ""), title)
+		assert.Equal(t, slugs[0], Slug(title, "github"), title)
+		assert.Equal(t, slugs[1], Slug(title, "pandoc"), title)
+	}
+}
+
+func TestReferencesToHeadings(t *testing.T) {
+	options := Options{Headings: true, NumberEquations: true}
+	input := `\section{Introduction}\label{sec:intro}
+See \ref{sec:again} and \autoref{sec:results}.
+\section{Introduction}
+\subsection{Results \label{sec:results}}
+\section{Introduction} \label{sec:again}`
+	expected := `# Introduction
+See [Introduction](#introduction-2) and [Results](#results).
+# Introduction
+## Results
+# Introduction`
+	assert.Equal(t, expected, convertWithOptions(input, options))
+
+	options.Slugs = "pandoc"
+	assert.Equal(t, "# 1 Intro\n[1 Intro](#intro)", convertWithOptions("\\section{1 Intro}\\label{a}\n\\ref{a}", options))
+
+	// Labels are wrapped without -number-equations
+	assert.Equal(t, "# A<!--\\label{a}-->", convertWithOptions("\\section{A}\\label{a}", Options{Headings: true}))
+
+	options.Slugs = "gitlab"
+	assert.Error(t, options.validate())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Classification of the input for editors, e.g. for semantic highlighting of
+// the mix of Markdown and LaTeX. The input is split like Convert does, i.e.
+//
+//      See $x$ and \cite{knuth}.
+//
+// is text ("See "), math ("$x$"), text (" and "), a LaTeX command
+// ("\cite{knuth}") and text (".").
+
+type SpanKind string
+
+const (
+	TextSpan        SpanKind = "text"
+	MathSpan        SpanKind = "math"
+	CommandSpan     SpanKind = "latex-command"
+	EnvironmentSpan SpanKind = "latex-env"
+	CommentSpan     SpanKind = "comment"
+)
+
+// A classified part of the input from byte Start up to (excluding) byte End
+type Span struct {
+	Kind       SpanKind
+	Start, End int
+}
+
+// Splits |in| into classified spans, covering all of it
+func Spans(in []byte) []Span {
+	return spans(in, Options{})
+}
+
+// Same as Spans for the conversion with |options|, e.g. environments which
+// are converted span their whole content
+func spans(in []byte, options Options) []Span {
+	c := NewConverter(in, options)
+	offset := func(i int) int { return i }
+	if c.doc.invalid != nil {
+		offsets := sourceOffsets(in)
+		offset = func(i int) int { return offsets[i] }
+	}
+
+	var spans []Span
+	if c.handleMetadata() {
+		spans = append(spans, Span{TextSpan, 0, offset(c.cursor)})
+	}
+	for !c.atEof() {
+		start := c.cursor
+		kind := c.skipSpan()
+
+		end := c.cursor
+		if end > c.inputLength {
+			end = c.inputLength
+		}
+
+		if n := len(spans); n > 0 && kind == TextSpan && spans[n-1].Kind == TextSpan {
+			spans[n-1].End = offset(end)
+		} else {
+			spans = append(spans, Span{kind, offset(start), offset(end)})
+		}
+	}
+	return spans
+}
+
+// The converter replaces invalid bytes (see NewConverter), this maps its
+// offsets back to those of |in|
+func sourceOffsets(in []byte) []int {
+	var offsets []int
+	for i := 0; i < len(in); {
+		r, size := utf8.DecodeRune(in[i:])
+		for n := utf8.RuneLen(r); n > 0; n-- {
+			offsets = append(offsets, i)
+		}
+		i += size
+	}
+	return append(offsets, len(in))
+}
+
+// Moves the cursor past the span at the cursor and returns its kind. The
+// output of the handlers is not used.
+func (c *Converter) skipSpan() SpanKind {
+	if !c.isSpecial(c.in[c.cursor]) {
+		c.cursor = c.plainTextEnd()
+		return TextSpan
+	}
+
+	if c.handleLinkDefinition() || c.handleLiteral() {
+		return TextSpan
+	}
+	if c.handleComments() || c.handleCDATA() {
+		return CommentSpan
+	}
+
+	if c.handleHTMLTag() {
+		return TextSpan
+	}
+	if c.current() == "\\" && c.next() == "$" {
+		c.cursor += 2
+		return TextSpan
+	}
+	if c.handleInlineMath() || c.handleMathDelimiters() {
+		return MathSpan
+	}
+
+	name := c.environmentName()
+	if c.handleLatex() {
+		switch {
+		case isMathEnvironment(name):
+			return MathSpan
+		case name != "":
+			return EnvironmentSpan
+		}
+		return CommandSpan
+	}
+
+	c.cursor += 1
+	return TextSpan
+}
+
+func isMathEnvironment(name string) bool {
+	for _, inner := range innerMathEnvironments {
+		if name == inner {
+			return true
+		}
+	}
+	return isDisplayMathEnvironment(strings.TrimSuffix(name, "*"))
+}
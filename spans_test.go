@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSpans(t *testing.T) {
+	input := "Größe $x$ \\$ \\cite{k} <!--\\a--> \\begin{tikz}\\end{tikz}\n\\begin{align*}a\\end{align*}\\[y\\]"
+	spans := Spans([]byte(input))
+
+	var kinds []SpanKind
+	var texts []string
+	for _, span := range spans {
+		kinds = append(kinds, span.Kind)
+		texts = append(texts, input[span.Start:span.End])
+	}
+	assert.Equal(t, []SpanKind{
+		TextSpan, MathSpan, TextSpan, CommandSpan, TextSpan, CommentSpan, TextSpan,
+		EnvironmentSpan, TextSpan, MathSpan, MathSpan,
+	}, kinds)
+	assert.Equal(t, []string{
+		"Größe ", "$x$", " \\$ ", "\\cite{k}", " ", "<!--\\a-->", " ",
+		"\\begin{tikz}\\end{tikz}", "\n", "\\begin{align*}a\\end{align*}", "\\[y\\]",
+	}, texts)
+}
+
+func TestSpansOfIncompleteInput(t *testing.T) {
+	for _, input := range []string{"a\\", "$x", "<!--", "\\begin{a}", "$$"} {
+		spans := Spans([]byte(input))
+		assert.Equal(t, len(input), spans[len(spans)-1].End, input)
+	}
+}
+
+func TestSpansOfInvalidInput(t *testing.T) {
+	assert.Equal(t, []Span{{TextSpan, 0, 3}, {MathSpan, 3, 6}}, Spans([]byte("\xffä$x$")))
+}
+
+func TestSpansOfHTMLTags(t *testing.T) {
+	assert.Equal(t, []Span{{TextSpan, 0, 20}, {MathSpan, 20, 23}}, Spans([]byte(`<a title="$x$">b</a>$y$`)))
+}
+
+func TestSpansOfLinkDefinitions(t *testing.T) {
+	assert.Equal(t, []Span{{TextSpan, 0, 14}, {MathSpan, 14, 17}}, Spans([]byte("[a]: /$b$ 'c'\n$x$")))
+}
+
+func TestSpansOfMetadata(t *testing.T) {
+	assert.Equal(t, []Span{{TextSpan, 0, 12}, {MathSpan, 12, 15}}, Spans([]byte("Title: $a$\n\n$x$")))
+}
+
+func TestSpansOfLiterals(t *testing.T) {
+	assert.Equal(t, []Span{{TextSpan, 0, 22}, {MathSpan, 22, 25}}, Spans([]byte("<!--md-->$a$<!--/md-->$x$")))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The stats command, which counts what a document consists of, from its
+// spans (see Spans): the words of its text, its math, LaTeX commands and
+// environments by name, and how long it takes to read.
+
+// Words read per minute, for the reading time
+const wordsPerMinute = 200
+
+type documentStats struct {
+	words, math, commands int
+	environments          map[string]int
+}
+
+// Returns the statistics of |in|
+func statistics(in []byte) documentStats {
+	stats := documentStats{environments: map[string]int{}}
+	for _, span := range Spans(in) {
+		switch span.Kind {
+		case TextSpan:
+			stats.words += countWords(string(in[span.Start:span.End]))
+		case MathSpan:
+			stats.math += 1
+		case CommandSpan:
+			stats.commands += 1
+		case EnvironmentSpan:
+			c := ByteArrayToConverter(in[span.Start:span.End])
+			stats.environments[c.environmentName()] += 1
+		}
+	}
+	return stats
+}
+
+// Counts the words of |text|, which have a letter or number, so Markdown
+// like "#" or "-" is not counted
+func countWords(text string) int {
+	words := 0
+	for _, field := range strings.Fields(text) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) >= 0 {
+			words += 1
+		}
+	}
+	return words
+}
+
+func (s *documentStats) add(other documentStats) {
+	s.words += other.words
+	s.math += other.math
+	s.commands += other.commands
+	for name, n := range other.environments {
+		s.environments[name] += n
+	}
+}
+
+// Formats the statistics under |name|
+func (s documentStats) format(name string) string {
+	minutes := (s.words + wordsPerMinute - 1) / wordsPerMinute
+
+	var names []string
+	for environment := range s.environments {
+		names = append(names, environment)
+	}
+	sort.Strings(names)
+	var environments []string
+	for _, environment := range names {
+		environments = append(environments, fmt.Sprintf("%s %d", environment, s.environments[environment]))
+	}
+
+	return fmt.Sprintf("%s\n  words         %d\n  math          %d\n  commands      %d\n  environments  %s\n  reading time  %d min\n",
+		name, s.words, s.math, s.commands, strings.Join(environments, ", "), minutes)
+}
+
+// Runs the stats command with |args|, returns the exit code
+func statsCommand(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s stats <file> [more files]\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	total := documentStats{environments: map[string]int{}}
+	failed := 0
+	for _, path := range flags.Args() {
+		in, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read input file %s\n", path)
+			failed += 1
+			continue
+		} else if err := binaryInput(in); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", path, err)
+			failed += 1
+			continue
+		}
+
+		stats := statistics(in)
+		total.add(stats)
+		fmt.Print(stats.format(path))
+	}
+	if flags.NArg() > 1 {
+		fmt.Print(total.format("total"))
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
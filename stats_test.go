@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestStatistics(t *testing.T) {
+	in := `# Results
+
+We found that $x = 1$ holds \cite{knuth}, see <!-- the -- old notes -->:
+
+- \begin{figure}\includegraphics{a.png}\end{figure}
+- \begin{equation}y\end{equation} \begin{figure}\end{figure}`
+	stats := statistics([]byte(in))
+	assert.Equal(t, documentStats{
+		words:        6,
+		math:         2,
+		commands:     1,
+		environments: map[string]int{"figure": 2},
+	}, stats)
+
+	expected := "notes.xmd\n  words         6\n  math          2\n  commands      1\n  environments  figure 2\n  reading time  1 min\n"
+	assert.Equal(t, expected, stats.format("notes.xmd"))
+
+	total := documentStats{environments: map[string]int{}}
+	total.add(stats)
+	total.add(statistics([]byte(strings.Repeat("word ", 400) + "\\begin{align}a\\end{align}\\begin{tabular}\\end{tabular}")))
+	assert.Equal(t, map[string]int{"figure": 2, "tabular": 1}, total.environments)
+	assert.Contains(t, total.format("total"), "words         406\n")
+	assert.Contains(t, total.format("total"), "reading time  3 min\n")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"strings"
+)
+
+// Conversion of math to Unicode text for targets without any math rendering,
+// e.g.
+//
+//      \alpha^2 \leq \frac{x+1}{2}  =>  α² ≤ (x+1)/2
+//
+// Only simple math reads well this way, but anything is better than LaTeX
+// source. Only enabled with Options.UnicodeMath.
+
+var mathSymbols = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ", "sigma": "σ",
+	"varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ",
+	"chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+
+	"times": "×", "cdot": "·", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗",
+	"circ": "∘", "bullet": "•", "star": "⋆",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"ll": "≪", "gg": "≫", "approx": "≈", "equiv": "≡", "sim": "∼",
+	"simeq": "≃", "cong": "≅", "propto": "∝",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆",
+	"supset": "⊃", "supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖",
+	"emptyset": "∅", "varnothing": "∅",
+	"forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬",
+	"land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨", "oplus": "⊕", "otimes": "⊗",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐",
+	"Leftrightarrow": "⇔", "implies": "⇒", "iff": "⇔", "mapsto": "↦",
+	"uparrow": "↑", "downarrow": "↓",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "sum": "∑", "prod": "∏",
+	"int": "∫", "iint": "∬", "oint": "∮", "hbar": "ℏ", "ell": "ℓ",
+	"Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "angle": "∠", "perp": "⊥",
+	"parallel": "∥", "mid": "∣", "prime": "′", "degree": "°",
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "vert": "|", "Vert": "‖",
+	"{": "{", "}": "}", "%": "%", "$": "$", "&": "&", "#": "#", "_": "_",
+	",": " ", ";": " ", ":": " ", "!": "", " ": " ", "quad": " ", "qquad": " ",
+	"left": "", "right": "", "displaystyle": "", "limits": "", "nolimits": "",
+}
+
+// Blackboard bold letters for \mathbb
+var doubleStruck = map[string]string{
+	"N": "ℕ", "Z": "ℤ", "Q": "ℚ", "R": "ℝ", "C": "ℂ", "P": "ℙ", "H": "ℍ",
+}
+
+var superscriptRunes = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶',
+	'7': '⁷', '8': '⁸', '9': '⁹', '+': '⁺', '-': '⁻', '=': '⁼', '(': '⁽',
+	')': '⁾', 'n': 'ⁿ', 'i': 'ⁱ', '′': '′',
+}
+
+var subscriptRunes = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆',
+	'7': '₇', '8': '₈', '9': '₉', '+': '₊', '-': '₋', '=': '₌', '(': '₍',
+	')': '₎', 'a': 'ₐ', 'e': 'ₑ', 'o': 'ₒ', 'x': 'ₓ', 'h': 'ₕ', 'k': 'ₖ',
+	'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ', 'p': 'ₚ', 's': 'ₛ', 't': 'ₜ', 'i': 'ᵢ',
+	'j': 'ⱼ', 'r': 'ᵣ', 'u': 'ᵤ', 'v': 'ᵥ',
+}
+
+// Commands whose argument is shown as is
+var mathTextCommands = map[string]bool{
+	"text": true, "textrm": true, "textit": true, "textbf": true, "mathrm": true,
+	"mathit": true, "mathbf": true, "mathsf": true, "mathtt": true, "mathcal": true,
+	"operatorname": true, "boldsymbol": true, "mbox": true,
+}
+
+// Translates |tex| to Unicode text
+func unicodeMath(tex string) string {
+	var result strings.Builder
+	c := ByteArrayToConverter([]byte(tex))
+	for !c.atEof() {
+		switch c.current() {
+		case "\\":
+			result.WriteString(c.unicodeMathCommand())
+			continue
+		case "^", "_":
+			script := superscriptRunes
+			if c.current() == "_" {
+				script = subscriptRunes
+			}
+			mark := c.current()
+			c.cursor += 1
+			result.WriteString(scriptText(mark, unicodeMath(c.readMathArgument()), script))
+			continue
+		case "{", "}":
+			// Plain grouping
+		case "&":
+			// Alignment
+		case "~":
+			result.WriteString(" ")
+		case "'":
+			result.WriteString("′")
+		default:
+			result.WriteString(c.current())
+		}
+		c.cursor += 1
+	}
+
+	// Rows of environments end up on lines of their own
+	var lines []string
+	for _, line := range strings.Split(result.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Translates the math command at the cursor, moving past it and its arguments
+func (c *Converter) unicodeMathCommand() string {
+	name := c.commandName()
+	if name == "" {
+		// \\ ends a row, \{ and friends are escaped characters
+		c.cursor += 1
+		if c.atEof() {
+			return ""
+		}
+		escaped := c.current()
+		c.cursor += 1
+		if escaped == "\\" {
+			return "\n"
+		}
+		return mathSymbols[escaped]
+	}
+	c.skipCommandName()
+
+	switch {
+	case name == "frac" || name == "dfrac" || name == "tfrac":
+		numerator := unicodeMath(c.readMathArgument())
+		denominator := unicodeMath(c.readMathArgument())
+		return parenthesize(numerator) + "/" + parenthesize(denominator)
+	case name == "sqrt":
+		root, _ := c.readOptionalArgument()
+		return scriptText("^", root, superscriptRunes) + "√" + parenthesize(unicodeMath(c.readMathArgument()))
+	case name == "mathbb":
+		letters := c.readMathArgument()
+		if symbol, ok := doubleStruck[letters]; ok {
+			return symbol
+		}
+		return letters
+	case name == "begin" || name == "end":
+		environment, _ := c.readArgument()
+		if name == "begin" && (environment == "array" || environment == "alignedat") {
+			c.readArgument()
+		}
+		return ""
+	case name == "intertext" || name == "shortintertext":
+		return "\n" + c.readMathArgument() + "\n"
+	case name == "tag":
+		return "    (" + c.readMathArgument() + ")"
+	case name == "label" || name == "nonumber" || name == "notag":
+		c.readArgument()
+		return ""
+	case mathTextCommands[name]:
+		return unicodeMath(c.readMathArgument())
+	}
+
+	if symbol, ok := mathSymbols[name]; ok {
+		return symbol
+	}
+	// Functions like \sin and \log, or anything unknown
+	return name
+}
+
+// Reads a {group} or a single character and returns its content
+func (c *Converter) readMathArgument() string {
+	for !c.atEof() && c.current() == " " {
+		c.cursor += 1
+	}
+	if argument, ok := c.readArgument(); ok {
+		return argument
+	}
+	if c.atEof() {
+		return ""
+	}
+	if c.commandName() != "" {
+		start := c.cursor
+		c.skipCommandName()
+		return string(c.in[start:c.cursor])
+	}
+	c.cursor += 1
+	return c.prev()
+}
+
+// Writes |text| with Unicode super- or subscript characters if they exist for
+// all of it, falls back to ^(text) and _(text)
+func scriptText(mark, text string, script map[rune]rune) string {
+	if text == "" {
+		return ""
+	}
+	var result strings.Builder
+	for _, r := range text {
+		s, ok := script[r]
+		if !ok {
+			return mark + parenthesize(text)
+		}
+		result.WriteRune(s)
+	}
+	return result.String()
+}
+
+// Puts parentheses around |term| unless it is a single symbol or number
+func parenthesize(term string) string {
+	if len([]rune(term)) <= 1 || strings.Trim(term, "0123456789.") == "" {
+		return term
+	}
+	return "(" + term + ")"
+}
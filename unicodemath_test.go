@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnicodeMath(t *testing.T) {
+	cases := map[string]string{
+		`\alpha^2 \leq \frac{x+1}{2}`:  "α² ≤ (x+1)/2",
+		`x_{n+1} = x_n^{2}`:            "xₙ₊₁ = xₙ²",
+		`e^{i\pi} + 1 = 0`:             "e^(iπ) + 1 = 0",
+		`\sqrt{2} \cdot \sqrt[3]{x y}`: "√2 · ³√(x y)",
+		`\forall x \in \mathbb{R}`:     "∀ x ∈ ℝ",
+		`\sin(x) \to \infty`:           "sin(x) → ∞",
+		`\left\{ a \right\}`:           "{ a }",
+		`f'(x) \text{ for all } x`:     "f′(x) for all x",
+	}
+	for tex, expected := range cases {
+		assert.Equal(t, expected, unicodeMath(tex), tex)
+	}
+}
+
+func TestUnicodeMathEnvironments(t *testing.T) {
+	options := Options{UnicodeMath: true}
+	input := "Solve $x^2 = 4$:\n\\begin{align*}\nx &= 2 \\\\\nx &= -2\n\\end{align*}\n$$|x| = \\begin{cases} x \\end{cases}$$"
+	expected := "Solve x² = 4:\nx = 2\nx = -2\n|x| = x"
+	assert.Equal(t, expected, convertWithOptions(input, options))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Validation of the math in a document by compiling it with TeX, so typos
+// like \alpah are caught before publication. All math is compiled in a single
+// document and TeX's errors are reported as warnings at the position of the
+// math they occur in, e.g.
+//
+//      3:12: Undefined control sequence (in $\alpah$)
+//
+// Only enabled with Options.ValidateLatex.
+
+// A piece of math and the position of its first character in the input
+type mathSpan struct {
+	tex      string
+	position int
+}
+
+// TeX used by default, in draft mode it does not write a PDF
+const defaultTexCommand = "pdflatex"
+
+var texErrorRegexp = regexp.MustCompile(`(?m)^(?:\./)?validate\.tex:(\d+): (.*)$`)
+
+// Counts the math from |start| to the cursor and records it for validation.
+// Positions are only known for the top level document, not for fragments.
+func (c *Converter) recordMath(start int) {
+	c.doc.stats.Math += 1
+	c.logSpan(MathSpan, start)
+	if !c.options.ValidateLatex || c.fragment {
+		return
+	}
+
+	end := c.cursor
+	if end > c.inputLength {
+		end = c.inputLength
+	}
+	c.doc.math = append(c.doc.math, mathSpan{string(c.in[start:end]), start})
+}
+
+// Compiles the recorded math and turns TeX's errors into warnings
+func (c *Converter) validateLatex() {
+	if !c.options.ValidateLatex || len(c.doc.math) == 0 {
+		return
+	}
+
+	var document bytes.Buffer
+	document.WriteString("\\documentclass{article}\n\\usepackage{amsmath,amssymb}\n")
+	for _, name := range loadedPackages([]byte(string(c.in))) {
+		document.WriteString("\\usepackage{" + name + "}\n")
+	}
+	document.WriteString("\\begin{document}\n")
+
+	// The line each span starts at in the document
+	var lines []int
+	for _, span := range c.doc.math {
+		lines = append(lines, bytes.Count(document.Bytes(), []byte("\n"))+1)
+		document.WriteString(span.tex + "\n\n")
+	}
+	document.WriteString("\\end{document}\n")
+
+	output, err := runTex(c.options.TexCommand, document.Bytes())
+	if err != nil {
+		c.warn("Could not validate LaTeX: %s", err)
+		return
+	}
+
+	for _, match := range texErrorRegexp.FindAllStringSubmatch(output, -1) {
+		line, _ := strconv.Atoi(match[1])
+		i := len(lines) - 1
+		for i > 0 && lines[i] > line {
+			i -= 1
+		}
+		if line < lines[0] {
+			c.warn("%s", match[2])
+			continue
+		}
+
+		span := c.doc.math[i]
+		p := c.position(span.position)
+		spanLine, column := p.Line, p.Column
+		if delta := line - lines[i]; delta > 0 {
+			spanLine, column = spanLine+delta, 1
+		}
+		c.warnAt(spanLine, column, "%s (in %s)", strings.TrimSuffix(match[2], "."), span.tex)
+	}
+}
+
+// Compiles |document| in draft mode and returns TeX's output. Errors are in
+// the output, TeX failing because of them is not an error.
+func runTex(command string, document []byte) (string, error) {
+	if command == "" {
+		command = defaultTexCommand
+	}
+
+	dir, err := ioutil.TempDir("", "merkderwn")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "validate.tex"), document, 0644); err != nil {
+		return "", err
+	}
+
+	args := strings.Fields(command)
+	args = append(args, "-draftmode", "-interaction=nonstopmode", "-file-line-error", "validate.tex")
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if _, failed := err.(*exec.ExitError); err != nil && !failed {
+		return "", fmt.Errorf("%s failed: %s", args[0], err)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes a fake TeX which prints |output| and fails
+func fakeTex(t *testing.T, output string) string {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	tex := filepath.Join(dir, "tex")
+	script := "#!/bin/sh\ncp validate.tex " + filepath.Join(dir, "document.tex") + "\ncat <<'EOF'\n" + output + "\nEOF\nexit 1\n"
+	assert.NoError(t, ioutil.WriteFile(tex, []byte(script), 0755))
+	return tex
+}
+
+func TestValidateLatex(t *testing.T) {
+	// Math starts at line 4 of the document, after the preamble
+	tex := fakeTex(t, "./validate.tex:6: Undefined control sequence.\n./validate.tex:10: Missing $ inserted.")
+	options := Options{ValidateLatex: true, TexCommand: tex}
+
+	input := "Some $x$ and\n\nmore $\\alpah$\n\\begin{align}\na \\\\\nb^\n\\end{align}"
+	c := NewConverter([]byte(input), options)
+	c.Convert()
+	assert.Equal(t, []string{
+		"3:6: Undefined control sequence (in $\\alpah$)",
+		"6:1: Missing $ inserted (in \\begin{align}\na \\\\\nb^\n\\end{align})",
+	}, c.Warnings())
+
+	document, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(tex), "document.tex"))
+	assert.Contains(t, string(document), "\\begin{document}\n$x$\n\n$\\alpah$\n\n\\begin{align}")
+}
+
+func TestValidateLatexWithoutMath(t *testing.T) {
+	options := Options{ValidateLatex: true, TexCommand: "/nonexistent/tex"}
+	c := NewConverter([]byte("No math"), options)
+	c.Convert()
+	assert.Empty(t, c.Warnings())
+
+	c = NewConverter([]byte("$x$"), options)
+	c.Convert()
+	assert.Len(t, c.Warnings(), 1)
+}
+
+func TestWarningFormat(t *testing.T) {
+	assert.Equal(t, "notes.xmd:3:6: typo", Warning{3, 6, "typo"}.in("notes.xmd"))
+	assert.Equal(t, "<stdin>: broken", Warning{Message: "broken"}.in("<stdin>"))
+}
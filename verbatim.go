@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Inline verbatim like \verb|$x$| or \lstinline{$x$} becomes a code span. Its
+// content is never interpreted, it may contain anything but the delimiter.
+
+func init() {
+	commandConverters["verb"] = (*Converter).convertVerb
+	commandConverters["lstinline"] = (*Converter).convertInlineListing
+	commandConverters["mintinline"] = (*Converter).convertInlineListing
+}
+
+// \verb<delimiter>code<delimiter> and \verb*
+func (c *Converter) convertVerb() bool {
+	start := c.cursor
+	c.skipCommandName()
+	if !c.atEof() && c.current() == "*" {
+		c.cursor += 1
+	}
+
+	code, ok := c.readDelimited()
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(codeSpan(code))
+	return true
+}
+
+// \lstinline[options]{code}, \lstinline[options]|code| and
+// \mintinline[options]{language}{code}
+func (c *Converter) convertInlineListing() bool {
+	start := c.cursor
+	name := c.commandName()
+	c.skipCommandName()
+	c.readOptionalArgument()
+
+	if name == "mintinline" {
+		if _, ok := c.readArgument(); !ok {
+			c.cursor = start
+			return false
+		}
+	}
+
+	code, ok := c.readVerbatimArgument()
+	if !ok {
+		code, ok = c.readDelimited()
+	}
+	if !ok {
+		c.cursor = start
+		return false
+	}
+
+	c.emit(codeSpan(code))
+	return true
+}
+
+// Reads a {verbatim argument}, unlike readArgument backslashes do not escape
+// anything. Braces still have to be balanced.
+func (c *Converter) readVerbatimArgument() (string, bool) {
+	if c.atEof() || c.current() != "{" {
+		return "", false
+	}
+
+	nesting := 0
+	for end := c.cursor; end < c.inputLength; end++ {
+		switch c.in[end] {
+		case '{':
+			nesting += 1
+		case '}':
+			nesting -= 1
+		}
+
+		if nesting == 0 {
+			content := string(c.in[c.cursor+1 : end])
+			c.cursor = end + 1
+			return content, true
+		}
+	}
+	return "", false
+}
+
+// Reads text between the delimiter at the cursor and its next occurrence on
+// the same line, e.g. |code| or +code+. Letters, spaces and "*" are no valid
+// delimiters, just like for \verb.
+func (c *Converter) readDelimited() (string, bool) {
+	if c.atEof() || strings.ContainsAny(c.current(), " \t\n*") {
+		return "", false
+	}
+	r, size := utf8.DecodeRune(c.in[c.cursor:])
+	if unicode.IsLetter(r) {
+		return "", false
+	}
+
+	delimiter := c.in[c.cursor : c.cursor+size]
+	for end := c.cursor + size; end < c.inputLength && c.in[end] != '\n'; end++ {
+		if bytes.HasPrefix(c.in[end:], delimiter) {
+			content := string(c.in[c.cursor+size : end])
+			c.cursor = end + size
+			return content, true
+		}
+	}
+	return "", false
+}
+
+// Wraps |code| in enough backticks that backticks inside it are literal
+func codeSpan(code string) string {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run += 1
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVerb(t *testing.T) {
+	assert.Equal(t, "Use `$x$ \\foo{` here", convertWithOptions("Use \\verb|$x$ \\foo{| here", Options{}))
+	assert.Equal(t, "`a|b`", convertWithOptions("\\verb+a|b+", Options{}))
+	assert.Equal(t, "``a`b``", convertWithOptions("\\verb*!a`b!", Options{}))
+	assert.Equal(t, "`` `x` ``", convertWithOptions("\\verb|`x`|", Options{}))
+	assert.Equal(t, "`x`", convertWithOptions("\\verb§x§", Options{}))
+
+	// Unterminated on the same line, wrapped as before
+	assert.Equal(t, "<!--\\verb|x-->\ny|", convertWithOptions("\\verb|x\ny|", Options{}))
+}
+
+func TestInlineListings(t *testing.T) {
+	assert.Equal(t, "Call `f(\\x)` now", convertWithOptions("Call \\lstinline{f(\\x)} now", Options{}))
+	assert.Equal(t, "`map{$k}`", convertWithOptions("\\lstinline[language=Perl]|map{$k}|", Options{}))
+	assert.Equal(t, "`{a}`", convertWithOptions("\\lstinline{{a}}", Options{}))
+	assert.Equal(t, "`x := 1`", convertWithOptions("\\mintinline{go}{x := 1}", Options{}))
+}
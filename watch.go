@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Watching the files given on the command line, for a live preview: they are
+// converted again whenever one of them changes. Files are polled for their
+// size and modification time rather than watched with inotify and friends,
+// which differ between platforms. Editors often write a file several times
+// when saving it, so once a change is seen the files are converted when they
+// have not changed for a while.
+
+const (
+	// How often the files are checked for changes
+	watchInterval = 250 * time.Millisecond
+
+	// How long the files must not change before they are converted again
+	watchDebounce = 300 * time.Millisecond
+)
+
+// What a watched file looks like, to tell whether it changed
+type fileState struct {
+	size    int64
+	modTime time.Time
+	exists  bool
+}
+
+// Returns the states of |paths|
+func snapshot(paths []string) map[string]fileState {
+	states := map[string]fileState{}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			states[path] = fileState{info.Size(), info.ModTime(), true}
+		} else {
+			states[path] = fileState{}
+		}
+	}
+	return states
+}
+
+func sameStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, state := range a {
+		if other, ok := b[path]; !ok || other.size != state.size || !other.modTime.Equal(state.modTime) || other.exists != state.exists {
+			return false
+		}
+	}
+	return true
+}
+
+// Converts the files returned by |list| with |convert|, which returns how
+// many failed, and again whenever they change, until |stop| is closed.
+// Reports how long each conversion took to |w|.
+func watchFiles(list func() []string, convert func(files []string) int, w io.Writer, stop <-chan struct{}) {
+	files := list()
+	last := snapshot(files)
+	for {
+		start := time.Now()
+		failed := convert(files)
+		fmt.Fprintf(w, "Converted %d files in %s", len(files)-failed, time.Since(start).Round(time.Millisecond))
+		if failed > 0 {
+			fmt.Fprintf(w, ", %d failed", failed)
+		}
+		fmt.Fprintln(w, ", watching for changes")
+
+		// Until a change, then until the files stay as they are
+		for changed := false; ; {
+			select {
+			case <-stop:
+				return
+			case <-time.After(watchInterval):
+			}
+			if changed {
+				select {
+				case <-stop:
+					return
+				case <-time.After(watchDebounce):
+				}
+			}
+
+			files = list()
+			current := snapshot(files)
+			if sameStates(current, last) {
+				if changed {
+					break
+				}
+				continue
+			}
+			changed = true
+			last = current
+		}
+	}
+}
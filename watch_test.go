@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.xmd"), filepath.Join(dir, "b.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$x$"), 0644))
+	before := snapshot([]string{a, b})
+	assert.True(t, sameStates(before, snapshot([]string{a, b})))
+	assert.False(t, sameStates(before, snapshot([]string{a})))
+
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$x + y$"), 0644))
+	assert.False(t, sameStates(before, snapshot([]string{a, b})))
+	assert.NoError(t, ioutil.WriteFile(b, nil, 0644))
+	assert.False(t, sameStates(snapshot([]string{a}), snapshot([]string{b})))
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkderwn-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.xmd")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$x$"), 0644))
+
+	var mutex sync.Mutex
+	var conversions []string
+	converted := make(chan bool, 10)
+	convert := func(files []string) int {
+		content, _ := ioutil.ReadFile(files[0])
+		mutex.Lock()
+		conversions = append(conversions, string(content))
+		mutex.Unlock()
+		converted <- true
+		return 0
+	}
+
+	var out bytes.Buffer
+	stop := make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		watchFiles(func() []string { return []string{a} }, convert, &out, stop)
+		done <- true
+	}()
+
+	<-converted
+	// Saved twice in a row, converted once
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$y$"), 0644))
+	assert.NoError(t, os.Chtimes(a, time.Now(), time.Now().Add(time.Second)))
+	time.Sleep(watchInterval / 2)
+	assert.NoError(t, ioutil.WriteFile(a, []byte("$z$"), 0644))
+	assert.NoError(t, os.Chtimes(a, time.Now(), time.Now().Add(2*time.Second)))
+	select {
+	case <-converted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Not converted again")
+	}
+	close(stop)
+	<-done
+
+	assert.Equal(t, []string{"$x$", "$z$"}, conversions)
+	assert.Equal(t, 2, strings.Count(out.String(), "Converted 1 files in "))
+}